@@ -0,0 +1,98 @@
+package fml
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const benchDoc = `title: Scala Basic
+toclevel: 2
+forceProcess: true
+ratio: 0.75
+published: 2014-07-06
+updated: 2014-07-06 12:03:31
+tags: [scala, basic, tutorial]
+ports: [8080, 8081, 8082]
+
+[database]
+host: localhost # the local one
+port: 1433
+user: admin
+timeout: 1.5
+created: 2014-07-06T12:03:31Z
+
+[staff]
+- name: Abby
+  age: 12
+  joined: 2014-07-06
+- name: Tony
+  age: 13
+  joined: 2014-07-07
+`
+
+//benchLargeDoc repeats a list item to get a document of n items
+func benchLargeDoc(n int) string {
+	var b strings.Builder
+	b.WriteString(benchDoc)
+	b.WriteString("\n[items]\n")
+	for i := 0; i < n; i++ {
+		b.WriteString("- id: ")
+		b.WriteString(strconv.Itoa(i))
+		b.WriteString("\n  name: item")
+		b.WriteString(strconv.Itoa(i))
+		b.WriteString("\n  price: 12.5\n  enabled: true\n  created: 2014-07-06 12:03:31\n")
+	}
+	return b.String()
+}
+
+func benchmarkParse(b *testing.B, input []byte) {
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Parse(input); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseSmall(b *testing.B) {
+	benchmarkParse(b, []byte(benchDoc))
+}
+
+func BenchmarkParseLarge(b *testing.B) {
+	benchmarkParse(b, []byte(benchLargeDoc(1000)))
+}
+
+func BenchmarkEval(b *testing.B) {
+	raws := []string{"12345", "-1.5e3", "true", "2014-07-06", "2014-07-06 12:03:31",
+		"2014-07-06T12:03:31Z", "plain text", "null"}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, raw := range raws {
+			eval(raw)
+		}
+	}
+}
+
+func BenchmarkUnmarshal(b *testing.B) {
+	type staff struct {
+		Name string
+		Age  int
+	}
+	type doc struct {
+		Title    string
+		Toclevel int
+		Ports    []int
+		Staff    []staff
+	}
+	input := []byte(benchDoc)
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var d doc
+		if err := Unmarshal(input, &d); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
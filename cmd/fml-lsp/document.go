@@ -0,0 +1,280 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/fipress/fml"
+	"github.com/fipress/fml/scanner"
+)
+
+type entryKind int
+
+const (
+	keyEntry entryKind = iota
+	nodeEntry
+	itemEntry
+)
+
+// An entry is a key, a node or an item of a node list in the source
+type entry struct {
+	kind entryKind
+	//like "database.port", "staff[0].name", "database" or "staff[0]"
+	path string
+	name string
+	//the key, the node header or the list marker
+	tok scanner.Token
+	//where the value of a key is, start == end if it has none
+	valueStart, valueEnd int
+	//where the entry ends, including the entries in it
+	end    int
+	base   string
+	isList bool
+	items  int
+
+	children []*entry
+}
+
+func (e *entry) childPath(name string) string {
+	if e == nil || len(e.path) == 0 {
+		return name
+	}
+	return e.path + "." + name
+}
+
+// A document is an open file with what is known about it
+type document struct {
+	uri  string
+	src  []byte
+	doc  *fml.FML
+	root *entry
+	//the entries in source order
+	entries []*entry
+	//the node or list item a line belongs to at its start, nil for the top level
+	lineContainers map[int]*entry
+	scanErrors     []*scanner.Error
+	parseErr       error
+	lineStarts     []int
+}
+
+func newDocument(uri string, text string) *document {
+	d := &document{uri: uri, src: []byte(text)}
+	d.lineStarts = []int{0}
+	for i, c := range d.src {
+		if c == '\n' {
+			d.lineStarts = append(d.lineStarts, i+1)
+		}
+	}
+	d.doc, d.parseErr = fml.Parse(d.src)
+	d.walk()
+	return d
+}
+
+//walk builds the entries from the tokens, following the blocks of the parser:
+//a node ends at a blank line, a node list at a blank line not followed by a list item.
+func (d *document) walk() {
+	s := scanner.New(d.src, scanner.WithFaultTolerance())
+	d.root = &entry{kind: nodeEntry}
+	d.lineContainers = make(map[int]*entry)
+
+	var node, container, key *entry
+	line, lineHasContent, afterBlank := 0, false, false
+	extend := func(end int) {
+		for _, e := range []*entry{key, container, node} {
+			if e != nil && e.end < end {
+				e.end = end
+			}
+		}
+	}
+	closeNode := func() {
+		node, container, afterBlank = nil, nil, false
+	}
+
+	for t := s.Next(); t.Kind != scanner.EOF; t = s.Next() {
+		text := string(d.src[t.Start:t.End])
+		switch t.Kind {
+		case scanner.Newline:
+			if !lineHasContent && node != nil {
+				if node.isList && !afterBlank {
+					afterBlank = true
+				} else {
+					closeNode()
+				}
+			}
+			line += strings.Count(text, "\n")
+			lineHasContent = false
+			key = nil
+			if afterBlank {
+				d.lineContainers[line] = nil
+			} else {
+				d.lineContainers[line] = container
+			}
+		case scanner.NodeHeader:
+			lineHasContent, afterBlank = true, false
+			name, base := splitHeader(text)
+			node = &entry{kind: nodeEntry, path: name, name: name, tok: t, end: t.End, base: base}
+			container, key = node, nil
+			d.add(d.root, node)
+		case scanner.ListMarker:
+			lineHasContent, afterBlank = true, false
+			if node == nil {
+				break
+			}
+			node.isList = true
+			item := &entry{kind: itemEntry, path: node.path + "[" + strconv.Itoa(node.items) + "]",
+				name: "[" + strconv.Itoa(node.items) + "]", tok: t, end: t.End}
+			node.items++
+			d.add(node, item)
+			container = item
+			d.lineContainers[line] = item
+			extend(t.End)
+		case scanner.Key:
+			lineHasContent = true
+			if afterBlank || strings.HasPrefix(text, "- ") {
+				//a key after a node list, or a list marker out of a list, is at the top level
+				closeNode()
+			}
+			afterBlank = false
+			parent := container
+			if parent == nil {
+				parent = d.root
+			}
+			key = &entry{kind: keyEntry, path: parent.childPath(text), name: text, tok: t, end: t.End}
+			d.add(parent, key)
+			extend(t.End)
+		case scanner.Scalar, scanner.String, scanner.Literal, scanner.ArrayStart,
+			scanner.ArrayEnd, scanner.Comma:
+			if key != nil {
+				if key.valueStart == key.valueEnd {
+					key.valueStart = t.Start
+				}
+				key.valueEnd = t.End
+				extend(t.End)
+			}
+			line += strings.Count(text, "\n")
+		case scanner.Illegal:
+			lineHasContent = true
+			line += strings.Count(text, "\n")
+		}
+	}
+	d.scanErrors = s.Errors()
+}
+
+func (d *document) add(parent, e *entry) {
+	parent.children = append(parent.children, e)
+	d.entries = append(d.entries, e)
+}
+
+//splitHeader splits a node header like [prod : base] into the name and the base
+func splitHeader(header string) (name, base string) {
+	name = strings.TrimSuffix(strings.TrimPrefix(header, "["), "]")
+	if i := strings.IndexByte(name, ':'); i != -1 {
+		base = strings.TrimSpace(name[i+1:])
+		name = name[:i]
+	}
+	segs := strings.Split(name, ".")
+	for i := range segs {
+		segs[i] = strings.TrimSpace(segs[i])
+	}
+	return strings.Join(segs, "."), base
+}
+
+//entryAt gets the innermost entry whose token or value contains the offset
+func (d *document) entryAt(offset int) *entry {
+	for _, e := range d.entries {
+		if e.tok.Start <= offset && offset <= e.tok.End ||
+			e.valueStart != e.valueEnd && e.valueStart <= offset && offset <= e.valueEnd {
+			return e
+		}
+	}
+	return nil
+}
+
+func (d *document) findNode(path string) *entry {
+	for _, e := range d.root.children {
+		if e.kind == nodeEntry && e.path == path {
+			return e
+		}
+	}
+	return nil
+}
+
+//value evaluates the value of a key entry on its own, so it works for any entry,
+//even if the document fails to parse or the entry is of an inactive profile
+func (d *document) value(e *entry) (interface{}, bool) {
+	if e.kind != keyEntry {
+		return nil, false
+	}
+	single, err := fml.ParseString("v: " + string(d.src[e.valueStart:e.valueEnd]))
+	if err != nil {
+		return nil, false
+	}
+	return single.Lookup("v")
+}
+
+//resolved gets a node or a node list of the parsed document, with what it inherits
+func (d *document) resolved(path string) (interface{}, bool) {
+	if d.doc == nil {
+		return nil, false
+	}
+	return d.doc.Lookup(path)
+}
+
+func (d *document) position(offset int) position {
+	if offset > len(d.src) {
+		offset = len(d.src)
+	}
+	line := sort.Search(len(d.lineStarts), func(i int) bool { return d.lineStarts[i] > offset }) - 1
+	return position{Line: line, Character: utf16Len(d.src[d.lineStarts[line]:offset])}
+}
+
+func (d *document) offset(pos position) int {
+	if pos.Line >= len(d.lineStarts) {
+		return len(d.src)
+	} else if pos.Line < 0 {
+		return 0
+	}
+	i, n := d.lineStarts[pos.Line], 0
+	for i < len(d.src) && d.src[i] != '\n' && n < pos.Character {
+		r, size := utf8.DecodeRune(d.src[i:])
+		n += utf16RuneLen(r)
+		i += size
+	}
+	return i
+}
+
+func (d *document) rangeOf(start, end int) lspRange {
+	return lspRange{d.position(start), d.position(end)}
+}
+
+//lineRange gets the range of a line starting from 1, without the line end
+func (d *document) lineRange(line int) lspRange {
+	if line < 1 || line > len(d.lineStarts) {
+		line = len(d.lineStarts)
+	}
+	start := d.lineStarts[line-1]
+	end := start
+	for end < len(d.src) && d.src[end] != '\n' && d.src[end] != '\r' {
+		end++
+	}
+	return d.rangeOf(start, end)
+}
+
+//utf16Len counts the UTF-16 code units, which the protocol counts characters in
+func utf16Len(b []byte) (n int) {
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		n += utf16RuneLen(r)
+		b = b[size:]
+	}
+	return
+}
+
+func utf16RuneLen(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
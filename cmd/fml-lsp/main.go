@@ -0,0 +1,31 @@
+// Command fml-lsp is a language server for fml files, it talks the language server protocol over stdio.
+//
+// Usage:
+//
+//	fml-lsp [-schema schemafile]
+//
+// It publishes diagnostics of parsing and of the schema, and provides hover with the types and values of keys,
+// go-to-definition from [node : base] to the base node, symbols of nodes, node lists and their items,
+// completion of keys from the schema, and formatting with fml.Format, aligning values if the
+// "align" initialization option is true.
+//
+// The schema is the file given by -schema or by the "schema" initialization option,
+// otherwise the one next to a document, like config.schema.fml for config.fml.
+// See schema for the format.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+func main() {
+	schemaPath := flag.String("schema", "", "the schema for all documents")
+	flag.Parse()
+
+	if err := newServer(os.Stdout, *schemaPath).run(os.Stdin); err != nil {
+		fmt.Fprintln(os.Stderr, "fml-lsp:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testDoc = `name: demo
+password: s3cret
+
+[base]
+host: localhost
+port: 1433
+
+[prod : base]
+host: prod.example.com
+port: "5432"
+
+[staff]
+- name: Abby
+  age: 12
+- name: Tony
+  agee: 13
+`
+
+const testSchema = `name: string
+password: string
+
+[base]
+host: string
+port: int
+
+[prod]
+host: string
+port: int
+user: string
+
+[staff]
+- name: string
+  age: int
+`
+
+//session runs the server with the messages, and gets the responses and notifications
+func session(t *testing.T, msgs ...*message) (results map[string]json.RawMessage, diags [][]diagnostic) {
+	var in, out bytes.Buffer
+	for _, msg := range append(msgs, &message{Method: "exit"}) {
+		if err := writeMessage(&in, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := newServer(&out, "").run(&in); err != nil {
+		t.Fatal("Should serve, err:", err)
+	}
+
+	results = make(map[string]json.RawMessage)
+	r := bufio.NewReader(&out)
+	for {
+		msg, err := readMessage(r)
+		if err != nil {
+			break
+		}
+		if msg.ID != nil {
+			var result json.RawMessage
+			body, _ := json.Marshal(msg.Result)
+			json.Unmarshal(body, &result)
+			if msg.Error != nil {
+				result = json.RawMessage(`"error: ` + msg.Error.Message + `"`)
+			}
+			results[string(*msg.ID)] = result
+		} else if msg.Method == "textDocument/publishDiagnostics" {
+			var p publishDiagnosticsParams
+			json.Unmarshal(msg.Params, &p)
+			diags = append(diags, p.Diagnostics)
+		}
+	}
+	return
+}
+
+func request(id int, method string, params interface{}) *message {
+	raw := json.RawMessage(strings.TrimSpace(string(mustMarshal(id))))
+	return &message{ID: &raw, Method: method, Params: mustMarshal(params)}
+}
+
+func notification(method string, params interface{}) *message {
+	return &message{Method: method, Params: mustMarshal(params)}
+}
+
+func mustMarshal(v interface{}) json.RawMessage {
+	body, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return body
+}
+
+func at(uri string, line, character int) textDocumentPositionParams {
+	return textDocumentPositionParams{TextDocument: textDocumentIdentifier{URI: uri},
+		Position: position{Line: line, Character: character}}
+}
+
+func TestServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fml-lsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "app.schema.fml"), []byte(testSchema), 0600)
+	uri := "file://" + filepath.Join(dir, "app.fml")
+	other := "file://" + filepath.Join(dir, "other.fml")
+
+	results, diags := session(t,
+		request(1, "initialize", map[string]interface{}{}),
+		notification("textDocument/didOpen", didOpenParams{TextDocument: textDocumentItem{URI: uri, Text: testDoc}}),
+		request(2, "textDocument/hover", at(uri, 4, 1)),
+		request(3, "textDocument/hover", at(uri, 1, 1)),
+		request(4, "textDocument/definition", at(uri, 7, 10)),
+		request(5, "textDocument/documentSymbol", documentSymbolParams{TextDocument: textDocumentIdentifier{URI: uri}}),
+		request(6, "textDocument/completion", at(uri, 8, 0)),
+		request(7, "textDocument/rename", nil),
+		request(8, "textDocument/formatting", documentFormattingParams{TextDocument: textDocumentIdentifier{URI: uri}}),
+		notification("textDocument/didOpen", didOpenParams{TextDocument: textDocumentItem{URI: other, Text: "[a]\nb:1\n"}}),
+		request(9, "textDocument/formatting", documentFormattingParams{TextDocument: textDocumentIdentifier{URI: other}}),
+		notification("textDocument/didChange", didChangeParams{TextDocument: textDocumentIdentifier{URI: uri},
+			ContentChanges: []struct {
+				Text string `json:"text"`
+			}{{Text: "name: 1\npassword: \"open\n"}}}),
+		request(10, "shutdown", nil),
+	)
+
+	if !strings.Contains(string(results["1"]), `"hoverProvider":true`) {
+		t.Error("Should initialize, result:", string(results["1"]))
+	}
+	if len(diags) != 3 {
+		t.Fatal("Should publish diagnostics on open and change, got:", diags)
+	}
+	var messages []string
+	for _, d := range diags[0] {
+		messages = append(messages, d.Message)
+	}
+	expected := "expected int, got string: prod.port|unknown key: staff.agee"
+	if strings.Join(messages, "|") != expected {
+		t.Error("Should check with the schema, got:", messages)
+	}
+	if len(diags[2]) != 1 || diags[2][0].Message != "quoted string is not closed" ||
+		diags[2][0].Range.Start != (position{1, 10}) {
+		t.Error("Should report the error with its range, got:", diags[2])
+	}
+
+	if !strings.Contains(string(results["2"]), "**base.host** `string`") ||
+		!strings.Contains(string(results["2"]), "localhost") {
+		t.Error("Should hover a key, got:", string(results["2"]))
+	}
+	if strings.Contains(string(results["3"]), "s3cret") {
+		t.Error("Should mask a sensitive value, got:", string(results["3"]))
+	}
+	var locations []location
+	json.Unmarshal(results["4"], &locations)
+	if len(locations) != 1 || locations[0].URI != uri || locations[0].Range.Start != (position{3, 0}) {
+		t.Error("Should go to the base node, got:", string(results["4"]))
+	}
+	var syms []documentSymbol
+	json.Unmarshal(results["5"], &syms)
+	if len(syms) != 5 || syms[4].Name != "staff" || syms[4].Kind != symbolArray ||
+		len(syms[4].Children) != 2 || syms[4].Children[1].Children[1].Name != "agee" {
+		t.Error("Should get symbols, got:", string(results["5"]))
+	}
+	var items []completionItem
+	json.Unmarshal(results["6"], &items)
+	if len(items) != 1 || items[0].Label != "user" || items[0].InsertText != "user: " {
+		t.Error("Should complete the missing key, got:", string(results["6"]))
+	}
+	if !strings.HasPrefix(string(results["7"]), `"error: method not found`) {
+		t.Error("Should reject unknown methods, got:", string(results["7"]))
+	}
+	if string(results["8"]) != "[]" {
+		t.Error("Should not edit a formatted document, got:", string(results["8"]))
+	}
+	var edits []textEdit
+	json.Unmarshal(results["9"], &edits)
+	if len(edits) != 1 || edits[0].NewText != "[a]\nb: 1\n" || edits[0].Range.End != (position{2, 0}) {
+		t.Error("Should format the document, got:", string(results["9"]))
+	}
+}
+
+func TestSchemaCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.schema.fml")
+	ioutil.WriteFile(path, []byte(testSchema), 0600)
+
+	s := newServer(ioutil.Discard, "")
+	uri := "file://" + filepath.Join(dir, "app.fml")
+	sc := s.schemaFor(uri)
+	if sc == nil || sc.types["base.port"] != "int" || s.schemaFor(uri) != sc {
+		t.Fatal("Should parse the schema once, got:", sc)
+	}
+
+	ioutil.WriteFile(path, []byte("name: string\n"), 0600)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(path, later, later)
+	if changed := s.schemaFor(uri); changed == sc || changed == nil || len(changed.types) != 1 {
+		t.Error("Should parse the schema again once it changes, got:", changed)
+	}
+	os.Remove(path)
+	if s.schemaFor(uri) != nil {
+		t.Error("Should have no schema once it is removed")
+	}
+}
+
+func TestMalformedMessages(t *testing.T) {
+	var in, out bytes.Buffer
+	in.WriteString("Content-Length: 6\r\n\r\n{bad:}")
+	writeMessage(&in, request(1, "shutdown", nil))
+	writeMessage(&in, &message{Method: "exit"})
+	if err := newServer(&out, "").run(&in); err != nil {
+		t.Fatal("Should keep serving after malformed json, err:", err)
+	}
+
+	if !strings.Contains(out.String(), `"id":null`) {
+		t.Error("Should reply with a null id, got:", out.String())
+	}
+	r := bufio.NewReader(&out)
+	msg, err := readMessage(r)
+	if err != nil || msg.Error == nil || msg.Error.Code != errParse {
+		t.Error("Should reply with a parse error, got:", msg, err)
+	}
+	if msg, err = readMessage(r); err != nil || string(*msg.ID) != "1" || msg.Error != nil {
+		t.Error("Should answer the next request, got:", msg, err)
+	}
+
+	for _, length := range []string{"-1", "1073741824"} {
+		in.Reset()
+		in.WriteString("Content-Length: " + length + "\r\n\r\n{}")
+		if err = newServer(ioutil.Discard, "").run(&in); err != errInvalidContentLength {
+			t.Error("Should reject the length", length, "got:", err)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+)
+
+//maxContentLength is the largest message the server reads, far more than any fml document needs
+const maxContentLength = 64 << 20
+
+var (
+	errNoContentLength      = errors.New("missing Content-Length header")
+	errInvalidContentLength = errors.New("invalid Content-Length header")
+)
+
+//a jsonError is a message whose body is not valid json, it gets a parse error response
+//and the server goes on with the next message
+type jsonError struct {
+	error
+}
+
+//readMessage reads a message framed by a Content-Length header
+func readMessage(r *bufio.Reader) (msg *message, err error) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		return
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, errNoContentLength
+	}
+	if length < 0 || length > maxContentLength {
+		return nil, errInvalidContentLength
+	}
+
+	body := make([]byte, length)
+	if _, err = io.ReadFull(r, body); err != nil {
+		return
+	}
+	msg = new(message)
+	if err = json.Unmarshal(body, msg); err != nil {
+		return nil, jsonError{err}
+	}
+	return
+}
+
+func writeMessage(w io.Writer, msg *message) error {
+	msg.JSONRPC = "2.0"
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if _, err = fmt.Fprintf(w, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err = w.Write(body)
+	return err
+}
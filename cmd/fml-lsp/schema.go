@@ -0,0 +1,246 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fipress/fml"
+)
+
+const (
+	schemaSuffix = ".schema.fml"
+	nodeType     = "node"
+	listType     = "node list"
+)
+
+// A schema describes the keys of documents, it is a fml file mirroring them with types as values:
+//
+//	name: string
+//	tags: string[]
+//
+//	[database]
+//	port: int
+//
+//	[staff]
+//	- name: string
+//	  joined: datetime
+//
+// The types are string, int, float, bool, datetime, any, and arrays of them like int[].
+// Keys of items of node lists are described by the items of the schema, merged.
+type schema struct {
+	//types by path without indexes and profiles
+	types map[string]string
+}
+
+func loadSchema(path string) (*schema, error) {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	d := newDocument("", string(src))
+	if d.parseErr != nil {
+		return nil, d.parseErr
+	}
+
+	s := &schema{types: make(map[string]string)}
+	for _, e := range d.entries {
+		path := schemaPath(e.path)
+		switch e.kind {
+		case keyEntry:
+			s.types[path] = strings.TrimSpace(string(d.src[e.valueStart:e.valueEnd]))
+		case nodeEntry:
+			s.types[path] = nodeType
+			if e.isList {
+				s.types[path] = listType
+			}
+			//[a.b] makes a a node too
+			for i := strings.LastIndexByte(path, '.'); i != -1; i = strings.LastIndexByte(path[:i], '.') {
+				if _, ok := s.types[path[:i]]; !ok {
+					s.types[path[:i]] = nodeType
+				}
+			}
+		}
+	}
+	return s, nil
+}
+
+//a cachedSchema is a schema file parsed, which is parsed again once the file changes
+type cachedSchema struct {
+	modTime time.Time
+	size    int64
+	//nil if the file failed to parse
+	schema *schema
+}
+
+//schemaFor gets the schema of a document, from the path of the server or next to the document,
+//like config.schema.fml for config.fml
+func (s *server) schemaFor(uri string) *schema {
+	path := s.schemaPath
+	if len(path) == 0 {
+		file := uriToPath(uri)
+		if len(file) == 0 {
+			return nil
+		}
+		path = strings.TrimSuffix(file, ".fml") + schemaSuffix
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+	if c, ok := s.schemas[path]; ok && c.modTime.Equal(info.ModTime()) && c.size == info.Size() {
+		return c.schema
+	}
+
+	sc, err := loadSchema(path)
+	if err != nil {
+		sc = nil
+	}
+	s.schemas[path] = &cachedSchema{modTime: info.ModTime(), size: info.Size(), schema: sc}
+	return sc
+}
+
+//schemaPath removes indexes and profiles from a path, like staff[0].name@prod to staff.name
+func schemaPath(path string) string {
+	segs := strings.Split(path, ".")
+	for i, seg := range segs {
+		if j := strings.IndexByte(seg, '['); j != -1 {
+			seg = seg[:j]
+		}
+		if j := strings.LastIndexByte(seg, '@'); j > 0 {
+			seg = strings.TrimSpace(seg[:j])
+		}
+		segs[i] = seg
+	}
+	return strings.Join(segs, ".")
+}
+
+func parentPath(path string) string {
+	if i := strings.LastIndexByte(path, '.'); i != -1 {
+		return path[:i]
+	}
+	return ""
+}
+
+func (s *schema) isContainer(path string) bool {
+	t := s.types[path]
+	return len(path) == 0 || t == nodeType || t == listType
+}
+
+//check reports the keys and nodes unknown to the schema, and the values of other types
+func (s *schema) check(d *document) (diags []diagnostic) {
+	add := func(e *entry, severity int, msg string) {
+		diags = append(diags, diagnostic{Range: d.rangeOf(e.tok.Start, e.tok.End),
+			Severity: severity, Source: "fml-schema", Message: msg})
+	}
+	for _, e := range d.entries {
+		if e.kind == itemEntry {
+			continue
+		}
+		path := schemaPath(e.path)
+		t, ok := s.types[path]
+		if !ok {
+			//only the first unknown level is reported
+			if s.isContainer(parentPath(path)) {
+				add(e, severityWarning, "unknown "+entryName(e)+": "+path)
+			}
+			continue
+		}
+
+		switch {
+		case e.kind == nodeEntry && t == listType && !e.isList:
+			add(e, severityError, "expected a node list: "+path)
+		case e.kind == nodeEntry && t == nodeType && e.isList:
+			add(e, severityError, "expected a node, not a node list: "+path)
+		case e.kind == nodeEntry && !s.isContainer(path):
+			add(e, severityError, "expected "+t+", not a node: "+path)
+		case e.kind == keyEntry && s.isContainer(path):
+			add(e, severityError, "expected a "+t+": "+path)
+		case e.kind == keyEntry:
+			if v, ok := d.value(e); ok && !typeMatches(t, v) {
+				add(e, severityError, "expected "+t+", got "+typeName(v)+": "+path)
+			}
+		}
+	}
+	return
+}
+
+func entryName(e *entry) string {
+	if e.kind == nodeEntry {
+		return "node"
+	}
+	return "key"
+}
+
+//keys gets the keys of a node or of the items of a node list with their types
+func (s *schema) keys(container string) (keys []string) {
+	for path, t := range s.types {
+		if parentPath(path) == container && t != nodeType && t != listType {
+			keys = append(keys, lastSegment(path))
+		}
+	}
+	sort.Strings(keys)
+	return
+}
+
+func lastSegment(path string) string {
+	return path[strings.LastIndexByte(path, '.')+1:]
+}
+
+//typeName gets the schema type of a value
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case int:
+		return "int"
+	case float64:
+		return "float"
+	case bool:
+		return "bool"
+	case time.Time:
+		return "datetime"
+	case fml.Secret:
+		return "secret"
+	case []string:
+		return "string[]"
+	case []int:
+		return "int[]"
+	case []float64:
+		return "float[]"
+	case []bool:
+		return "bool[]"
+	case []time.Time:
+		return "datetime[]"
+	case *fml.FML:
+		return nodeType
+	case []*fml.FML:
+		return listType
+	}
+	return "any"
+}
+
+//typeMatches reports whether a value is of a schema type.
+//Null and secrets match any type, strings accept any scalar and floats accept ints.
+func typeMatches(t string, v interface{}) bool {
+	actual := typeName(v)
+	if t == "any" || t == actual || actual == "null" || actual == "secret" {
+		return true
+	}
+	switch t {
+	case "string":
+		return !strings.HasSuffix(actual, "[]")
+	case "float":
+		return actual == "int"
+	case "float[]":
+		return actual == "int[]"
+	case "int", "bool", "datetime", "string[]", "int[]", "bool[]", "datetime[]":
+		return false
+	}
+	//unknown types are not checked
+	return true
+}
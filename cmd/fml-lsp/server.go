@@ -0,0 +1,417 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fipress/fml"
+)
+
+type handler func(s *server, params json.RawMessage) (result interface{}, err error)
+
+var handlers = map[string]handler{
+	"initialize":                  (*server).initialize,
+	"shutdown":                    (*server).shutdown,
+	"textDocument/didOpen":        (*server).didOpen,
+	"textDocument/didChange":      (*server).didChange,
+	"textDocument/didClose":       (*server).didClose,
+	"textDocument/hover":          (*server).hover,
+	"textDocument/definition":     (*server).definition,
+	"textDocument/documentSymbol": (*server).documentSymbol,
+	"textDocument/completion":     (*server).completion,
+	"textDocument/formatting":     (*server).formatting,
+}
+
+type server struct {
+	out  io.Writer
+	docs map[string]*document
+	//the schema for all documents, if not set documents use the one next to them
+	schemaPath string
+	//schemas parsed by path
+	schemas    map[string]*cachedSchema
+	align      bool
+	shutdownOK bool
+}
+
+func newServer(out io.Writer, schemaPath string) *server {
+	return &server{out: out, docs: make(map[string]*document), schemaPath: schemaPath,
+		schemas: make(map[string]*cachedSchema)}
+}
+
+//run serves until the exit notification, the error is nil if shutdown came before it
+func (s *server) run(in io.Reader) error {
+	r := bufio.NewReader(in)
+	for {
+		msg, err := readMessage(r)
+		if je, ok := err.(jsonError); ok {
+			//the id can't be read, so the response has a null one
+			id := json.RawMessage("null")
+			resp := &message{ID: &id, Error: &responseError{Code: errParse, Message: "parse error: " + je.Error()}}
+			if err = writeMessage(s.out, resp); err != nil {
+				return err
+			}
+			continue
+		} else if err != nil {
+			return err
+		}
+		if msg.Method == "exit" {
+			if !s.shutdownOK {
+				return fmt.Errorf("exit without shutdown")
+			}
+			return nil
+		}
+		if err = s.handle(msg); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *server) handle(msg *message) error {
+	h, ok := handlers[msg.Method]
+	if msg.ID == nil {
+		//notifications get no response, unknown ones are ignored
+		if ok {
+			h(s, msg.Params)
+		}
+		return nil
+	}
+
+	resp := &message{ID: msg.ID}
+	if !ok {
+		resp.Error = &responseError{Code: errMethodNotFound, Message: "method not found: " + msg.Method}
+		return writeMessage(s.out, resp)
+	}
+	result, err := h(s, msg.Params)
+	if err != nil {
+		resp.Error = &responseError{Code: errInvalidParams, Message: err.Error()}
+	} else if result == nil {
+		resp.Result = json.RawMessage("null")
+	} else {
+		resp.Result = result
+	}
+	return writeMessage(s.out, resp)
+}
+
+func (s *server) notify(method string, params interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return writeMessage(s.out, &message{Method: method, Params: body})
+}
+
+func (s *server) initialize(params json.RawMessage) (interface{}, error) {
+	var p initializeParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	if len(p.InitializationOptions.Schema) != 0 {
+		s.schemaPath = p.InitializationOptions.Schema
+	}
+	s.align = p.InitializationOptions.Align
+	return map[string]interface{}{
+		"capabilities": map[string]interface{}{
+			"textDocumentSync":           1,
+			"hoverProvider":              true,
+			"definitionProvider":         true,
+			"documentSymbolProvider":     true,
+			"completionProvider":         map[string]interface{}{},
+			"documentFormattingProvider": true,
+		},
+		"serverInfo": map[string]string{"name": "fml-lsp"},
+	}, nil
+}
+
+func (s *server) shutdown(params json.RawMessage) (interface{}, error) {
+	s.shutdownOK = true
+	return nil, nil
+}
+
+func (s *server) didOpen(params json.RawMessage) (interface{}, error) {
+	var p didOpenParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	return nil, s.update(p.TextDocument.URI, p.TextDocument.Text)
+}
+
+func (s *server) didChange(params json.RawMessage) (interface{}, error) {
+	var p didChangeParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	//the sync is full, the last change is the whole text
+	if n := len(p.ContentChanges); n != 0 {
+		return nil, s.update(p.TextDocument.URI, p.ContentChanges[n-1].Text)
+	}
+	return nil, nil
+}
+
+func (s *server) didClose(params json.RawMessage) (interface{}, error) {
+	var p didCloseParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	delete(s.docs, p.TextDocument.URI)
+	return nil, s.notify("textDocument/publishDiagnostics",
+		publishDiagnosticsParams{URI: p.TextDocument.URI, Diagnostics: []diagnostic{}})
+}
+
+func (s *server) update(uri, text string) error {
+	d := newDocument(uri, text)
+	s.docs[uri] = d
+	return s.notify("textDocument/publishDiagnostics",
+		publishDiagnosticsParams{URI: uri, Diagnostics: s.diagnostics(d)})
+}
+
+//diagnostics reports the scanning errors, or the parsing error if it scans,
+//and what the schema finds
+func (s *server) diagnostics(d *document) []diagnostic {
+	diags := []diagnostic{}
+	for _, e := range d.scanErrors {
+		end := e.Offset
+		for end < len(d.src) && d.src[end] != '\n' && d.src[end] != '\r' {
+			end++
+		}
+		diags = append(diags, diagnostic{Range: d.rangeOf(e.Offset, end),
+			Severity: severityError, Source: "fml", Message: e.Msg})
+	}
+	if len(diags) == 0 && d.parseErr != nil {
+		diag := diagnostic{Range: d.lineRange(1), Severity: severityError, Source: "fml", Message: d.parseErr.Error()}
+		if pe, ok := d.parseErr.(*fml.ParseError); ok {
+			diag.Range, diag.Message = d.lineRange(pe.Line), pe.Msg
+		}
+		diags = append(diags, diag)
+	}
+	if sc := s.schemaFor(d.uri); sc != nil {
+		diags = append(diags, sc.check(d)...)
+	}
+	return diags
+}
+
+func (s *server) positionParams(params json.RawMessage) (*document, int, error) {
+	var p textDocumentPositionParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, 0, err
+	}
+	d, ok := s.docs[p.TextDocument.URI]
+	if !ok {
+		return nil, 0, fmt.Errorf("document not open: %s", p.TextDocument.URI)
+	}
+	return d, d.offset(p.Position), nil
+}
+
+func (s *server) hover(params json.RawMessage) (interface{}, error) {
+	d, offset, err := s.positionParams(params)
+	if err != nil {
+		return nil, err
+	}
+	e := d.entryAt(offset)
+	if e == nil {
+		return nil, nil
+	}
+
+	var b strings.Builder
+	switch e.kind {
+	case keyEntry:
+		v, ok := d.value(e)
+		if !ok {
+			return nil, nil
+		}
+		fmt.Fprintf(&b, "**%s** `%s`\n\n```\n%s\n```", e.path, typeName(v), formatValue(e.path, v))
+	case nodeEntry:
+		v, ok := d.resolved(e.path)
+		t := typeName(v)
+		if !ok {
+			//the document doesn't parse, the source tells the kind
+			t = nodeType
+			if e.isList {
+				t = listType
+			}
+		}
+		fmt.Fprintf(&b, "**%s** `%s`", e.path, t)
+		if len(e.base) != 0 {
+			fmt.Fprintf(&b, ", inherits `%s`", e.base)
+		}
+		switch node := v.(type) {
+		case *fml.FML:
+			writeKeys(&b, node)
+		case []*fml.FML:
+			fmt.Fprintf(&b, "\n\n%d items", len(node))
+		}
+	case itemEntry:
+		fmt.Fprintf(&b, "**%s** `node list item`", e.path)
+	}
+	return hover{Contents: markupContent{Kind: "markdown", Value: b.String()},
+		Range: d.rangeOf(e.tok.Start, e.tok.End)}, nil
+}
+
+//writeKeys lists the keys of a resolved node, inherited ones included
+func writeKeys(b *strings.Builder, node *fml.FML) {
+	keys := node.KeySet()
+	if len(keys) == 0 {
+		return
+	}
+	sort.Strings(keys)
+	b.WriteString("\n\nkeys: ")
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("`" + k + "`")
+	}
+}
+
+//formatValue formats a value for hover, values of sensitive keys are masked
+func formatValue(path string, v interface{}) string {
+	if fml.DefaultRedactor.IsSensitive(path) {
+		return fml.DefaultMask
+	}
+	switch val := v.(type) {
+	case nil:
+		return "null"
+	case time.Time:
+		return val.Format(time.RFC3339)
+	case fml.Secret:
+		return "encrypted by " + val.Provider
+	}
+	return fmt.Sprint(v)
+}
+
+//definition goes from the base of a node, like base in [prod : base], to the base node
+func (s *server) definition(params json.RawMessage) (interface{}, error) {
+	d, offset, err := s.positionParams(params)
+	if err != nil {
+		return nil, err
+	}
+	e := d.entryAt(offset)
+	if e == nil || e.kind != nodeEntry || len(e.base) == 0 {
+		return nil, nil
+	}
+	colon := e.tok.Start + strings.IndexByte(string(d.src[e.tok.Start:e.tok.End]), ':')
+	if offset <= colon {
+		return nil, nil
+	}
+	base := d.findNode(e.base)
+	if base == nil {
+		return nil, nil
+	}
+	return []location{{URI: d.uri, Range: d.rangeOf(base.tok.Start, base.tok.End)}}, nil
+}
+
+func (s *server) documentSymbol(params json.RawMessage) (interface{}, error) {
+	var p documentSymbolParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	d, ok := s.docs[p.TextDocument.URI]
+	if !ok {
+		return nil, fmt.Errorf("document not open: %s", p.TextDocument.URI)
+	}
+	return symbols(d, d.root.children), nil
+}
+
+func symbols(d *document, entries []*entry) []documentSymbol {
+	syms := []documentSymbol{}
+	for _, e := range entries {
+		sym := documentSymbol{Name: e.name, Range: d.rangeOf(e.tok.Start, e.end),
+			SelectionRange: d.rangeOf(e.tok.Start, e.tok.End)}
+		switch e.kind {
+		case keyEntry:
+			sym.Kind = symbolField
+			sym.Detail = strings.TrimSpace(string(d.src[e.valueStart:e.valueEnd]))
+			if fml.DefaultRedactor.IsSensitive(e.path) {
+				sym.Detail = fml.DefaultMask
+			}
+		case nodeEntry:
+			sym.Kind = symbolNamespace
+			if e.isList {
+				sym.Kind = symbolArray
+			}
+			sym.Children = symbols(d, e.children)
+		case itemEntry:
+			sym.Kind = symbolObject
+			sym.Children = symbols(d, e.children)
+		}
+		syms = append(syms, sym)
+	}
+	return syms
+}
+
+//completion offers the keys of the schema missing in the node or list item at the line
+func (s *server) completion(params json.RawMessage) (interface{}, error) {
+	d, offset, err := s.positionParams(params)
+	if err != nil {
+		return nil, err
+	}
+	items := []completionItem{}
+	sc := s.schemaFor(d.uri)
+	if sc == nil {
+		return items, nil
+	}
+
+	container := d.lineContainers[d.position(offset).Line]
+	if container == nil {
+		container = d.root
+	}
+	path := schemaPath(container.path)
+	present := make(map[string]bool)
+	for _, e := range container.children {
+		present[schemaPath(e.name)] = true
+	}
+	for _, key := range sc.keys(path) {
+		if present[key] {
+			continue
+		}
+		items = append(items, completionItem{Label: key, Kind: completionField,
+			Detail: sc.types[containerKey(path, key)], InsertText: key + ": "})
+	}
+	return items, nil
+}
+
+//formatting replaces the whole document with the formatted one,
+//there are no edits if it is formatted already or fails to parse
+func (s *server) formatting(params json.RawMessage) (interface{}, error) {
+	var p documentFormattingParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	d, ok := s.docs[p.TextDocument.URI]
+	if !ok {
+		return nil, fmt.Errorf("document not open: %s", p.TextDocument.URI)
+	}
+	var opts []fml.FormatOption
+	if s.align {
+		opts = append(opts, fml.WithAlign())
+	}
+	out, err := fml.Format(d.src, opts...)
+	if err != nil || bytes.Equal(out, d.src) {
+		return []textEdit{}, nil
+	}
+	return []textEdit{{Range: d.rangeOf(0, len(d.src)), NewText: string(out)}}, nil
+}
+
+func containerKey(container, key string) string {
+	if len(container) == 0 {
+		return key
+	}
+	return container + "." + key
+}
+
+func uriToPath(uri string) string {
+	if !strings.HasPrefix(uri, "file://") {
+		return ""
+	}
+	path, err := url.PathUnescape(strings.TrimPrefix(uri, "file://"))
+	if err != nil {
+		return ""
+	}
+	return path
+}
@@ -0,0 +1,327 @@
+// Command fml is a helper for fml files.
+//
+// Usage:
+//
+//	fml keygen <keyfile>
+//	fml encrypt [-key keyfile] <file> <key>...
+//	fml decrypt [-key keyfile] <file> <key>...
+//	fml fmt [-align] [-width n] [-l] [-w] <file>...
+//	fml diff [-key name] [-profiles a,b] [-profile profile] <old> <new>
+//	fml patch <patchfile> <file>...
+//	fml convert [-from format] -to format [-datetimes] <file>
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/fipress/fml"
+)
+
+const defaultKeyFile = "fml.key"
+
+var errUsage = errors.New("invalid arguments")
+
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"keygen": {"keygen <keyfile>\n\tgenerate an AES key file", keygen},
+	"encrypt": {"encrypt [-key keyfile] <file> <key>...\n\tseal the values of the keys in place",
+		func(args []string) error { return seal(args, true) }},
+	"decrypt": {"decrypt [-key keyfile] <file> <key>...\n\topen the sealed values of the keys in place",
+		func(args []string) error { return seal(args, false) }},
+	"fmt": {"fmt [-align] [-width n] [-l] [-w] <file>...\n\tformat files, -l lists the unformatted ones and fails if any, -w rewrites them",
+		func(args []string) error { return format(args, os.Stdout) }},
+	"diff": {"diff [-key name] [-profiles a,b] [-profile profile] <old> <new>\n\tshow the changed keys, sensitive values masked",
+		func(args []string) error { return diff(args, os.Stdout) }},
+	"patch": {"patch <patchfile> <file>...\n\tapply the patch to the files in place, see fml.ParsePatch for the format", patch},
+	"convert": {"convert [-from format] -to format [-datetimes] <file>\n\tprint the file in another format, " + formatNames(),
+		func(args []string) error { return convert(args, os.Stdout) }},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+
+	err := cmd.run(os.Args[2:])
+	if err == errUsage {
+		fmt.Fprintln(os.Stderr, "usage: fml", cmd.usage)
+		os.Exit(2)
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, "fml:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "usage: fml <command> [arguments]")
+	for _, name := range names {
+		fmt.Fprintln(os.Stderr, "  fml", commands[name].usage)
+	}
+}
+
+func keygen(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	key, err := fml.GenerateAESKey()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(args[0], []byte(key+"\n"), 0600)
+}
+
+func seal(args []string, encrypt bool) error {
+	flags := flag.NewFlagSet("fml", flag.ContinueOnError)
+	keyFile := flags.String("key", defaultKeyFile, "the AES key file")
+	if err := flags.Parse(args); err != nil || flags.NArg() < 2 {
+		return errUsage
+	}
+
+	provider, err := fml.LoadAESKeyFile(*keyFile)
+	if err != nil {
+		return err
+	}
+	fml.RegisterSecretProvider("aes", provider)
+
+	path, keys := flags.Arg(0), flags.Args()[1:]
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var out []byte
+	if encrypt {
+		out, err = fml.SealValues(src, "aes", keys...)
+	} else {
+		out, err = fml.OpenValues(src, keys...)
+	}
+	if err != nil {
+		return err
+	}
+	return writeFile(path, out)
+}
+
+var errUnformatted = errors.New("some files are not formatted")
+
+// format prints the formatted files, or lists or rewrites the files not formatted
+func format(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("fml", flag.ContinueOnError)
+	align := flags.Bool("align", false, "align values in blocks")
+	width := flags.Int("width", 80, "wrap arrays longer than the width, 0 never wraps")
+	list := flags.Bool("l", false, "list the files not formatted")
+	write := flags.Bool("w", false, "rewrite the files not formatted")
+	if err := flags.Parse(args); err != nil || flags.NArg() == 0 {
+		return errUsage
+	}
+
+	opts := []fml.FormatOption{fml.WithLineWidth(*width)}
+	if *align {
+		opts = append(opts, fml.WithAlign())
+	}
+	unformatted := false
+	for _, path := range flags.Args() {
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		formatted, err := fml.Format(src, opts...)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+
+		changed := !bytes.Equal(src, formatted)
+		if *list && changed {
+			unformatted = true
+			fmt.Fprintln(out, path)
+		}
+		if *write && changed {
+			if err = writeFile(path, formatted); err != nil {
+				return err
+			}
+		}
+		if !*list && !*write {
+			out.Write(formatted)
+		}
+	}
+	if unformatted && !*write {
+		return errUnformatted
+	}
+	return nil
+}
+
+// diff prints the changes between two files, items of node lists are matched by the key if given
+func diff(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("fml", flag.ContinueOnError)
+	key := flags.String("key", "", "match items of node lists by the key instead of by index")
+	profiles := flags.String("profiles", "", "the known profiles, separated by commas")
+	profile := flags.String("profile", "", "the active profile of both files, one of the known profiles if they are given")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 2 {
+		return errUsage
+	}
+
+	var known []string
+	if len(*profiles) != 0 {
+		known = strings.Split(*profiles, ",")
+	}
+	old, err := fml.LoadWithProfile(flags.Arg(0), *profile, fml.WithProfiles(known...))
+	if err != nil {
+		return err
+	}
+	new, err := fml.LoadWithProfile(flags.Arg(1), *profile, fml.WithProfiles(known...))
+	if err != nil {
+		return err
+	}
+	var opts []fml.DiffOption
+	if len(*key) != 0 {
+		opts = append(opts, fml.WithIdentityKey(*key))
+	}
+	_, err = io.WriteString(out, fml.UnifiedDiff(fml.Diff(old, new, opts...), fml.DefaultRedactor))
+	return err
+}
+
+// patch applies a patch to each file, only the affected lines are rewritten
+func patch(args []string) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+	src, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	p, err := fml.ParsePatch(src)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range args[1:] {
+		if src, err = ioutil.ReadFile(path); err != nil {
+			return err
+		}
+		out, err := fml.PatchSource(src, p)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		if err = writeFile(path, out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// a fileFormat is a file format a document converts from and to
+type fileFormat struct {
+	decode func(src []byte, datetimes bool) (*fml.FML, error)
+	encode func(doc *fml.FML) ([]byte, error)
+}
+
+var formats = map[string]fileFormat{
+	"fml": {
+		func(src []byte, _ bool) (*fml.FML, error) { return fml.Parse(src) },
+		func(doc *fml.FML) ([]byte, error) { return fml.Marshal(doc) },
+	},
+	"json": {
+		func(src []byte, datetimes bool) (*fml.FML, error) {
+			if datetimes {
+				return fml.FromJSON(src, fml.WithDetectDatetimes())
+			}
+			return fml.FromJSON(src)
+		},
+		func(doc *fml.FML) ([]byte, error) {
+			out, err := fml.ToJSON(doc, "  ")
+			return append(out, '\n'), err
+		},
+	},
+	"yaml": {
+		func(src []byte, _ bool) (*fml.FML, error) { return fml.FromYAML(src) },
+		fml.ToYAML,
+	},
+	"toml": {
+		func(src []byte, _ bool) (*fml.FML, error) { return fml.FromTOML(src) },
+		(*fml.FML).ToTOML,
+	},
+}
+
+func formatNames() string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, " or ")
+}
+
+// convert prints a file in another format, the format of the file is got from its extension if not given
+func convert(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("fml", flag.ContinueOnError)
+	from := flags.String("from", "", "the format of the file, by its extension by default")
+	to := flags.String("to", "", "the format to convert to")
+	datetimes := flags.Bool("datetimes", false, "convert strings like RFC3339 datetimes to datetimes")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 || len(*to) == 0 {
+		return errUsage
+	}
+
+	path := flags.Arg(0)
+	if len(*from) == 0 {
+		*from = strings.TrimPrefix(filepath.Ext(path), ".")
+		if *from == "yml" {
+			*from = "yaml"
+		}
+		if _, ok := formats[*from]; !ok {
+			*from = "fml"
+		}
+	}
+	src, dst := formats[*from], formats[*to]
+	if src.decode == nil || dst.encode == nil {
+		return fmt.Errorf("unknown format, the formats are %s", formatNames())
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	doc, err := src.decode(data, *datetimes)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	if data, err = dst.encode(doc); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	_, err = out.Write(data)
+	return err
+}
+
+// writeFile rewrites a file keeping its permission
+func writeFile(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, info.Mode().Perm())
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fipress/fml"
+)
+
+func TestSeal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keyFile := filepath.Join(dir, "fml.key")
+	if err = keygen([]string{keyFile}); err != nil {
+		t.Fatal("Should generate key, err:", err)
+	}
+
+	input := `[database]
+host: localhost # the host
+password: "p@ss # word"
+`
+	path := filepath.Join(dir, "app.fml")
+	ioutil.WriteFile(path, []byte(input), 0600)
+
+	err = seal([]string{"-key", keyFile, path, "database.password"}, true)
+	if err != nil {
+		t.Fatal("Should encrypt, err:", err)
+	}
+	sealed, _ := ioutil.ReadFile(path)
+	if strings.Contains(string(sealed), "p@ss") || !strings.Contains(string(sealed), "host: localhost # the host\npassword: enc:aes:") {
+		t.Error("Should seal only the value, got:", string(sealed))
+	}
+
+	doc, err := fml.Load(path)
+	if err != nil || doc.GetString("database.password") != "p@ss # word" {
+		t.Error("Should decrypt transparently, err:", err)
+	}
+
+	err = seal([]string{"-key", keyFile, path, "database.password"}, false)
+	if err != nil {
+		t.Fatal("Should decrypt, err:", err)
+	}
+	opened, _ := ioutil.ReadFile(path)
+	if string(opened) != input {
+		t.Error("Should get the original file back, got:", string(opened))
+	}
+}
+
+func TestFormat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.fml")
+	ioutil.WriteFile(path, []byte("name:demo\n[db]\nhost :local # the host\n"), 0600)
+
+	var out bytes.Buffer
+	if err = format([]string{"-l", path}, &out); err != errUnformatted || out.String() != path+"\n" {
+		t.Error("Should list the unformatted file, got:", out.String(), err)
+	}
+	out.Reset()
+	if err = format([]string{"-align", "-w", path}, &out); err != nil || out.Len() != 0 {
+		t.Fatal("Should rewrite the file, err:", err)
+	}
+	formatted, _ := ioutil.ReadFile(path)
+	if string(formatted) != "name: demo\n[db]\nhost: local # the host\n" {
+		t.Error("Should format the file, got:", string(formatted))
+	}
+	if err = format([]string{"-l", path}, &out); err != nil || out.Len() != 0 {
+		t.Error("Should pass a formatted file, got:", out.String(), err)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	old, new := filepath.Join(dir, "old.fml"), filepath.Join(dir, "new.fml")
+	ioutil.WriteFile(old, []byte("[staff]\n- name: Abby\n  age: 12\n- name: Tony\n  age: 13\n"), 0600)
+	ioutil.WriteFile(new, []byte("[staff]\n- name: Tony\n  age: 13\n"), 0600)
+
+	var out bytes.Buffer
+	if err = diff([]string{"-key", "name", old, new}, &out); err != nil {
+		t.Fatal("Should diff, err:", err)
+	}
+	if out.String() != "- staff[name=Abby].age: 12\n- staff[name=Abby].name: Abby\n" {
+		t.Error("Should print the removed item, got:", out.String())
+	}
+
+	ioutil.WriteFile(new, []byte("[staff]\n- name: Abby\n  age: 12\n- name: Tony\n  age: 13\n  age@prod: 14\n"), 0600)
+	out.Reset()
+	if err = diff([]string{"-profiles", "dev,prod", "-profile", "prod", old, new}, &out); err != nil {
+		t.Fatal("Should diff, err:", err)
+	}
+	if out.String() != "- staff[1].age: 13\n+ staff[1].age: 14\n" {
+		t.Error("Should diff with the profile, got:", out.String())
+	}
+	out.Reset()
+	if err = diff([]string{"-profile", "prod", old, new}, &out); err != nil || out.String() != "- staff[1].age: 13\n+ staff[1].age: 14\n" {
+		t.Error("Should diff with the profile alone, got:", out.String(), err)
+	}
+	if err = diff([]string{"-profiles", "dev", "-profile", "prod", old, new}, &out); err == nil {
+		t.Error("Should fail for an unknown profile")
+	}
+}
+
+func TestPatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	patchFile, path := filepath.Join(dir, "bump.fml"), filepath.Join(dir, "app.fml")
+	ioutil.WriteFile(patchFile, []byte("[patch]\n- op: replace\n  path: database.port\n  value: 5432\n"), 0600)
+	ioutil.WriteFile(path, []byte("[database]\nhost: localhost # the host\nport: 1433 # the port\n"), 0600)
+
+	if err = patch([]string{patchFile, path}); err != nil {
+		t.Fatal("Should patch, err:", err)
+	}
+	patched, _ := ioutil.ReadFile(path)
+	if string(patched) != "[database]\nhost: localhost # the host\nport: 5432 # the port\n" {
+		t.Error("Should patch the value only, got:", string(patched))
+	}
+}
+
+func TestConvert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path, jsonPath := filepath.Join(dir, "app.fml"), filepath.Join(dir, "app.json")
+	ioutil.WriteFile(path, []byte("port: 8080\nwhen: 2014-07-06T12:00:00Z\n\n[staff]\n- name: Abby\n"), 0600)
+
+	var out bytes.Buffer
+	if err = convert([]string{"-to", "json", path}, &out); err != nil {
+		t.Fatal("Should convert to json, err:", err)
+	}
+	expected := `{
+  "port": 8080,
+  "staff": [
+    {
+      "name": "Abby"
+    }
+  ],
+  "when": "2014-07-06T12:00:00Z"
+}
+`
+	if out.String() != expected {
+		t.Error("Should print json, got:", out.String())
+	}
+
+	ioutil.WriteFile(jsonPath, out.Bytes(), 0600)
+	out.Reset()
+	if err = convert([]string{"-to", "fml", "-datetimes", jsonPath}, &out); err != nil {
+		t.Fatal("Should convert from json, err:", err)
+	}
+	doc, _ := fml.Parse(out.Bytes())
+	if _, err = doc.GetTimeOrError("when"); err != nil || doc.GetInt("port") != 8080 {
+		t.Error("Should convert back, got:", out.String())
+	}
+
+	ymlPath := filepath.Join(dir, "app.yml")
+	ioutil.WriteFile(ymlPath, []byte("port: 8080\nstaff:\n  - name: Abby\n"), 0600)
+	out.Reset()
+	if err = convert([]string{"-to", "fml", ymlPath}, &out); err != nil {
+		t.Fatal("Should convert from yaml, err:", err)
+	}
+	doc, _ = fml.Parse(out.Bytes())
+	if staff, _ := doc.GetNodeList("staff"); doc.GetInt("port") != 8080 || len(staff) != 1 || staff[0].GetString("name") != "Abby" {
+		t.Error("Should convert yaml by the extension, got:", out.String())
+	}
+
+	tomlPath := filepath.Join(dir, "app.toml")
+	ioutil.WriteFile(tomlPath, []byte("hosts = []\n"), 0600)
+	out.Reset()
+	if err = convert([]string{"-to", "fml", tomlPath}, &out); err != nil {
+		t.Fatal("Should convert from toml, err:", err)
+	}
+	if doc, err = fml.Parse(out.Bytes()); err != nil || !doc.Has("hosts") {
+		t.Error("Should convert empty arrays to fml that parses, got:", out.String(), err)
+	}
+
+	out.Reset()
+	if err = convert([]string{"-to", "toml", path}, &out); err != nil {
+		t.Fatal("Should convert to toml, err:", err)
+	}
+	if out.String() != "port = 8080\nwhen = 2014-07-06T12:00:00Z\n\n[[staff]]\nname = \"Abby\"\n" {
+		t.Error("Should print toml, got:", out.String())
+	}
+
+	if err = convert([]string{"-to", "xml", path}, &out); err == nil {
+		t.Error("Should fail for unknown formats")
+	}
+	if err = convert([]string{path}, &out); err != errUsage {
+		t.Error("Should require the format to convert to, got:", err)
+	}
+}
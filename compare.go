@@ -0,0 +1,253 @@
+package fml
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// Clone makes a deep copy of the node, the copy shares no nodes, node lists or arrays with it.
+func (f *FML) Clone() *FML {
+	if f == nil {
+		return nil
+	}
+	f.rlock()
+	defer f.runlock()
+	return cloneValue(f).(*FML)
+}
+
+// EqualOptions controls how documents are compared.
+type EqualOptions struct {
+	// IgnoreListOrder compares node lists regardless of the order of their items.
+	IgnoreListOrder bool
+}
+
+// An EqualOption sets an option of Equal.
+type EqualOption func(*EqualOptions)
+
+// WithIgnoreListOrder compares node lists regardless of the order of their items.
+func WithIgnoreListOrder() EqualOption {
+	return func(o *EqualOptions) {
+		o.IgnoreListOrder = true
+	}
+}
+
+// Equal reports whether two nodes have the same keys with the same values.
+// Values of different types are not equal, like 1 and 1.0, times are equal at the same instant
+// whatever their locations, and NaN is equal to NaN.
+func Equal(a, b *FML, opts ...EqualOption) bool {
+	o := &EqualOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return equalNode(a, b, o.IgnoreListOrder)
+}
+
+//equalValue compares values like Equal, node lists regardless of their order if unordered
+func equalValue(a, b interface{}, unordered bool) bool {
+	switch x := a.(type) {
+	case float64:
+		y, ok := b.(float64)
+		return ok && equalFloat(x, y)
+	case time.Time:
+		y, ok := b.(time.Time)
+		return ok && x.Equal(y)
+	case []float64:
+		y, ok := b.([]float64)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equalFloat(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case []time.Time:
+		y, ok := b.([]time.Time)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !x[i].Equal(y[i]) {
+				return false
+			}
+		}
+		return true
+	case *FML:
+		y, ok := b.(*FML)
+		return ok && equalNode(x, y, unordered)
+	case []*FML:
+		y, ok := b.([]*FML)
+		return ok && equalList(x, y, unordered)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func equalFloat(x, y float64) bool {
+	return x == y || math.IsNaN(x) && math.IsNaN(y)
+}
+
+func equalNode(a, b *FML, unordered bool) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if len(a.dict) != len(b.dict) {
+		return false
+	}
+	for k, v := range a.dict {
+		w, ok := b.dict[k]
+		if !ok || !equalValue(v, w, unordered) {
+			return false
+		}
+	}
+	return true
+}
+
+func equalList(a, b []*FML, unordered bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	if !unordered {
+		for i := range a {
+			if !equalNode(a[i], b[i], false) {
+				return false
+			}
+		}
+		return true
+	}
+
+	//each item matches an item not matched yet
+	matched := make([]bool, len(b))
+	for _, x := range a {
+		found := false
+		for j, y := range b {
+			if !matched[j] && equalNode(x, y, true) {
+				matched[j], found = true, true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Hash returns a SHA-256 hash of the content of the node in hex, the same for equal nodes
+// whatever the order of their keys or the format of their source, so it tells whether the content changed.
+func (f *FML) Hash() string {
+	f.rlock()
+	defer f.runlock()
+	h := sha256.New()
+	hashValue(h, f)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+//the types of values in hashes, so values of different types hash differently
+const (
+	tagNull byte = iota
+	tagString
+	tagInt
+	tagFloat
+	tagBool
+	tagTime
+	tagSecret
+	tagArray
+	tagNode
+	tagList
+)
+
+func hashValue(h hash.Hash, val interface{}) {
+	switch v := val.(type) {
+	case nil:
+		h.Write([]byte{tagNull})
+	case string:
+		h.Write([]byte{tagString})
+		hashString(h, v)
+	case int:
+		h.Write([]byte{tagInt})
+		hashUint(h, uint64(v))
+	case float64:
+		h.Write([]byte{tagFloat})
+		hashFloat(h, v)
+	case bool:
+		h.Write([]byte{tagBool})
+		if v {
+			h.Write([]byte{1})
+		} else {
+			h.Write([]byte{0})
+		}
+	case time.Time:
+		h.Write([]byte{tagTime})
+		hashTime(h, v)
+	case Secret:
+		h.Write([]byte{tagSecret})
+		hashString(h, v.Provider)
+		hashString(h, v.Ciphertext)
+	case []string, []int, []float64, []bool, []time.Time:
+		rv := reflect.ValueOf(v)
+		h.Write([]byte{tagArray})
+		hashUint(h, uint64(rv.Len()))
+		for i := 0; i < rv.Len(); i++ {
+			hashValue(h, rv.Index(i).Interface())
+		}
+	case *FML:
+		if v == nil {
+			h.Write([]byte{tagNull})
+			return
+		}
+		h.Write([]byte{tagNode})
+		keys := v.keys()
+		sort.Strings(keys)
+		hashUint(h, uint64(len(keys)))
+		for _, k := range keys {
+			hashString(h, k)
+			hashValue(h, v.dict[k])
+		}
+	case []*FML:
+		h.Write([]byte{tagList})
+		hashUint(h, uint64(len(v)))
+		for _, item := range v {
+			hashValue(h, item)
+		}
+	default:
+		//values set by SetValue of other types
+		h.Write([]byte{tagString})
+		hashString(h, reflect.TypeOf(v).String()+":"+wrapVal(v))
+	}
+}
+
+func hashUint(h hash.Hash, n uint64) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], n)
+	h.Write(buf[:])
+}
+
+//hashString writes the length before the string, so the end of one string can't be the start of the next
+func hashString(h hash.Hash, s string) {
+	hashUint(h, uint64(len(s)))
+	h.Write([]byte(s))
+}
+
+//hashFloat hashes equal floats the same, 0 and -0, and all NaNs
+func hashFloat(h hash.Hash, f float64) {
+	switch {
+	case f == 0:
+		f = 0
+	case math.IsNaN(f):
+		f = math.NaN()
+	}
+	hashUint(h, math.Float64bits(f))
+}
+
+//hashTime hashes times at the same instant the same
+func hashTime(h hash.Hash, t time.Time) {
+	hashUint(h, uint64(t.Unix()))
+	hashUint(h, uint64(t.Nanosecond()))
+}
@@ -0,0 +1,85 @@
+package fml
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestClone(t *testing.T) {
+	doc, _ := ParseString("tags: [a, b]\n\n[db]\nhost: local\n\n[staff]\n- name: Abby\n")
+	clone := doc.Clone()
+	if !Equal(doc, clone) {
+		t.Fatal("Should clone equal, got:", clone)
+	}
+
+	clone.SetValue("tags", nil)
+	db, _ := clone.GetNode("db")
+	db.SetValue("host", "remote")
+	staff, _ := clone.GetNodeList("staff")
+	staff[0].SetValue("name", "Tony")
+	tags, _ := doc.GetStringArrayOrError("tags")
+	if len(tags) != 2 || doc.GetString("db.host") != "local" || Equal(doc, clone) {
+		t.Error("Should share nothing with the clone, got:", doc)
+	}
+	list, _ := doc.GetNodeList("staff")
+	if list[0].GetString("name") != "Abby" {
+		t.Error("Should not change items, got:", list[0])
+	}
+	if (*FML)(nil).Clone() != nil {
+		t.Error("Should clone nil to nil")
+	}
+}
+
+func TestEqual(t *testing.T) {
+	a, _ := ParseString("a: 1\nb: 2014-07-06T12:00:00+08:00\n\n[l]\n- n: 1\n- n: 2\n")
+	b, _ := ParseString("b: 2014-07-06T04:00:00Z\na: 1\n\n[l]\n- n: 2\n- n: 1\n")
+	if Equal(a, b) {
+		t.Error("Should compare list items in order")
+	}
+	if !Equal(a, b, WithIgnoreListOrder()) {
+		t.Error("Should ignore the order of items")
+	}
+
+	c, _ := ParseString("a: 1.0\n\n[l]\n- n: 1\n- n: 2\n")
+	if Equal(a, c, WithIgnoreListOrder()) {
+		t.Error("Should tell types apart")
+	}
+	nan := NewFml()
+	nan.SetValue("x", math.NaN())
+	if !Equal(nan, nan.Clone()) {
+		t.Error("Should find NaN equal to NaN")
+	}
+}
+
+func TestHash(t *testing.T) {
+	a, _ := ParseString("a: 1\nb: [x, y]\n\n[db]\nhost: local\nwhen: 2014-07-06T12:00:00+08:00\n")
+	b, _ := ParseString("[db]\nwhen:2014-07-06T04:00:00Z\nhost:   local # the host\n\n[top]\n")
+	b.RemoveItem("top")
+	b.SetValue("b", []string{"x", "y"})
+	b.SetValue("a", 1)
+	if a.Hash() != b.Hash() || len(a.Hash()) != 64 {
+		t.Error("Should hash the content only, got:", a.Hash(), b.Hash())
+	}
+
+	for _, change := range []func(doc *FML){
+		func(doc *FML) { doc.SetValue("a", 1.0) },
+		func(doc *FML) { doc.SetValue("a", "1") },
+		func(doc *FML) { doc.SetValue("b", []string{"xy"}) },
+		func(doc *FML) { doc.SetValue("c", nil) },
+		func(doc *FML) { doc.SetValue("a", time.Unix(1, 0)) },
+	} {
+		c := a.Clone()
+		change(c)
+		if c.Hash() == a.Hash() {
+			t.Error("Should hash a different content differently, got:", c)
+		}
+	}
+
+	zero, negZero := NewFml(), NewFml()
+	zero.SetValue("f", 0.0)
+	negZero.SetValue("f", math.Copysign(0, -1))
+	if zero.Hash() != negZero.Hash() {
+		t.Error("Should hash equal floats the same")
+	}
+}
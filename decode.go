@@ -1,21 +1,32 @@
 package fml
 
+import "io/ioutil"
+
+// Unmarshal parses the data, and stores the result in the struct, the map or the interface{} v points to.
+// An interface{} or a map[string]interface{} gets natural Go types like ToMap.
 func Unmarshal(data []byte, v interface{}) (err error) {
-	node, err := Parse(data)
+	return UnmarshalWithOptions(data, v)
+}
+
+// UnmarshalWithOptions parses the data with the parsing options, and stores the result in v like Unmarshal.
+// The fields are checked by their tags, see FieldError.
+func UnmarshalWithOptions(data []byte, v interface{}, opts ...Option) (err error) {
+	node, spans, starts, err := parseSource(data, opts...)
 	if err != nil {
 		return
 	}
 
-	return getStruct(node, v)
+	d := &decoder{input: data, spans: spans, starts: starts}
+	return d.decodeStruct(node, v, "")
 }
 
 func UnmarshalFile(path string, v interface{}) (err error) {
-	node, err := Load(path)
+	data, err := ioutil.ReadFile(path)
 	if err != nil {
 		return
 	}
 
-	return getStruct(node, v)
+	return Unmarshal(data, v)
 }
 
 func UnmarshalString(input string, v interface{}) (err error) {
@@ -17,3 +17,24 @@ Age=15`
 	t.Log(s.Name)
 	t.Log(s.Age)
 }
+
+func TestUnmarshalNull(t *testing.T) {
+	type Account struct {
+		Name  *string
+		Quota *int
+	}
+
+	input := `name=Jimmy
+quota=null`
+	a := &Account{Quota: new(int)}
+	err := UnmarshalString(input, a)
+	if err != nil {
+		t.Error("Unmarshal failed:", err)
+	}
+	if a.Name == nil || *a.Name != "Jimmy" {
+		t.Error("Should set name pointer")
+	}
+	if a.Quota != nil {
+		t.Error("Null should set pointer to nil")
+	}
+}
@@ -0,0 +1,263 @@
+package fml
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ChangeKind is what happened to a key between two documents.
+type ChangeKind int
+
+const (
+	// Added is a key only in the new document.
+	Added ChangeKind = iota
+	// Removed is a key only in the old document.
+	Removed
+	// Modified is a key with different values in the documents.
+	Modified
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Modified:
+		return "modified"
+	}
+	return "unknown"
+}
+
+// A Change is a difference between two documents.
+type Change struct {
+	Kind ChangeKind
+	// Path is the key path, like "database.port", with items of node lists like "staff[1].age",
+	// or "staff[name=Abby].age" if they are matched by an identity key.
+	Path string
+	// Old is the value in the old document, nil if added.
+	Old interface{}
+	// New is the value in the new document, nil if removed.
+	New interface{}
+}
+
+// String returns the change like "modified database.port: 1433 -> 5432", on a single line,
+// values found sensitive by DefaultRedactor are masked.
+func (c Change) String() string {
+	r := DefaultRedactor
+	switch c.Kind {
+	case Added:
+		return c.Kind.String() + " " + c.Path + ": " + r.redactInline(c.Path, c.New)
+	case Removed:
+		return c.Kind.String() + " " + c.Path + ": " + r.redactInline(c.Path, c.Old)
+	}
+	return c.Kind.String() + " " + c.Path + ": " + r.redactInline(c.Path, c.Old) + " -> " + r.redactInline(c.Path, c.New)
+}
+
+// DiffOptions controls how documents are compared.
+type DiffOptions struct {
+	// IdentityKey matches items of node lists by the value of the key instead of by index,
+	// if all the items have distinct values of it.
+	IdentityKey string
+}
+
+// A DiffOption sets a diff option.
+type DiffOption func(*DiffOptions)
+
+// WithIdentityKey matches items of node lists by the value of the key, like "name", instead of by index.
+func WithIdentityKey(key string) DiffOption {
+	return func(o *DiffOptions) {
+		o.IdentityKey = key
+	}
+}
+
+// Diff compares two documents by key, nodes and node lists are compared key by key.
+// The changes are ordered by key, a node or a node list only in one document is a single change.
+func Diff(a, b *FML, opts ...DiffOption) []Change {
+	o := &DiffOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	d := &differ{opts: o}
+	d.diffNode("", a, b)
+	return d.changes
+}
+
+type differ struct {
+	opts    *DiffOptions
+	changes []Change
+}
+
+func (d *differ) add(kind ChangeKind, path string, old, new interface{}) {
+	d.changes = append(d.changes, Change{Kind: kind, Path: path, Old: old, New: new})
+}
+
+func (d *differ) diffNode(path string, a, b *FML) {
+	keys := make([]string, 0, len(a.dict)+len(b.dict))
+	for k := range a.dict {
+		keys = append(keys, k)
+	}
+	for k := range b.dict {
+		if _, ok := a.dict[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		old, inA := a.dict[k]
+		new, inB := b.dict[k]
+		d.diffValue(joinPath(path, k), old, new, inA, inB)
+	}
+}
+
+func (d *differ) diffValue(path string, old, new interface{}, inA, inB bool) {
+	switch {
+	case !inA:
+		d.add(Added, path, nil, new)
+	case !inB:
+		d.add(Removed, path, old, nil)
+	default:
+		switch oldVal := old.(type) {
+		case *FML:
+			if newVal, ok := new.(*FML); ok {
+				d.diffNode(path, oldVal, newVal)
+				return
+			}
+		case []*FML:
+			if newVal, ok := new.([]*FML); ok {
+				d.diffList(path, oldVal, newVal)
+				return
+			}
+		}
+		if !equalValue(old, new, false) {
+			d.add(Modified, path, old, new)
+		}
+	}
+}
+
+func (d *differ) diffList(path string, a, b []*FML) {
+	aIDs, bIDs := d.identities(a), d.identities(b)
+	if aIDs == nil || bIDs == nil {
+		for i := 0; i < len(a) || i < len(b); i++ {
+			itemPath := path + "[" + strconv.Itoa(i) + "]"
+			switch {
+			case i >= len(a):
+				d.add(Added, itemPath, nil, b[i])
+			case i >= len(b):
+				d.add(Removed, itemPath, a[i], nil)
+			default:
+				d.diffNode(itemPath, a[i], b[i])
+			}
+		}
+		return
+	}
+
+	inB := make(map[string]*FML, len(b))
+	for i, id := range bIDs {
+		inB[id] = b[i]
+	}
+	inA := make(map[string]*FML, len(a))
+	for i, id := range aIDs {
+		inA[id] = a[i]
+		if _, ok := inB[id]; !ok {
+			d.add(Removed, path+"["+id+"]", a[i], nil)
+		}
+	}
+	for i, id := range bIDs {
+		if old, ok := inA[id]; ok {
+			d.diffNode(path+"["+id+"]", old, b[i])
+		} else {
+			d.add(Added, path+"["+id+"]", nil, b[i])
+		}
+	}
+}
+
+//identities gets the selectors of the items by the identity key, like "name=Abby",
+//nil if any item lacks a scalar value of it or two items share one
+func (d *differ) identities(list []*FML) []string {
+	key := d.opts.IdentityKey
+	if len(key) == 0 {
+		return nil
+	}
+	ids := make([]string, len(list))
+	seen := make(map[string]bool, len(list))
+	for i, item := range list {
+		v, ok := item.dict[item.normalizeKey(key)]
+		if !ok || !isScalar(v) {
+			return nil
+		}
+		ids[i] = key + "=" + selectorValue(v)
+		if seen[ids[i]] {
+			return nil
+		}
+		seen[ids[i]] = true
+	}
+	return ids
+}
+
+func isScalar(v interface{}) bool {
+	switch v.(type) {
+	case string, int, float64, bool, time.Time:
+		return true
+	}
+	return false
+}
+
+//selectorValue writes the value of an identity key in a path, quoted if needed
+func selectorValue(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return wrapArrayString(s)
+	}
+	return wrapVal(v)
+}
+
+func joinPath(path, key string) string {
+	if len(path) == 0 {
+		return key
+	}
+	return path + "." + key
+}
+
+// UnifiedDiff renders the changes a line a value, "-" for old values and "+" for new ones:
+//
+//	- database.port: 1433
+//	+ database.port: 5432
+//	+ staff[2].name: Tony
+//
+// Nodes and node lists are rendered key by key, multiple line strings are quoted, so each value takes a line.
+// Sensitive values are masked if the redactor is not nil.
+func UnifiedDiff(changes []Change, r *Redactor) string {
+	var b strings.Builder
+	for _, c := range changes {
+		if c.Kind != Added {
+			writeDiffLines(&b, "- ", c.Path, c.Old, r)
+		}
+		if c.Kind != Removed {
+			writeDiffLines(&b, "+ ", c.Path, c.New, r)
+		}
+	}
+	return b.String()
+}
+
+func writeDiffLines(b *strings.Builder, prefix, path string, val interface{}, r *Redactor) {
+	switch v := val.(type) {
+	case *FML:
+		keys := v.KeySet()
+		sort.Strings(keys)
+		if len(keys) == 0 {
+			b.WriteString(prefix + "[" + path + "]\n")
+		}
+		for _, k := range keys {
+			writeDiffLines(b, prefix, joinPath(path, k), v.dict[k], r)
+		}
+	case []*FML:
+		for i, item := range v {
+			writeDiffLines(b, prefix, path+"["+strconv.Itoa(i)+"]", item, r)
+		}
+	default:
+		b.WriteString(prefix + path + ": " + r.redactInline(path, val) + "\n")
+	}
+}
@@ -0,0 +1,83 @@
+package fml
+
+import (
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	a, _ := ParseString(`name: demo
+port: 1433
+password: old
+tags: [a, b]
+
+[db]
+host: localhost
+
+[staff]
+- name: Abby
+  age: 12
+- name: Tony
+  age: 13
+`)
+	b, _ := ParseString(`name: demo
+port: 5432
+password: new
+tags: [a, b]
+debug: true
+
+[staff]
+- name: Tony
+  age: 14
+`)
+
+	changes := Diff(a, b)
+	expected := []string{
+		"removed db",
+		"added debug",
+		"modified password",
+		"modified port",
+		"modified staff[0].age",
+		"modified staff[0].name",
+		"removed staff[1]",
+	}
+	if len(changes) != len(expected) {
+		t.Fatal("Should diff by index, got:", changes)
+	}
+	for i, c := range changes {
+		if c.Kind.String()+" "+c.Path != expected[i] {
+			t.Error("Should get change", expected[i], "got:", c)
+		}
+	}
+	if changes[4].Old != 12 || changes[4].New != 14 || changes[5].String() != "modified staff[0].name: Abby -> Tony" {
+		t.Error("Should keep typed values, got:", changes[4], changes[5])
+	}
+	if changes[2].String() != "modified password: ****** -> ******" {
+		t.Error("Should mask sensitive values, got:", changes[2])
+	}
+
+	changes = Diff(a, b, WithIdentityKey("name"))
+	if len(changes) != 6 || changes[4].Path != "staff[name=Abby]" || changes[4].Kind != Removed ||
+		changes[5].Path != "staff[name=Tony].age" || changes[5].Old != 13 || changes[5].New != 14 {
+		t.Error("Should match items by the identity key, got:", changes)
+	}
+
+	unified := UnifiedDiff(changes[3:], DefaultRedactor)
+	if unified != "- port: 1433\n+ port: 5432\n- staff[name=Abby].age: 12\n- staff[name=Abby].name: Abby\n"+
+		"- staff[name=Tony].age: 13\n+ staff[name=Tony].age: 14\n" {
+		t.Error("Should render unified diff, got:", unified)
+	}
+
+	if changes = Diff(a, a); len(changes) != 0 {
+		t.Error("Should find no change, got:", changes)
+	}
+
+	a, _ = ParseString("sql: |-\n  SELECT *\n  FROM t\n")
+	b, _ = ParseString("sql: |-\n  SELECT *\n  FROM u\n")
+	changes = Diff(a, b)
+	if unified = UnifiedDiff(changes, nil); unified != "- sql: \"SELECT *\\nFROM t\"\n+ sql: \"SELECT *\\nFROM u\"\n" {
+		t.Error("Should render multiple line values on a line, got:", unified)
+	}
+	if s := changes[0].String(); s != `modified sql: "SELECT *\nFROM t" -> "SELECT *\nFROM u"` {
+		t.Error("Should print multiple line values on a line, got:", s)
+	}
+}
@@ -1 +1,257 @@
 package fml
+
+import (
+	"bufio"
+	"bytes"
+	"encoding"
+	"errors"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+var (
+	errMarshalType  = errors.New("marshal fml failed: unsupported type")
+	errMarshalValue = errors.New("marshal fml failed: invalid value")
+
+	nodeType          = reflect.TypeOf((*FML)(nil))
+	nodeListType      = reflect.TypeOf([]*FML(nil))
+	secretType        = reflect.TypeOf(Secret{})
+	marshalerType     = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// Marshal encodes a struct, a map from string or a *FML as a fml document.
+// Fields are named by their fml tags or their names, fields tagged "-" and unexported fields are skipped,
+// and fields of embedded structs are promoted. Nil pointers are null, slices are arrays or node lists,
+// time.Duration is a string like "1m30s", and types implementing Marshaler or encoding.TextMarshaler
+// are encoded by them. Keys are written in order.
+func Marshal(v interface{}) ([]byte, error) {
+	node, err := ToNode(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	writer := bufio.NewWriter(&b)
+	node.WriteTo(writer)
+	err = writer.Flush()
+	return b.Bytes(), err
+}
+
+// ToNode encodes a struct, a map from string or a *FML as a node like Marshal.
+func ToNode(v interface{}) (*FML, error) {
+	val, err := encodeValue(reflect.ValueOf(v))
+	if err != nil {
+		return nil, err
+	}
+	node, ok := val.(*FML)
+	if !ok || node == nil {
+		return nil, errMarshalType
+	}
+	return node, nil
+}
+
+//encodeValue encodes a value as a fml value
+func encodeValue(rv reflect.Value) (interface{}, error) {
+	if !rv.IsValid() {
+		return nil, nil
+	}
+	t := rv.Type()
+	switch {
+	case (rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface) && rv.IsNil():
+		return nil, nil
+	case t.Implements(marshalerType) || rv.CanAddr() && reflect.PtrTo(t).Implements(marshalerType):
+		if !t.Implements(marshalerType) {
+			rv = rv.Addr()
+		}
+		val, err := rv.Interface().(Marshaler).MarshalFML()
+		if err != nil {
+			return nil, err
+		}
+		if !isValue(val) {
+			return nil, errMarshalValue
+		}
+		return val, nil
+	case t == timeType || t == secretType:
+		return rv.Interface(), nil
+	case t == nodeType || t == nodeListType:
+		return cloneValue(rv.Interface()), nil
+	case t == durationType:
+		return time.Duration(rv.Int()).String(), nil
+	case t.Implements(textMarshalerType) || rv.CanAddr() && reflect.PtrTo(t).Implements(textMarshalerType):
+		if !t.Implements(textMarshalerType) {
+			rv = rv.Addr()
+		}
+		text, err := rv.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(text), err
+	}
+
+	switch rv.Kind() {
+	case reflect.Ptr:
+		return encodeValue(rv.Elem())
+	case reflect.Interface:
+		val, err := encodeValue(rv.Elem())
+		//the discriminator of a variant, to decode it back
+		if node, ok := val.(*FML); ok && err == nil && getVariants(t) != nil {
+			vs := getVariants(t)
+			if id, ok := vs.valueOf(rv.Elem().Type()); ok {
+				node.dict[vs.key] = id
+			}
+		}
+		return val, err
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Bool:
+		return rv.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := rv.Int()
+		if i < math.MinInt || i > math.MaxInt {
+			return nil, errOutOfRange
+		}
+		return int(i), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := rv.Uint()
+		if u > math.MaxInt {
+			return nil, errOutOfRange
+		}
+		return int(u), nil
+	case reflect.Float32:
+		//the shortest decimal of the float32, not the float64 it widens to
+		fl, _ := strconv.ParseFloat(strconv.FormatFloat(rv.Float(), 'g', -1, 32), 64)
+		return fl, nil
+	case reflect.Float64:
+		return rv.Float(), nil
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return nil, nil
+		}
+		return encodeSlice(rv)
+	case reflect.Map:
+		return encodeMap(rv)
+	case reflect.Struct:
+		node := NewFml()
+		return node, encodeStruct(node, rv)
+	}
+	return nil, errMarshalType
+}
+
+//encodeSlice encodes a slice as an array if its items are values of the same type, or a node list
+func encodeSlice(rv reflect.Value) (interface{}, error) {
+	items := make([]interface{}, rv.Len())
+	for i := range items {
+		item, err := encodeValue(rv.Index(i))
+		if err != nil {
+			return nil, err
+		}
+		items[i] = item
+	}
+	if len(items) == 0 {
+		return []string{}, nil
+	}
+
+	switch items[0].(type) {
+	case string:
+		return makeArray(items, []string{})
+	case int:
+		return makeArray(items, []int{})
+	case float64:
+		return makeArray(items, []float64{})
+	case bool:
+		return makeArray(items, []bool{})
+	case time.Time:
+		return makeArray(items, []time.Time{})
+	case *FML:
+		return makeArray(items, []*FML{})
+	}
+	return nil, errMarshalType
+}
+
+//typedArray converts converted items to a typed array, or a node list if they are nodes.
+//Ints are promoted to float64 if any item is a float64, as text formats don't tell them apart.
+func typedArray(items []interface{}) (interface{}, error) {
+	floats := false
+	for _, item := range items {
+		if _, ok := item.(float64); ok {
+			floats = true
+		}
+	}
+	if floats {
+		for i, item := range items {
+			if n, ok := item.(int); ok {
+				items[i] = float64(n)
+			}
+		}
+	}
+	return encodeSlice(reflect.ValueOf(items))
+}
+
+//makeArray appends the items to the typed array, all of them must have its item type
+func makeArray(items []interface{}, array interface{}) (interface{}, error) {
+	arr := reflect.ValueOf(array)
+	itemType := arr.Type().Elem()
+	for _, item := range items {
+		if item == nil || reflect.TypeOf(item) != itemType {
+			return nil, errMarshalType
+		}
+		arr = reflect.Append(arr, reflect.ValueOf(item))
+	}
+	return arr.Interface(), nil
+}
+
+func encodeMap(rv reflect.Value) (interface{}, error) {
+	if rv.Type().Key().Kind() != reflect.String {
+		return nil, errMarshalType
+	}
+	node := NewFml()
+	iter := rv.MapRange()
+	for iter.Next() {
+		val, err := encodeValue(iter.Value())
+		if err != nil {
+			return nil, err
+		}
+		node.dict[iter.Key().String()] = val
+	}
+	return node, nil
+}
+
+//encodeStruct encodes the fields of a struct into the node, fields of embedded structs are promoted
+func encodeStruct(node *FML, rv reflect.Value) error {
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _ := parseTag(f.Tag.Get("fml"))
+		if name == "-" {
+			continue
+		}
+		field := rv.Field(i)
+		//exported fields of unexported embedded structs are promoted too
+		if f.Anonymous && len(name) == 0 {
+			if field.Kind() == reflect.Ptr {
+				if field.IsNil() {
+					continue
+				}
+				field = field.Elem()
+			}
+			if field.Kind() == reflect.Struct && field.Type() != timeType {
+				if err := encodeStruct(node, field); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if len(name) == 0 {
+			name = f.Name
+		}
+		val, err := encodeValue(field)
+		if err != nil {
+			return err
+		}
+		node.dict[name] = val
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package fml
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMarshal(t *testing.T) {
+	type Base struct {
+		ID int `fml:"id"`
+	}
+	type Staff struct {
+		Name string `fml:"name"`
+		Age  uint8  `fml:"age"`
+	}
+	type config struct {
+		Base
+		Name     string        `fml:"name"`
+		Ratio    float32       `fml:"ratio"`
+		Timeout  time.Duration `fml:"timeout"`
+		Tags     []string      `fml:"tags"`
+		IP       net.IP        `fml:"ip"`
+		Level    level         `fml:"level"`
+		Primary  endpoint      `fml:"primary"`
+		Staff    []Staff       `fml:"staff"`
+		Limits   map[string]int
+		Nickname *string `fml:"nickname"`
+		Ignored  string  `fml:"-"`
+		private  string
+	}
+	c := config{Base{7}, "app", 0.1, 90 * time.Second, []string{"a", "b"}, net.IPv4(10, 0, 0, 1), 1,
+		endpoint{"db1", 5432}, []Staff{{"Abby", 20}, {"Tony", 30}}, map[string]int{"cpu": 2}, nil, "x", "y"}
+
+	out, err := Marshal(c)
+	if err != nil {
+		t.Fatal("Marshal failed:", err)
+	}
+	doc, err := Parse(out)
+	if err != nil {
+		t.Fatal("Should parse the output, got:", err, string(out))
+	}
+
+	expected := map[string]interface{}{
+		"id": 7, "name": "app", "ratio": 0.1, "timeout": "1m30s", "tags": []string{"a", "b"},
+		"ip": "10.0.0.1", "level": "info", "primary": "db1:5432", "Limits.cpu": 2, "staff": nil, "nickname": nil,
+	}
+	for k, v := range expected {
+		if got, ok := doc.Lookup(k); !ok || (v != nil && !reflect.DeepEqual(got, v)) {
+			t.Error("Should encode", k, "as", v, "got:", got)
+		}
+	}
+	if doc.Has("Ignored") || doc.Has("private") {
+		t.Error("Should skip ignored and unexported fields")
+	}
+
+	var back config
+	if err = Unmarshal(out, &back); err != nil {
+		t.Fatal("Unmarshal failed:", err)
+	}
+	if back.ID != 7 || back.Timeout != c.Timeout || back.Level != 1 || !back.IP.Equal(c.IP) || back.Primary != c.Primary {
+		t.Error("Should decode the output, got:", back)
+	}
+
+	again, _ := Marshal(c)
+	if string(again) != string(out) {
+		t.Error("Should write keys in order, got:", string(out), string(again))
+	}
+
+	if _, err = Marshal(42); err != errMarshalType {
+		t.Error("Should fail for non-node values, got:", err)
+	}
+	if _, err = Marshal(map[string]interface{}{"c": make(chan int)}); err != errMarshalType {
+		t.Error("Should fail for unsupported types, got:", err)
+	}
+	if _, err = Marshal(map[string]interface{}{"a": []interface{}{1, "x"}}); err != errMarshalType {
+		t.Error("Should fail for mixed arrays, got:", err)
+	}
+}
+
+func TestMarshalEmptySlices(t *testing.T) {
+	type lists struct {
+		Nil    []string `fml:"nil"`
+		Empty  []string `fml:"empty"`
+		Ints   []int    `fml:"ints"`
+		Floats []float64
+	}
+	c := lists{Empty: []string{}, Ints: []int{}}
+
+	out, err := Marshal(c)
+	if err != nil {
+		t.Fatal("Marshal failed:", err)
+	}
+	doc, err := Parse(out)
+	if err != nil {
+		t.Fatal("Should parse the output, got:", err, string(out))
+	}
+	if v, ok := doc.Lookup("nil"); !ok || v != nil {
+		t.Error("Should encode nil slices as null, got:", v, string(out))
+	}
+	if v, _ := doc.Lookup("empty"); !reflect.DeepEqual(v, []string{}) {
+		t.Error("Should encode empty slices as empty arrays, got:", v)
+	}
+
+	var back lists
+	if err = Unmarshal(out, &back); err != nil {
+		t.Fatal("Unmarshal failed:", err, string(out))
+	}
+	if back.Nil != nil || back.Floats != nil {
+		t.Error("Should decode null as nil slices, got:", back)
+	}
+	if back.Empty == nil || len(back.Empty) != 0 || back.Ints == nil || len(back.Ints) != 0 {
+		t.Error("Should decode [] as empty slices, got:", back)
+	}
+}
@@ -2,9 +2,10 @@ package fml
 
 import (
 	. "github.com/fipress/fiputil"
-	"regexp"
 	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 const (
@@ -12,42 +13,127 @@ const (
 	datetimeF = "2006-01-02 15:04:05"
 )
 
-var (
-	dateR            = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
-	datetimeR        = regexp.MustCompile(`^\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}$`)
-	datetimeRFC3399R = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(.\d+)?(Z|[+-]\d{2}:\d{2})$`)
-)
-
 func eval(raw string) (val interface{}) {
 	var ok bool
+	if len(raw) == 0 {
+		return raw
+	} else if isNull(raw) {
+		return nil
+	}
+
 	switch raw[0] {
+	case 'e':
+		if secret, ok := evalSecret(raw); ok {
+			return secret
+		}
 	case 't', 'T', 'f', 'F':
 		val, ok = evalBool(raw)
 		if ok {
 			return
 		}
-	case '+', '-', '1', '2', '3', '4', '5', '6', '7', '8', '9':
-		val, ok = evalInt(raw)
-		if ok {
-			return
+	case '+', '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		//recognize the shape by bytes first, failed conversions are costly
+		if hasLeadingZero(raw) && !isDate(raw) {
+			//like 0755 or 01234, kept as a string
+			break
 		}
-		val, ok = evalFloat(raw)
-		if ok {
-			return
+		if isInteger(raw) {
+			val, ok = evalInt(raw)
+			if ok {
+				return
+			}
+		}
+		if isDate(raw) {
+			val, ok = evalDatetime(raw)
+		} else {
+			val, ok = evalFloat(raw)
 		}
-		val, ok = evalDatetime(raw)
 		if ok {
 			return
 		}
 	}
 	//log.Println("raw:",raw)
-	return Unquote(raw)
+	return evalString(raw)
+}
+
+//isNull reports whether raw is the null literal, which marks a key as deliberately unset.
+func isNull(raw string) bool {
+	switch raw {
+	case "null", "NULL", "Null":
+		return true
+	}
+	return false
 }
 
 func evalString(raw string) string {
+	if l := len(raw); l > 1 && raw[0] == raw[l-1] {
+		switch raw[0] {
+		case '"':
+			return unescape(raw[1 : l-1])
+		case '\'':
+			return raw[1 : l-1]
+		}
+	}
+	if strings.IndexByte(raw, '\\') == -1 {
+		return raw
+	}
 	return Unquote(raw)
 }
 
+//unescape resolves the escape sequences of a double-quoted string:
+//\b \f \n \r \t \" \' \\ \/ \0, \uXXXX and \UXXXXXXXX.
+func unescape(raw string) string {
+	if strings.IndexByte(raw, '\\') == -1 {
+		return raw
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		if c != '\\' {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		if i >= len(raw) {
+			panic(invalidEscape + "\\")
+		}
+		switch raw[i] {
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case '0':
+			b.WriteByte(0)
+		case '"', '\'', '\\', '/':
+			b.WriteByte(raw[i])
+		case 'u', 'U':
+			size := 4
+			if raw[i] == 'U' {
+				size = 8
+			}
+			if i+size >= len(raw) {
+				panic(invalidEscape + raw[i-1:])
+			}
+			code, err := strconv.ParseUint(raw[i+1:i+1+size], 16, 32)
+			if err != nil || !utf8.ValidRune(rune(code)) {
+				panic(invalidEscape + raw[i-1:i+1+size])
+			}
+			b.WriteRune(rune(code))
+			i += size
+		default:
+			panic(invalidEscape + raw[i-1:i+1])
+		}
+	}
+	return b.String()
+}
+
 func evalBool(raw string) (val bool, ok bool) {
 	switch raw {
 	case "t", "T", "true", "TRUE", "True":
@@ -70,18 +156,122 @@ func evalFloat(raw string) (val float64, ok bool) {
 
 func evalDatetime(raw string) (val time.Time, ok bool) {
 	var err error
-	if dateR.MatchString(raw) {
-		val, err = time.Parse(dateF, raw)
-	} else if datetimeR.MatchString(raw) {
-		val, err = time.Parse(datetimeF, raw)
-	} else if datetimeRFC3399R.MatchString(raw) {
+	switch datetimeLayout(raw) {
+	case dateF, datetimeF:
+		return parseDatetime(raw)
+	case time.RFC3339:
 		val, err = time.Parse(time.RFC3339, raw)
-	} else {
+	default:
 		return time.Time{}, false
 	}
 	return val, err == nil
 }
 
+//datetimeLayout gets the layout raw is in, like 2006-01-02, 2006-01-02 15:04:05
+//or 2006-01-02T15:04:05.999Z07:00, or an empty string if it isn't a datetime.
+func datetimeLayout(raw string) string {
+	if !isDate(raw) {
+		return ""
+	}
+	if len(raw) == 10 {
+		return dateF
+	}
+	if len(raw) < 19 || !isDigits(raw[11:13]) || raw[13] != ':' ||
+		!isDigits(raw[14:16]) || raw[16] != ':' || !isDigits(raw[17:19]) {
+		return ""
+	}
+	switch raw[10] {
+	case ' ':
+		if len(raw) == 19 {
+			return datetimeF
+		}
+	case 'T':
+		zone := raw[19:]
+		if len(zone) > 1 && zone[0] == '.' {
+			i := 1
+			for i < len(zone) && isDigit(zone[i]) {
+				i++
+			}
+			if i == 1 {
+				return ""
+			}
+			zone = zone[i:]
+		}
+		if zone == "Z" || len(zone) == 6 && (zone[0] == '+' || zone[0] == '-') &&
+			isDigits(zone[1:3]) && zone[3] == ':' && isDigits(zone[4:6]) {
+			return time.RFC3339
+		}
+	}
+	return ""
+}
+
+//parseDatetime parses a date or datetime in UTC from the digits,
+//it is what time.Parse does for these two layouts, without the layout interpreting.
+func parseDatetime(raw string) (val time.Time, ok bool) {
+	year := atoi(raw[:4])
+	month := time.Month(atoi(raw[5:7]))
+	day := atoi(raw[8:10])
+	if month < time.January || month > time.December || day < 1 || day > daysIn(month, year) {
+		return time.Time{}, false
+	}
+	var hour, min, sec int
+	if len(raw) > 10 {
+		hour, min, sec = atoi(raw[11:13]), atoi(raw[14:16]), atoi(raw[17:19])
+		if hour > 23 || min > 59 || sec > 59 {
+			return time.Time{}, false
+		}
+	}
+	return time.Date(year, month, day, hour, min, sec, 0, time.UTC), true
+}
+
+func daysIn(month time.Month, year int) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+//atoi converts digits to int, the digits are checked by the caller
+func atoi(digits string) (n int) {
+	for i := 0; i < len(digits); i++ {
+		n = n*10 + int(digits[i]-'0')
+	}
+	return
+}
+
+//isDate reports whether raw starts with a date like 2006-01-02
+func isDate(raw string) bool {
+	return len(raw) >= 10 && isDigits(raw[:4]) && raw[4] == '-' &&
+		isDigits(raw[5:7]) && raw[7] == '-' && isDigits(raw[8:10])
+}
+
+//hasLeadingZero reports whether raw starts with a zero followed by another digit, after an optional sign.
+//0, 0.5 and 0e3 are numbers, while 0755 is not.
+func hasLeadingZero(raw string) bool {
+	if len(raw) > 0 && (raw[0] == '+' || raw[0] == '-') {
+		raw = raw[1:]
+	}
+	return len(raw) > 1 && raw[0] == '0' && isDigit(raw[1])
+}
+
+//isInteger reports whether raw is an optional sign followed by digits
+func isInteger(raw string) bool {
+	if len(raw) > 0 && (raw[0] == '+' || raw[0] == '-') {
+		raw = raw[1:]
+	}
+	return len(raw) > 0 && isDigits(raw)
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
 func doEvalDatetime(raw string, format string) (val time.Time, ok bool) {
 	val, err := time.Parse(format, raw)
 	return val, err == nil
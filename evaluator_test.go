@@ -106,6 +106,22 @@ func TestEvalDatetime(t *testing.T) {
 	}
 }
 
+func TestParseDatetime(t *testing.T) {
+	inputs := []string{"2016-02-29", "2015-02-29", "2014-13-01", "2014-00-10", "2014-04-31",
+		"2014-07-06 23:59:59", "2014-07-06 24:00:00", "2014-07-06 12:60:00", "0000-01-01"}
+	for _, input := range inputs {
+		layout := dateF
+		if len(input) > 10 {
+			layout = datetimeF
+		}
+		tm, err := time.Parse(layout, input)
+		val, ok := parseDatetime(input)
+		if ok != (err == nil) || val != tm {
+			t.Error("Should parse datetime as time.Parse does,", input, val, err)
+		}
+	}
+}
+
 func TestEval(t *testing.T) {
 	input := "abc"
 	val := eval(input)
@@ -144,9 +160,46 @@ func TestEval(t *testing.T) {
 		t.Error("Should get datetime,", val)
 	}
 
+	input = "-1e3"
+	val = eval(input)
+	if val != -1000.0 {
+		t.Error("Should get float,", val)
+	}
+
+	input = "12345678901234567890"
+	val = eval(input)
+	if val != 12345678901234567890.0 {
+		t.Error("Should get float for an int out of range,", val)
+	}
+
 	input = `123a\n`
 	val = eval(input)
 	if val != "123a\n" {
 		t.Error("Should get string,", val)
 	}
+
+	numbers := map[string]interface{}{"0": 0, "-0": 0, "0.5": 0.5, "0e3": 0.0, "-0.25": -0.25, "0001-01-01": time.Date(1, 1, 1, 0, 0, 0, 0, time.UTC)}
+	for input, expected := range numbers {
+		if val = eval(input); val != expected {
+			t.Errorf("Should get %v for %s, got: %#v", expected, input, val)
+		}
+	}
+	for _, input := range []string{"01234", "0755", "-007", "+01.5", "00"} {
+		if val = eval(input); val != input {
+			t.Errorf("Should keep %s with leading zeros as a string, got: %#v", input, val)
+		}
+	}
+}
+
+func TestUnescape(t *testing.T) {
+	input := `a\tb\\c\"dé\U0001F600`
+	val := unescape(input)
+	if val != "a\tb\\c\"dé😀" {
+		t.Error("Should unescape, val:", val)
+	}
+
+	input = `"quoted \"123\""`
+	if eval(input) != `quoted "123"` {
+		t.Error("Should eval quoted string")
+	}
 }
@@ -2,11 +2,12 @@ package fml
 
 import (
 	. "github.com/fipress/fiputil"
+	"reflect"
+	"strconv"
 	"strings"
 	"time"
 	//	"log"
 	"bytes"
-	"log"
 )
 
 const (
@@ -14,37 +15,61 @@ const (
 	invalidKeyName         = "invalid key name"
 	duplicateNode          = "duplicate node: "
 	duplicateKey           = "duplicate key: "
-	unsupportedValue       = "unsurported value for key: "
+	tooDeep                = "node nested too deep: "
+	unknownProfile         = "unknown profile: "
 	multipleLineClosingErr = "multiple line literal not close properly"
 	literalClosingErr      = "literal not close properly"
+	quotedClosingErr       = "quoted string not close properly"
+	invalidEscape          = "invalid escape sequence: "
+	invalidValueEnd        = "unexpected content after value"
 	invalidArray           = "invalid aray"
+	invalidValue           = "invalid value of key: "
+	tooLarge               = "input too large"
+	tooManyKeys            = "too many keys"
+	tooLongArray           = "array too long"
 )
 
 var (
-	Delimiter       byte = '='
-	multipleLiteral      = []byte{'`', '`', '`'}
+	multipleLiteral = []byte{'`', '`', '`'}
 )
 
-func extractNode(input []byte, doc *FML) (idx int) {
-	prefixes, name, idx := extractNodeName(input)
-	pDoc := getPNodeByName(prefixes, doc)
-	if pDoc.dict[name] != nil {
-		panic(duplicateNode + name)
+func (p *parser) extractNode(input []byte, doc *FML) (idx int) {
+	p.mark(input)
+	prefixes, name, base, idx := p.extractNodeName(input)
+	if p.opts.MaxDepth > 0 && len(prefixes)+1 > p.opts.MaxDepth {
+		panic(tooDeep + name)
+	}
+	name, profile := p.splitProfile(name)
+	//nodes of inactive profiles are parsed but dropped
+	active := p.isActiveProfile(profile)
+	if !active {
+		base = ""
 	}
+	path := strings.Join(append(prefixes, name), ".")
+	if len(profile) != 0 {
+		path += "@" + profile
+	}
+	p.recordStart(path, input)
 
 	//array, err :=doc.GetTableArray(name)
 	isList, delta := isListPrefix(input[idx:])
 	if isList {
 		list := make([]*FML, 0)
-		idx += delta
-		for idx < len(input) {
-			subDoc := NewFml()
+		for {
+			subDoc := p.newNode()
+			if p.paths != nil {
+				item := path + "[" + strconv.Itoa(len(list)) + "]"
+				p.setPath(subDoc, item)
+				p.recordStart(item, input[idx+SkipSpace(input[idx:]):])
+			}
+			idx += delta
+			p.addExtension(subDoc, path, base)
 			//log.Println("extract node list:",string(input[idx:]))
-			idx += extractKeyValueBlock(input[idx:], subDoc)
+			idx += p.extractKeyValueBlock(input[idx:], subDoc)
 			//log.Println("subdoc,name:",subDoc.GetString("name",""))
 			list = append(list, subDoc)
-			goon, delta := isListPrefix(input[idx:])
-			idx += delta
+			goon, next := isListPrefix(input[idx:])
+			delta = next
 			//log.Println("extract node list,is end:",string(input[idx:]))
 			//log.Printf("extract node list,idx=%d,c=%c,goon=%v,delta=%d\n",idx,input[idx],goon,delta)
 			if !goon {
@@ -52,18 +77,53 @@ func extractNode(input []byte, doc *FML) (idx int) {
 			}
 		}
 		//log.Print("extractNode, name:",name,",len:",len(list))
-		if len(list) != 0 {
-			pDoc.dict[name] = list
+		if len(list) != 0 && active {
+			p.addNode(doc, prefixes, name, profile, list)
 		}
 	} else {
-		subDoc := NewFml()
-		idx += extractKeyValueBlock(input[idx:], subDoc)
-		pDoc.dict[name] = subDoc
+		subDoc := p.newNode()
+		p.setPath(subDoc, path)
+		p.addExtension(subDoc, path, base)
+		idx += p.extractKeyValueBlock(input[idx:], subDoc)
+		if active {
+			p.addNode(doc, prefixes, name, profile, subDoc)
+		}
 	}
 	return
 }
 
-func getPNodeByName(names []string, doc *FML) *FML {
+func (p *parser) addNode(doc *FML, prefixes []string, name, profile string, node interface{}) {
+	pDoc := p.getPNodeByName(prefixes, doc)
+	if len(profile) == 0 {
+		p.setNode(pDoc, name, node)
+	} else {
+		p.addOverride(pDoc, name, node)
+	}
+}
+
+//setNode adds a node or a node list to its parent according to the duplicate policy
+func (p *parser) setNode(pDoc *FML, name string, node interface{}) {
+	old, ok := pDoc.dict[name]
+	if !ok {
+		pDoc.dict[name] = node
+		return
+	}
+
+	switch p.opts.Duplicate {
+	case DuplicateLastWins:
+		pDoc.dict[name] = node
+	case DuplicateCollect:
+		val, ok := collectValue(old, node)
+		if !ok {
+			panic(duplicateNode + name)
+		}
+		pDoc.dict[name] = val
+	default:
+		panic(duplicateNode + name)
+	}
+}
+
+func (p *parser) getPNodeByName(names []string, doc *FML) *FML {
 	/*l := len(names)
 	if l == 0 {
 		return nil
@@ -72,14 +132,13 @@ func getPNodeByName(names []string, doc *FML) *FML {
 	}*/
 	pNode := doc
 	for i := 0; i < len(names); i++ {
-		if pNode == nil {
-			return nil
-		}
-		switch p := pNode.dict[names[i]].(type) {
+		switch node := pNode.dict[names[i]].(type) {
 		case *FML:
-			pNode = p
+			pNode = node
 		case nil:
-			pNode = NewFml()
+			sub := p.newNode()
+			pNode.dict[names[i]] = sub
+			pNode = sub
 		default:
 			panic(duplicateKey + names[i])
 		}
@@ -87,10 +146,19 @@ func getPNodeByName(names []string, doc *FML) *FML {
 	return pNode
 }
 
-func extractKeyValueBlock(input []byte, doc *FML) (idx int) {
+//A block ends by a blank line, a node header, or a line starts a list.
+//A node may be empty.
+func (p *parser) extractKeyValueBlock(input []byte, doc *FML) (idx int) {
+	if end, delta := p.isBlockEnd(input); end {
+		return delta
+	}
+
 	for idx < len(input) {
-		idx += extractKeyValue(input[idx:], doc)
-		end, delta := isKeyValueBlockEnd(input[idx:])
+		if i := idx + SkipSpace(input[idx:]); i < len(input) && input[i] == '[' {
+			return
+		}
+		idx += p.extractKeyValue(input[idx:], doc)
+		end, delta := p.isKeyValueBlockEnd(input[idx:])
 		if end {
 			idx += delta
 			return
@@ -125,28 +193,33 @@ func extractKeyValueBlock(input []byte, doc *FML) (idx int) {
 	return
 }*/
 
-func extractKeyValue(input []byte, doc *FML) (idx int) {
+func (p *parser) extractKeyValue(input []byte, doc *FML) (idx int) {
 	idx = SkipSpace(input)
+	p.mark(input[idx:])
+	p.keys++
+	if p.opts.MaxKeys > 0 && p.keys > p.opts.MaxKeys {
+		panic(tooManyKeys)
+	}
 
-	key, delta := extractKey(input[idx:])
+	key, delta := p.extractKey(input[idx:])
 	//log.Println("extractKeyValue,key:",key,"delta:",delta)
 	idx += delta
+	defer redactPanic(key)
 
-	if doc.dict[key] != nil {
-		panic(duplicateKey + key)
-	}
-
-	idx += skipRest(input[idx:])
-	val, delta := extractValue(input[idx:])
+	val, end, delta := p.scanValue(input[idx:])
 	//log.Println("extractKeyValue,value:",val,",idx:",idx,",delta 1:",delta)
 	//log.Printf("c1=%c\n",input[idx])
+	start := p.offset(input[idx:])
+	p.recordSpan(doc, key, start, start+end)
 	idx += delta
 	//log.Printf("c2=%c,c2+1=%c\n",input[idx],input[idx+1])
-	if val == nil {
-		panic(unsupportedValue + key)
-	}
 
-	doc.dict[key] = val
+	key, profile := p.splitProfile(key)
+	if len(profile) == 0 {
+		p.setValue(doc, key, val)
+	} else if p.isActiveProfile(profile) {
+		p.addOverride(doc, key, val)
+	}
 
 	//idx += skipRest(input[idx:])
 	//log.Println("extractKeyValue,value:",val,",idx:",idx,",delta 2:",delta)
@@ -154,35 +227,119 @@ func extractKeyValue(input []byte, doc *FML) (idx int) {
 	return
 }
 
-func extractKey(input []byte) (key string, idx int) {
-	delta, found := SkipUntilOrStopAtLineEnd(input, Delimiter)
+//setValue sets a key value according to the duplicate policy
+func (p *parser) setValue(doc *FML, key string, val interface{}) {
+	old, ok := doc.dict[key]
+	if !ok {
+		doc.dict[key] = val
+		return
+	}
+
+	switch p.opts.Duplicate {
+	case DuplicateLastWins:
+		doc.dict[key] = val
+	case DuplicateCollect:
+		val, ok = collectValue(old, val)
+		if !ok {
+			panic(duplicateKey + key)
+		}
+		doc.dict[key] = val
+	default:
+		panic(duplicateKey + key)
+	}
+}
+
+func (p *parser) extractKey(input []byte) (key string, idx int) {
+	delta, found := p.skipUntilDelimiter(input)
 	if !found || delta == 0 {
-		log.Println("extract key:", string(input))
-		log.Println("found:", found, "delta:", delta)
 		panic(invalidKeyName)
 	}
 	idx = delta
-	key = string(input[:idx])
-	key = strings.TrimSpace(key)
+	from, to := 0, idx
+	for from < to && IsSpace(input[from]) {
+		from++
+	}
+	for to > from && IsSpace(input[to-1]) {
+		to--
+	}
+	for i := from; i < to; i++ {
+		if input[i] < ' ' || input[i] == 0x7f {
+			panic(invalidKeyName)
+		}
+	}
+	key = p.normalizeKey(p.str(input, from, to))
+	if len(key) == 0 {
+		panic(invalidKeyName)
+	}
 	idx++ //:
-	idx += skipRest(input[idx:])
+	idx += p.skipSpaceAndComment(input[idx:])
 	return
 }
 
-func extractValue(input []byte) (val interface{}, idx int) {
+func (p *parser) skipUntilDelimiter(input []byte) (int, bool) {
+	for i := 0; i < len(input); i++ {
+		if p.isDelimiter(input[i]) {
+			return i, true
+		} else if IsLineEnd(input[i]) {
+			return i, false
+		}
+	}
+	return len(input), false
+}
+
+//A key without value, like "key:", gets an empty string.
+//Use the null literal to mark a value deliberately unset.
+func (p *parser) extractValue(input []byte) (val interface{}, idx int) {
+	val, _, idx = p.scanValue(input)
+	return
+}
+
+//scanValue extracts a value, end is where the value ends in the input,
+//and idx is where the next line starts.
+func (p *parser) scanValue(input []byte) (val interface{}, end int, idx int) {
+	if len(input) == 0 || IsLineEnd(input[0]) {
+		return "", 0, p.skipRest(input)
+	}
+
 	switch input[0] {
 	case '`':
-		val, idx = extractLiteral(input)
+		val, end = extractLiteral(input)
+	case '"', '\'':
+		val, end = extractQuoted(input)
 	case '[':
-		val, idx = extractArray(input)
+		val, end = p.extractArray(input)
+		if val == nil {
+			panic(invalidArray)
+		}
+		if p.opts.MaxArrayLength > 0 && reflect.ValueOf(val).Len() > p.opts.MaxArrayLength {
+			panic(tooLongArray)
+		}
+	case '|', '>':
+		if p.isBlockLiteralHeader(input) {
+			val, idx = p.extractBlockLiteral(input)
+			return val, idx, idx
+		}
+		fallthrough
 	default:
-		//var raw string
-		val, idx = getRawValue(input)
+		var raw string
+		raw, end = p.scanRawValue(input)
+		val = eval(raw)
 	}
+	idx = end + p.skipValueRest(input[end:])
 	return
 }
 
-func extractNodeName(input []byte) (prefixes []string, name string, idx int) {
+//A value may only be followed by spaces or a comment on its line
+func (p *parser) skipValueRest(input []byte) int {
+	i := p.skipSpaceAndComment(input)
+	if i < len(input) && !IsLineEnd(input[i]) {
+		panic(invalidValueEnd)
+	}
+	return i + p.skipRest(input[i:])
+}
+
+//A node name may be followed by the name of its base node, like [prod : base]
+func (p *parser) extractNodeName(input []byte) (prefixes []string, name string, base string, idx int) {
 	delta, found := SkipUntilOrStopAtLineEnd(input[1:], ']')
 	if !found || delta == 0 {
 		panic(invalidNodeName)
@@ -190,8 +347,21 @@ func extractNodeName(input []byte) (prefixes []string, name string, idx int) {
 	idx = delta + 1 //plus '['
 	str := string(input[1:idx])
 	idx++ //plus ']'
-	str = strings.TrimSpace(str)
+	if i := strings.IndexByte(str, ':'); i != -1 {
+		base = p.normalizeKey(strings.TrimSpace(str[i+1:]))
+		str = str[:i]
+		if len(base) == 0 {
+			panic(invalidNodeName)
+		}
+	}
+	str = p.normalizeKey(strings.TrimSpace(str))
 	names := strings.Split(str, ".")
+	for i := range names {
+		names[i] = strings.TrimSpace(names[i])
+		if len(names[i]) == 0 {
+			panic(invalidNodeName)
+		}
+	}
 	l := len(names)
 	if l == 0 {
 		return
@@ -201,7 +371,7 @@ func extractNodeName(input []byte) (prefixes []string, name string, idx int) {
 			prefixes = names[:l-1]
 		}
 	}
-	idx += skipRest(input[idx:])
+	idx += p.skipRest(input[idx:])
 	return
 }
 
@@ -226,12 +396,129 @@ func extractLiteral(input []byte) (val string, idx int) {
 	return
 }
 
-func extractArray(input []byte) (val interface{}, idx int) {
+//A double-quoted string supports escape sequences, see unescape.
+//A single-quoted string is raw, it ends at the next single quote.
+//Both must be closed on the same line.
+func extractQuoted(input []byte) (val string, idx int) {
+	quote := input[0]
+	escaped := false
+	for idx = 1; idx < len(input); idx++ {
+		c := input[idx]
+		if IsLineEnd(c) {
+			break
+		}
+		if quote == '"' && c == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		if c == quote && !escaped {
+			raw := string(input[1:idx])
+			if quote == '"' {
+				val = unescape(raw)
+			} else {
+				val = raw
+			}
+			idx++
+			return
+		}
+		escaped = false
+	}
+	panic(quotedClosingErr)
+}
+
+//A block literal starts with '|' or '>', optionally followed by '-',
+//and nothing but spaces or a comment on the rest of the line.
+func (p *parser) isBlockLiteralHeader(input []byte) bool {
+	i := 1
+	if i < len(input) && input[i] == '-' {
+		i++
+	}
+	i += p.skipSpaceAndComment(input[i:])
+	return i == len(input) || IsLineEnd(input[i])
+}
+
+//extractBlockLiteral extracts an indentation-stripping multiple line literal.
+//The content lines must be indented, the indentation of the first one is removed from all of them,
+//and the first less indented line ends the block.
+//'|' keeps the line ends while '>' folds lines into spaces, blank lines become line ends.
+//The content ends with a single line end, unless the header is '|-' or '>-'.
+func (p *parser) extractBlockLiteral(input []byte) (val string, idx int) {
+	folded := input[0] == '>'
+	clip := true
+	idx = 1
+	if idx < len(input) && input[idx] == '-' {
+		clip = false
+		idx++
+	}
+	idx += p.skipSpaceAndComment(input[idx:])
+	idx += skipLineEnd(input[idx:])
+
+	var lines []string
+	indent := -1
+	contentEnd, contentLines := idx, 0
+	for idx < len(input) {
+		lineEnd := idx + SkipUntilFunc(input[idx:], IsLineEnd, false)
+		line := input[idx:lineEnd]
+		n := SkipSpace(line)
+		if n < len(line) {
+			if indent == -1 {
+				indent = n
+			}
+			if n == 0 || n < indent {
+				break
+			}
+		}
+
+		if n == len(line) {
+			lines = append(lines, "")
+		} else {
+			lines = append(lines, string(line[indent:]))
+		}
+
+		idx = lineEnd + skipLineEnd(input[lineEnd:])
+		if n < len(line) {
+			contentEnd, contentLines = idx, len(lines)
+		}
+	}
+	//trailing blank lines end the block, they don't belong to it
+	idx, lines = contentEnd, lines[:contentLines]
+	if len(lines) == 0 {
+		return
+	}
+
+	if folded {
+		val = foldLines(lines)
+	} else {
+		val = strings.Join(lines, "\n")
+	}
+	if clip {
+		val += "\n"
+	}
+	return
+}
+
+func foldLines(lines []string) string {
+	var b strings.Builder
+	for i, l := range lines {
+		if l == "" {
+			b.WriteByte('\n')
+			continue
+		}
+		if i > 0 && lines[i-1] != "" {
+			b.WriteByte(' ')
+		}
+		b.WriteString(l)
+	}
+	return b.String()
+}
+
+func (p *parser) extractArray(input []byte) (val interface{}, idx int) {
 	//i := 1 + skipLeft(input[1:])
-	items, idx := getArrayItems(input)
+	items, idx := p.getArrayItems(input)
 	length := len(items)
 	if length == 0 {
-		return
+		//[] is an empty array of string
+		return []string{}, idx
 	}
 
 	val0 := eval(items[0])
@@ -250,21 +537,14 @@ func extractArray(input []byte) (val interface{}, idx int) {
 		for i := 1; i < length; i++ {
 			vi, ok := evalInt(items[i])
 			if !ok {
-				panic(invalidArray)
+				//an array of ints and floats is an array of floats
+				return extractFloatArray(items), idx
 			}
 			arr[i] = vi
 		}
 		val = arr
 	case float64:
-		arr := make([]float64, length, length)
-		for i := 1; i < length; i++ {
-			vi, ok := evalFloat(items[i])
-			if !ok {
-				panic(invalidArray)
-			}
-			arr[i] = vi
-		}
-		val = arr
+		val = extractFloatArray(items)
 	case bool:
 		arr := make([]bool, length, length)
 		arr[0] = v0
@@ -291,18 +571,33 @@ func extractArray(input []byte) (val interface{}, idx int) {
 	return
 }
 
-func getArrayItems(input []byte) (items []string, idx int) {
+func extractFloatArray(items []string) []float64 {
+	arr := make([]float64, len(items))
+	for i := 0; i < len(items); i++ {
+		vi, ok := evalFloat(items[i])
+		if !ok {
+			panic(invalidArray)
+		}
+		arr[i] = vi
+	}
+	return arr
+}
+
+func (p *parser) getArrayItems(input []byte) (items []string, idx int) {
 	from := -1
 	add := func(to int) {
-		val := string(input[from:to])
-		val = strings.TrimSpace(val)
-		items = append(items, val)
+		start, end := trimSpace(input[from:to])
+		items = append(items, p.str(input, from+start, from+end))
 	}
 	//log.Printf("getArrayItems,c0=%c\n",input[0])
 	for i := 1; i < len(input); i++ {
 		switch input[i] {
-		case ' ', '\t', '\n', '\r', '\f':
-			//do nothing
+		case '"', '\'':
+			if from == -1 {
+				from = i
+			}
+			_, delta := extractQuoted(input[i:])
+			i += delta - 1
 		case ',':
 			if from == -1 {
 				panic(invalidArray)
@@ -315,7 +610,7 @@ func getArrayItems(input []byte) (items []string, idx int) {
 			}
 			return items, i + 1
 		default:
-			if from == -1 {
+			if from == -1 && !isArraySpace(input[i]) {
 				from = i
 			}
 		}
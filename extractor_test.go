@@ -1,16 +1,19 @@
 package fml
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+)
 
 func TestExtractNodeName(t *testing.T) {
 	input := "[node]"
-	prefixes, name, idx := extractNodeName([]byte(input))
+	prefixes, name, _, idx := testParser.extractNodeName([]byte(input))
 	if prefixes != nil || name != "node" || idx != len(input) {
 		t.Error("Should get node name. name:", name, "idx:", idx, "len:", len(input))
 	}
 
 	input = "[a.node]  #comment"
-	prefixes, name, idx = extractNodeName([]byte(input))
+	prefixes, name, _, idx = testParser.extractNodeName([]byte(input))
 	if len(prefixes) != 1 || prefixes[0] != "a" || name != "node" || idx != len(input) {
 		t.Error("Should get node name. prefixes:", prefixes, "name:", name, "idx:", idx, "len:", len(input))
 	}
@@ -18,13 +21,13 @@ func TestExtractNodeName(t *testing.T) {
 
 func TestExtractKey(t *testing.T) {
 	input := "key:"
-	name, idx := extractKey([]byte(input))
+	name, idx := testParser.extractKey([]byte(input))
 	if name != "key" || idx != len(input) {
 		t.Error("Should get key name. name:", name, "idx:", idx, "len:", len(input))
 	}
 
 	input = "key:  #comment"
-	name, idx = extractKey([]byte(input))
+	name, idx = testParser.extractKey([]byte(input))
 	if name != "key" || idx != len(input) {
 		t.Error("Should get key name. name:", name, "idx:", idx, "len:", len(input))
 	}
@@ -54,7 +57,7 @@ line2 \n # not comment` + "```"
 
 func TestGetArrayItems(t *testing.T) {
 	input := "[1,2,3]"
-	items, idx := getArrayItems([]byte(input))
+	items, idx := testParser.getArrayItems([]byte(input))
 	if items[0] != "1" || items[2] != "3" || idx != len(input) {
 		t.Error("Should get array itmes. items:", items, "idx:", idx, "len:", len(input))
 	}
@@ -63,7 +66,7 @@ func TestGetArrayItems(t *testing.T) {
 
 func TestExtractArray(t *testing.T) {
 	input := "[t,f,t]"
-	array, idx := extractArray([]byte(input))
+	array, idx := testParser.extractArray([]byte(input))
 	if idx != len(input) {
 		t.Error("should skip all")
 	}
@@ -79,7 +82,7 @@ func TestExtractArray(t *testing.T) {
 	input = `[zh,
 	en
 	]`
-	array, idx = extractArray([]byte(input))
+	array, idx = testParser.extractArray([]byte(input))
 	if idx != len(input) {
 		t.Error("should skip all")
 	}
@@ -96,19 +99,19 @@ func TestExtractArray(t *testing.T) {
 
 func TestExtractValue(t *testing.T) {
 	input := "abc # comment\n"
-	val, idx := extractValue([]byte(input))
+	val, idx := testParser.extractValue([]byte(input))
 	if val != "abc" || idx != len(input) {
 		t.Error("Should get value. val:", val, "idx:", idx, "len:", len(input))
 	}
 
 	input = "abc\n"
-	val, idx = extractValue([]byte(input))
+	val, idx = testParser.extractValue([]byte(input))
 	if val != "abc" || idx != len(input) {
 		t.Error("Should get value. val:", val, "idx:", idx, "len:", len(input))
 	}
 
 	input = "123  #comment"
-	val, idx = extractValue([]byte(input))
+	val, idx = testParser.extractValue([]byte(input))
 	if val != 123 || idx != len(input) {
 		t.Error("Should get value. val:", val, "idx:", idx, "len:", len(input))
 	}
@@ -117,7 +120,7 @@ func TestExtractValue(t *testing.T) {
 func TestExtractKeyValue(t *testing.T) {
 	input := "name:Tony"
 	doc := NewFml()
-	idx := extractKeyValue([]byte(input), doc)
+	idx := testParser.extractKeyValue([]byte(input), doc)
 	if doc.GetString("name") != "Tony" || idx != len(input) {
 		t.Error("Should get key value,idx:", idx, "len:", len(input))
 	}
@@ -129,7 +132,7 @@ func TestExtractNode(t *testing.T) {
 	host:local
 	port:1433`
 	doc := NewFml()
-	idx := extractNode([]byte(input), doc)
+	idx := testParser.extractNode([]byte(input), doc)
 	db, err := doc.GetNode("database")
 	if err != nil {
 		t.Error("Extract node error:", err)
@@ -153,7 +156,7 @@ func TestExtractNodeOfList(t *testing.T) {
 	- name: Tony
 	age: 13`
 	doc := NewFml()
-	idx := extractNode([]byte(input), doc)
+	idx := testParser.extractNode([]byte(input), doc)
 	//IterateFimlDoc(doc)
 	if idx != len(input) {
 		t.Error("Extract list of node idx error,idx,len:", idx, len(input))
@@ -169,3 +172,99 @@ func TestExtractNodeOfList(t *testing.T) {
 		IterateFimlDoc(doc)
 	}
 }
+
+func TestExtractNullValue(t *testing.T) {
+	input := "null # comment\n"
+	val, idx := testParser.extractValue([]byte(input))
+	if val != nil || idx != len(input) {
+		t.Error("Should get null value. val:", val, "idx:", idx, "len:", len(input))
+	}
+
+	input = "\nnext"
+	val, idx = testParser.extractValue([]byte(input))
+	if val != "" || idx != 1 {
+		t.Error("Should get empty value. val:", val, "idx:", idx)
+	}
+}
+
+func TestExtractEmptyKeyValue(t *testing.T) {
+	input := "name=  # no value\nage=12"
+	doc := NewFml()
+	idx := testParser.extractKeyValue([]byte(input), doc)
+	idx += testParser.extractKeyValue([]byte(input[idx:]), doc)
+	if !doc.Has("name") || doc.GetString("name") != "" || doc.GetInt("age") != 12 {
+		t.Error("Should get empty name and age")
+	}
+}
+
+func TestExtractQuoted(t *testing.T) {
+	input := `"tab\t \"quoted\" é # not comment"`
+	val, idx := extractQuoted([]byte(input))
+	if val != "tab\t \"quoted\" é # not comment" || idx != len(input) {
+		t.Error("Should get quoted string. val:", val, "idx:", idx, "len:", len(input))
+	}
+
+	input = `'raw \n'`
+	val, idx = extractQuoted([]byte(input))
+	if val != `raw \n` || idx != len(input) {
+		t.Error("Should get raw string. val:", val, "idx:", idx, "len:", len(input))
+	}
+
+	input = "\"123\" # comment\nnext"
+	v, idx := testParser.extractValue([]byte(input))
+	if v != "123" || idx != len(input)-4 {
+		t.Error("Should get quoted value as string. val:", v, "idx:", idx)
+	}
+}
+
+func TestExtractBlockLiteral(t *testing.T) {
+	input := `|
+    SELECT *
+      FROM t
+
+    WHERE id = 1
+
+next: 1`
+	val, idx := testParser.extractBlockLiteral([]byte(input))
+	if val != "SELECT *\n  FROM t\n\nWHERE id = 1\n" || input[idx:] != "\nnext: 1" {
+		t.Errorf("Should get dedented literal. val: %q, rest: %q", val, input[idx:])
+	}
+
+	input = `>-
+  folded
+  line
+
+  next paragraph
+key: value`
+	val, idx = testParser.extractBlockLiteral([]byte(input))
+	if val != "folded line\nnext paragraph" || input[idx:] != "key: value" {
+		t.Errorf("Should get folded literal. val: %q, rest: %q", val, input[idx:])
+	}
+
+	input = "| # a comment\n  indented\nkey: value"
+	val, idx = testParser.extractBlockLiteral([]byte(input))
+	if val != "indented\n" || input[idx:] != "key: value" {
+		t.Errorf("Should get literal after a commented header. val: %q, rest: %q", val, input[idx:])
+	}
+}
+
+func TestExtractQuotedArray(t *testing.T) {
+	input := `["a,b", 'c]', d]`
+	array, idx := testParser.extractArray([]byte(input))
+	s, ok := array.([]string)
+	if !ok || idx != len(input) || len(s) != 3 || s[0] != "a,b" || s[1] != "c]" || s[2] != "d" {
+		t.Error("Should get quoted items. array:", array, "idx:", idx)
+	}
+}
+
+func TestExtractEmptyArray(t *testing.T) {
+	for _, input := range []string{"[]", "[ ]", "[\n]"} {
+		array, idx := testParser.extractArray([]byte(input))
+		if idx != len(input) {
+			t.Error("should skip all", input)
+		}
+		if !reflect.DeepEqual(array, []string{}) {
+			t.Error("Should get an empty array of string, got:", array)
+		}
+	}
+}
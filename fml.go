@@ -6,9 +6,12 @@ import (
 	"fmt"
 	"os"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 )
 
 var (
@@ -19,12 +22,15 @@ var (
 
 // A FML represents a fml node
 type FML struct {
-	dict map[string]interface{}
+	dict       map[string]interface{}
+	ignoreCase bool
+	//mu guards the whole document if it is synchronized, shared by all its nodes, see EnableSync
+	mu *sync.RWMutex
 }
 
 // NewFml creates an empty node
 func NewFml() *FML {
-	return &FML{make(map[string]interface{})}
+	return &FML{dict: make(map[string]interface{})}
 }
 
 // GetStringOrError gets a string value from the node.
@@ -184,10 +190,100 @@ func (f *FML) GetDatetimeOrDefault(key string, defaultVal time.Time) time.Time {
 	}
 }
 
+// Has reports whether the key exists in the node, even if its value is null.
+func (f *FML) Has(key string) bool {
+	_, err := f.getRawVal(key)
+	return err == nil
+}
+
+// IsNull reports whether the key exists in the node and its value is null.
+func (f *FML) IsNull(key string) bool {
+	raw, err := f.getRawVal(key)
+	return err == nil && raw == nil
+}
+
+// Lookup gets a value from the node as it is, like a string, an int, a []int, a *FML or a []*FML.
+// The value is nil if it is null. The found flag is false if the key does not exist.
+func (f *FML) Lookup(key string) (val interface{}, found bool) {
+	val, err := f.getRawVal(key)
+	return val, err == nil
+}
+
+// LookupString gets a string value from the node.
+// The found flag is false if the key does not exist, is null or is not a string.
+func (f *FML) LookupString(key string) (val string, found bool) {
+	raw, err := f.getRawVal(key)
+	if err != nil {
+		return
+	}
+
+	val, err = getString(raw)
+	return val, err == nil
+}
+
+// LookupBool gets a bool value from the node.
+// The found flag is false if the key does not exist, is null or is not a bool.
+func (f *FML) LookupBool(key string) (val bool, found bool) {
+	raw, err := f.getRawVal(key)
+	if err != nil {
+		return
+	}
+
+	val, err = getBool(raw)
+	return val, err == nil
+}
+
+// LookupInt gets a int value from the node.
+// The found flag is false if the key does not exist, is null or is not a int.
+func (f *FML) LookupInt(key string) (val int, found bool) {
+	raw, err := f.getRawVal(key)
+	if err != nil {
+		return
+	}
+
+	val, err = getInt(raw)
+	return val, err == nil
+}
+
+// LookupFloat gets a float value from the node.
+// The found flag is false if the key does not exist, is null or is not a float.
+func (f *FML) LookupFloat(key string) (val float64, found bool) {
+	raw, err := f.getRawVal(key)
+	if err != nil {
+		return
+	}
+
+	val, err = getFloat(raw)
+	return val, err == nil
+}
+
+// LookupDatetime gets a time.Time value from the node.
+// The found flag is false if the key does not exist, is null or is not a datetime.
+func (f *FML) LookupDatetime(key string) (val time.Time, found bool) {
+	raw, err := f.getRawVal(key)
+	if err != nil {
+		return
+	}
+
+	val, err = getTime(raw)
+	return val, err == nil
+}
+
+// LookupNode gets a sub-node from the node.
+// The found flag is false if the key does not exist, is null or is not a node.
+func (f *FML) LookupNode(key string) (node *FML, found bool) {
+	node, err := f.GetNode(key)
+	return node, err == nil && node != nil
+}
+
 // GetArrayOrError gets an array from the node.
 func (f *FML) GetArrayOrError(key string) (array interface{}, err error) {
-	fKey, doc, err := getFinalKeyAndNode(key, f)
-	switch arr := doc.dict[fKey].(type) {
+	raw, err := f.getArrayVal(key)
+	if err != nil {
+		return
+	}
+
+	switch arr := raw.(type) {
 	case []string:
 		array = arr
 	case []bool:
@@ -208,135 +304,142 @@ func (f *FML) GetArrayOrError(key string) (array interface{}, err error) {
 
 // GetStringArrayOrError gets an array of string from the node.
 func (f *FML) GetStringArrayOrError(key string) (arr []string, err error) {
-	fKey, doc, err := getFinalKeyAndNode(key, f)
+	raw, err := f.getArrayVal(key)
 	if err != nil {
 		return
 	}
 
-	return getStringArray(doc.dict[fKey])
+	return getStringArray(raw)
 }
 
 // GetStringArray gets an array of string from the node.
 // It returns nil if the key does not exist or other error happens.
 func (f *FML) GetStringArray(key string) []string {
-	fKey, doc, err := getFinalKeyAndNode(key, f)
+	raw, err := f.getArrayVal(key)
 	if err != nil {
 		return nil
 	}
 
-	arr, _ := getStringArray(doc.dict[fKey])
+	arr, _ := getStringArray(raw)
 	return arr
 }
 
 // GetBoolArrayOrError gets an array of bool from the node.
 func (f *FML) GetBoolArrayOrError(key string) (arr []bool, err error) {
-	fKey, doc, err := getFinalKeyAndNode(key, f)
+	raw, err := f.getArrayVal(key)
 	if err != nil {
 		return
 	}
 
-	return getBoolArray(doc.dict[fKey])
+	return getBoolArray(raw)
 }
 
 // GetBoolArray gets an array of bool from the node.
 // It returns nil if the key does not exist or other error happens.
 func (f *FML) GetBoolArray(key string) []bool {
-	fKey, doc, err := getFinalKeyAndNode(key, f)
+	raw, err := f.getArrayVal(key)
 	if err != nil {
 		return nil
 	}
 
-	arr, _ := getBoolArray(doc.dict[fKey])
+	arr, _ := getBoolArray(raw)
 	return arr
 }
 
 // GetIntArrayOrError gets an array of int from the node.
 func (f *FML) GetIntArrayOrError(key string) (arr []int, err error) {
-	fKey, doc, err := getFinalKeyAndNode(key, f)
+	raw, err := f.getArrayVal(key)
 	if err != nil {
 		return
 	}
 
-	return getIntArray(doc.dict[fKey])
+	return getIntArray(raw)
 }
 
 // GetIntArray gets an array of int from the node.
 // It returns nil if the key does not exist or other error happens.
 func (f *FML) GetIntArray(key string) []int {
-	fKey, doc, err := getFinalKeyAndNode(key, f)
+	raw, err := f.getArrayVal(key)
 	if err != nil {
 		return nil
 	}
 
-	arr, _ := getIntArray(doc.dict[fKey])
+	arr, _ := getIntArray(raw)
 	return arr
 }
 
 // GetFloatArrayOrError gets an array of float from the node.
 func (f *FML) GetFloatArrayOrError(key string) (arr []float64, err error) {
-	fKey, doc, err := getFinalKeyAndNode(key, f)
+	raw, err := f.getArrayVal(key)
 	if err != nil {
 		return
 	}
 
-	return getFloatArray(doc.dict[fKey])
+	return getFloatArray(raw)
 }
 
 // GetFloatArray gets an array of float from the node.
 // It returns nil if the key does not exist or other error happens.
 func (f *FML) GetFloatArray(key string) []float64 {
-	fKey, doc, err := getFinalKeyAndNode(key, f)
+	raw, err := f.getArrayVal(key)
 	if err != nil {
 		return nil
 	}
 
-	arr, _ := getFloatArray(doc.dict[fKey])
+	arr, _ := getFloatArray(raw)
 	return arr
 }
 
 // GetDatetimeArray gets an array of time.Time from the node.
 func (f *FML) GetTimeArrayOrError(key string) (arr []time.Time, err error) {
-	fKey, doc, err := getFinalKeyAndNode(key, f)
+	raw, err := f.getArrayVal(key)
 	if err != nil {
-		//fmt.Println("key,err:",key,err)
 		return
 	}
 
-	return getTimeArray(doc.dict[fKey])
+	return getTimeArray(raw)
 }
 
 // GetDatetimeArray gets an array of time.Time from the node.
 // It returns nil if the key does not exist or other error happens.
 func (f *FML) GetTimeArray(key string) []time.Time {
-	fKey, doc, err := getFinalKeyAndNode(key, f)
+	raw, err := f.getArrayVal(key)
 	if err != nil {
-		//fmt.Println("key,err:",key,err)
 		return nil
 	}
 
-	arr, _ := getTimeArray(doc.dict[fKey])
+	arr, _ := getTimeArray(raw)
 	return arr
 }
 
-// GetStruct get a struct from the node
+// GetStruct get a struct from the node, the fields are checked by their tags, see FieldError.
+// A null node leaves v untouched.
 func (f *FML) GetStruct(key string, v interface{}) (err error) {
 	//fKey, node, err := getFinalKeyAndNode(key, f)
 	node, err := f.GetNode(key)
-	if err != nil {
+	if err != nil || node == nil {
 		return
 	}
 
-	return getStruct(node, v)
+	if node.mu != nil {
+		//decoding may call back into the document, so it decodes a copy without the lock, see decodedVal
+		node = node.Clone()
+	}
+	return new(decoder).decodeStruct(node, v, key)
 }
 
-// GetNode gets a sub-node from the node
+// GetNode gets a sub-node from the node.
+// It returns a nil node without error if the value is null.
 func (f *FML) GetNode(key string) (node *FML, err error) {
-	fKey, doc, err := getFinalKeyAndNode(key, f)
-	switch v := doc.dict[fKey].(type) {
+	raw, err := f.getRawVal(key)
+	if err != nil {
+		return
+	}
+
+	switch v := raw.(type) {
 	case *FML:
 		node = v
 	case nil:
-		//err = errValueNotFound
 		node = nil
 	default:
 		err = errTypeMismatch
@@ -344,15 +447,19 @@ func (f *FML) GetNode(key string) (node *FML, err error) {
 	return
 }
 
-// GetNodeList gets a node list from the node
+// GetNodeList gets a node list from the node.
+// It returns a nil list without error if the value is null.
 func (f *FML) GetNodeList(key string) (list []*FML, err error) {
-	fKey, doc, err := getFinalKeyAndNode(key, f)
-	switch v := doc.dict[fKey].(type) {
+	raw, err := f.getRawVal(key)
+	if err != nil {
+		return
+	}
+
+	switch v := raw.(type) {
 	case []*FML:
 		list = v
 	case nil:
-		err = errValueNotFound
-		//table = nil
+		list = nil
 	default:
 		err = errTypeMismatch
 	}
@@ -360,6 +467,13 @@ func (f *FML) GetNodeList(key string) (list []*FML, err error) {
 }
 
 func (f *FML) getRawVal(key string) (val interface{}, err error) {
+	f.rlock()
+	defer f.runlock()
+	return f.rawVal(key)
+}
+
+//rawVal gets a value without taking the lock
+func (f *FML) rawVal(key string) (val interface{}, err error) {
 	fKey, doc, err := getFinalKeyAndNode(key, f)
 	//fmt.Println("getRawVal:fkey:",fKey,"doc:",doc,",err:",err)
 	if err != nil {
@@ -378,7 +492,18 @@ func (f *FML) getRawVal(key string) (val interface{}, err error) {
 	return
 }
 
-func getFinalKeyAndNode(key string, doc *FML) (finalKey string, finalToml *FML, err error) {
+//getArrayVal gets the value of an array, nil if the key does not exist
+func (f *FML) getArrayVal(key string) (val interface{}, err error) {
+	f.rlock()
+	defer f.runlock()
+	fKey, doc, err := getFinalKeyAndNode(key, f)
+	if err != nil {
+		return
+	}
+	return doc.dict[fKey], nil
+}
+
+func getFinalKeyAndNode(key string, doc *FML) (finalKey string, finalNode *FML, err error) {
 	if len(key) == 0 {
 		err = errNoKey
 		return
@@ -390,8 +515,11 @@ func getFinalKeyAndNode(key string, doc *FML) (finalKey string, finalToml *FML,
 		err = errNoKey
 		return
 	}
+	if doc.ignoreCase {
+		keys[0] = strings.ToLower(keys[0])
+	}
 	if len(keys) == 1 {
-		finalKey, finalToml = key, doc
+		finalKey, finalNode = keys[0], doc
 	} else {
 		if len(keys[1]) == 0 {
 			err = errNoKey
@@ -399,7 +527,7 @@ func getFinalKeyAndNode(key string, doc *FML) (finalKey string, finalToml *FML,
 		}
 		switch v := doc.dict[keys[0]].(type) {
 		case *FML:
-			finalKey, finalToml, err = getFinalKeyAndNode(keys[1], v)
+			finalKey, finalNode, err = getFinalKeyAndNode(keys[1], v)
 		default:
 			err = errValueNotFound
 		}
@@ -409,14 +537,31 @@ func getFinalKeyAndNode(key string, doc *FML) (finalKey string, finalToml *FML,
 }
 
 func (f *FML) SetValue(key string, v interface{}) {
-	f.dict[key] = v
+	if f.mu != nil {
+		v = ownValue(v)
+	}
+	f.lock()
+	defer f.unlock()
+	shareMutex(v, f.mu)
+	f.dict[f.normalizeKey(key)] = v
 }
 
 func (f *FML) RemoveItem(key string) {
-	delete(f.dict, key)
+	f.lock()
+	defer f.unlock()
+	delete(f.dict, f.normalizeKey(key))
+}
+
+func (f *FML) normalizeKey(key string) string {
+	if f.ignoreCase {
+		return strings.ToLower(key)
+	}
+	return key
 }
 
 func (f *FML) ValueSet() (values []interface{}) {
+	f.rlock()
+	defer f.runlock()
 	values = make([]interface{}, len(f.dict))
 
 	idx := 0
@@ -428,6 +573,12 @@ func (f *FML) ValueSet() (values []interface{}) {
 }
 
 func (f *FML) KeySet() (keys []string) {
+	f.rlock()
+	defer f.runlock()
+	return f.keys()
+}
+
+func (f *FML) keys() (keys []string) {
 	keys = make([]string, len(f.dict))
 
 	idx := 0
@@ -438,11 +589,6 @@ func (f *FML) KeySet() (keys []string) {
 	return
 }
 
-/*
-func (t *Toml) SetTable(key string, v *Toml) {
-
-}*/
-
 func (f *FML) WriteToFile(path string) (err error) {
 	file, err := os.Create(path)
 	defer file.Close()
@@ -458,38 +604,53 @@ func (f *FML) WriteToFile(path string) (err error) {
 }
 
 func (f *FML) WriteTo(writer *bufio.Writer) {
-	f.writeTo("", writer)
-}
-
-func (f *FML) writeTo(parentKey string, writer *bufio.Writer) {
-	for key, val := range f.dict {
+	f.rlock()
+	defer f.runlock()
+	f.writeTo("", writer, nil)
+}
+
+//writeTo writes the node, sensitive values are masked if the redactor is not nil.
+//Keys are written in order, before nodes and node lists.
+func (f *FML) writeTo(parentKey string, writer *bufio.Writer, r *Redactor) {
+	keys := f.keys()
+	sort.Strings(keys)
+	var nodes []func()
+	for _, key := range keys {
 		fullKey := key
 		if len(parentKey) != 0 {
 			fullKey = parentKey + "." + key
 		}
-		switch v := val.(type) {
+		switch v := f.dict[key].(type) {
 		case []*FML:
-			defer func() {
+			nodes = append(nodes, func() {
 				writeNodeName(fullKey, writer)
 				for i := 0; i < len(v); i++ {
+					if len(v[i].dict) == 0 {
+						//an empty item has nothing to follow the dash
+						writer.Write([]byte{'-', ' ', '\n'})
+						continue
+					}
 					writer.Write([]byte{'-', ' '})
-					v[i].writeTo(fullKey, writer)
+					v[i].writeTo(fullKey, writer, r)
 				}
-			}()
+			})
 		case *FML:
-			defer func() {
+			nodes = append(nodes, func() {
 				writeNodeName(fullKey, writer)
-				v.writeTo(fullKey, writer)
-			}()
+				v.writeTo(fullKey, writer, r)
+			})
 		default:
 			//log.Println("write",key)
 			writer.WriteString(key)
 			writer.WriteByte(':')
-			writer.WriteString(wrapVal(v))
+			writer.WriteString(r.redactVal(fullKey, v))
 			//writer.WriteString("after key value")
 			writer.WriteByte('\n')
 		}
 	}
+	for _, write := range nodes {
+		write()
+	}
 }
 
 func writeNodeName(key string, writer *bufio.Writer) {
@@ -506,14 +667,18 @@ func writeNodeName(key string, writer *bufio.Writer) {
 
 func wrapVal(val interface{}) string {
 	switch v := val.(type) {
+	case nil:
+		return "null"
 	case string:
-		return v
+		return wrapString(v)
+	case Secret:
+		return v.String()
 	case time.Time:
 		return v.Format(time.RFC3339)
 	case int:
 		return strconv.Itoa(v)
 	case float64:
-		return strconv.FormatFloat(v, 'f', -1, 64)
+		return formatFloat(v)
 	case bool:
 		return strconv.FormatBool(v)
 	case []time.Time:
@@ -545,7 +710,7 @@ func wrapVal(val interface{}) string {
 			if i > 0 {
 				s += ","
 			}
-			s += strconv.FormatFloat(v[i], 'f', -1, 64)
+			s += formatFloat(v[i])
 		}
 		s += "]"
 		return s
@@ -567,7 +732,7 @@ func wrapVal(val interface{}) string {
 			if i > 0 {
 				s += ","
 			}
-			s += v[i]
+			s += wrapArrayString(v[i])
 		}
 		s += "]"
 		return s
@@ -576,29 +741,172 @@ func wrapVal(val interface{}) string {
 	}
 }
 
+//formatFloat keeps the decimal point, so a float is not read back as an int
+func formatFloat(v float64) string {
+	s := strconv.FormatFloat(v, 'f', -1, 64)
+	if strings.IndexAny(s, ".IN") == -1 {
+		s += ".0"
+	}
+	return s
+}
+
+//wrapString quotes a string if it can not be read back as it is,
+//a multiple line string is written as a block literal if possible.
+func wrapString(s string) string {
+	if !needQuote(s) {
+		return s
+	} else if canBlock(s) {
+		return blockLiteral(s)
+	}
+	return quote(s)
+}
+
+//wrapInline wraps a value like wrapVal, except multiple line strings are quoted, so it takes a single line
+func wrapInline(val interface{}) string {
+	if s, ok := val.(string); ok && needQuote(s) {
+		return quote(s)
+	}
+	return wrapVal(val)
+}
+
+func wrapArrayString(s string) string {
+	if needQuote(s) || strings.ContainsAny(s, ",]") {
+		return quote(s)
+	}
+	return s
+}
+
+func needQuote(s string) bool {
+	l := len(s)
+	if l == 0 {
+		return true
+	}
+	switch s[0] {
+	case ' ', '\t', '"', '\'', '`', '[', '|', '>', '#':
+		return true
+	}
+	switch s[l-1] {
+	case ' ', '\t':
+		return true
+	}
+	for i := 0; i < l; i++ {
+		c := s[i]
+		if c < 0x20 || c == 0x7f || c == '\\' || (c == '#' && (s[i-1] == ' ' || s[i-1] == '\t')) {
+			return true
+		}
+	}
+	//a string looks like other types
+	_, ok := eval(s).(string)
+	return !ok
+}
+
+//quote writes a double-quoted string, see unescape.
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch r {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04x`, r)
+			} else {
+				//invalid utf-8 is kept as it is
+				b.WriteString(s[i : i+size])
+			}
+		}
+		i += size
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+//canBlock reports whether a multiple line string can be read back from a block literal
+func canBlock(s string) bool {
+	if !strings.Contains(s, "\n") || strings.HasSuffix(s, "\n\n") {
+		return false
+	}
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	first := true
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+		if strings.TrimLeft(line, " \t") == "" {
+			return false
+		}
+		if first && (line[0] == ' ' || line[0] == '\t') {
+			return false
+		}
+		first = false
+		for i := 0; i < len(line); i++ {
+			if (line[i] < 0x20 && line[i] != '\t') || line[i] == 0x7f {
+				return false
+			}
+		}
+	}
+	return !first
+}
+
+func blockLiteral(s string) string {
+	header := "|"
+	if !strings.HasSuffix(s, "\n") {
+		header = "|-"
+	}
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = "  " + line
+		}
+	}
+	return header + "\n" + strings.Join(lines, "\n")
+}
+
 //for test
+//Values found sensitive by DefaultRedactor are masked.
 func IterateFimlDoc(doc *FML) {
+	iterateFimlDoc(doc, "")
+}
+
+func iterateFimlDoc(doc *FML, path string) {
 	dict := doc.dict
 	count := len(dict)
 	fmt.Println("length of fml:", count)
 	for key := range dict {
+		fullKey := key
+		if len(path) != 0 {
+			fullKey = path + "." + key
+		}
 		switch val := dict[key].(type) {
 		case nil:
 			fmt.Println("empty value of: ", key)
 		case string:
-			fmt.Println(key, "=", val, "(string)")
+			fmt.Println(key, "=", DefaultRedactor.redactVal(fullKey, val), "(string)")
 		case *FML:
 			fmt.Println("Node:", key)
-			IterateFimlDoc(val)
+			iterateFimlDoc(val, fullKey)
 		case []*FML:
 			fmt.Println("List of nodes:", key, ",len:", len(val))
 
 			for i, v := range val {
 				fmt.Println("List ", i)
-				IterateFimlDoc(v)
+				iterateFimlDoc(v, fullKey)
 			}
 		default:
-			fmt.Println(key, "=", val, "(", reflect.TypeOf(val), ")")
+			fmt.Println(key, "=", DefaultRedactor.redactVal(fullKey, val), "(", reflect.TypeOf(val), ")")
 		}
 	}
 }
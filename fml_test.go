@@ -122,3 +122,91 @@ func TestWriterTo(t *testing.T) {
 		}*/
 	t.Log(output)
 }
+
+func TestHasAndIsNull(t *testing.T) {
+	fml := NewFml()
+	fml.SetValue("name", "Tony")
+	fml.SetValue("nickname", nil)
+
+	if !fml.Has("name") || fml.IsNull("name") {
+		t.Error("name should exist and not be null")
+	}
+	if !fml.Has("nickname") || !fml.IsNull("nickname") {
+		t.Error("nickname should exist and be null")
+	}
+	if fml.Has("age") || fml.IsNull("age") {
+		t.Error("age should not exist")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	fml := NewFml()
+	fml.SetValue("name", "Tony")
+	fml.SetValue("age", 13)
+	fml.SetValue("nickname", nil)
+
+	if name, found := fml.LookupString("name"); !found || name != "Tony" {
+		t.Error("Should find name, name:", name, "found:", found)
+	}
+	if age, found := fml.LookupInt("age"); !found || age != 13 {
+		t.Error("Should find age, age:", age, "found:", found)
+	}
+	if _, found := fml.LookupString("nickname"); found {
+		t.Error("Should NOT find a null value")
+	}
+	if _, found := fml.LookupString("age"); found || fml.GetString("age") != "" {
+		t.Error("Should NOT find an int as a string")
+	}
+	if _, found := fml.LookupBool("passed"); found {
+		t.Error("Should NOT find a missing value")
+	}
+	if val, found := fml.Lookup("nickname"); !found || val != nil {
+		t.Error("Should find a null value as it is, val:", val, "found:", found)
+	}
+}
+
+func TestGetNodeNotFound(t *testing.T) {
+	fml := NewFml()
+	fml.SetValue("empty", nil)
+
+	node, err := fml.GetNode("database")
+	if err != errValueNotFound || node != nil {
+		t.Error("Should get value not found error, err:", err)
+	}
+
+	node, err = fml.GetNode("empty")
+	if err != nil || node != nil {
+		t.Error("Should get nil node for null value, err:", err)
+	}
+
+	list, err := fml.GetNodeList("empty")
+	if err != nil || list != nil {
+		t.Error("Should get nil list for null value, err:", err)
+	}
+}
+
+func TestWrapString(t *testing.T) {
+	cases := map[string]string{
+		"plain":          "plain",
+		"123":            `"123"`,
+		"null":           `"null"`,
+		" padded":        `" padded"`,
+		"a # b":          `"a # b"`,
+		`back\slash`:     `"back\\slash"`,
+		"line1\nline2":   "|-\n  line1\n  line2",
+		"line1\nline2\n": "|\n  line1\n  line2",
+		"  indented\nx":  `"  indented\nx"`,
+	}
+	for s, shouldBe := range cases {
+		if w := wrapString(s); w != shouldBe {
+			t.Errorf("wrap %q, got %q, should be %q", s, w, shouldBe)
+		}
+		if w := wrapString(s); w[0] == '|' {
+			if val, _ := testParser.extractBlockLiteral([]byte(w)); val != s {
+				t.Errorf("block literal %q reads back %q", w, val)
+			}
+		} else if val := evalString(w); val != s {
+			t.Errorf("quoted %q reads back %q", w, val)
+		}
+	}
+}
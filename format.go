@@ -0,0 +1,391 @@
+package fml
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/fipress/fml/scanner"
+)
+
+// FormatOptions controls the style of Format.
+type FormatOptions struct {
+	// Align aligns the values of consecutive keys in a block.
+	Align bool
+	// LineWidth is the width over which an array is wrapped, one item a line, 80 by default.
+	// 0 or less never wraps.
+	LineWidth int
+	// Delimiter replaces the delimiters of keys if not 0, it must be ':' or '='.
+	Delimiter byte
+}
+
+// A FormatOption sets a formatting option.
+type FormatOption func(*FormatOptions)
+
+func defaultFormatOptions() *FormatOptions {
+	return &FormatOptions{LineWidth: 80}
+}
+
+// WithAlign aligns the values of consecutive keys in a block.
+func WithAlign() FormatOption {
+	return func(o *FormatOptions) {
+		o.Align = true
+	}
+}
+
+// WithLineWidth sets the width over which arrays are wrapped, 0 never wraps.
+func WithLineWidth(width int) FormatOption {
+	return func(o *FormatOptions) {
+		o.LineWidth = width
+	}
+}
+
+// WithKeyDelimiter makes all keys use the delimiter, ':' or '='.
+func WithKeyDelimiter(delimiter byte) FormatOption {
+	return func(o *FormatOptions) {
+		o.Delimiter = delimiter
+	}
+}
+
+var (
+	errFormatDelimiter = errors.New("format fml failed: the delimiter must be ':' or '='")
+	errFormatChanged   = errors.New("format fml failed: the formatted document differs")
+)
+
+// Format formats a fml document in the canonical style, keeping its comments:
+//
+//	[staff]
+//	- name: Abby
+//	  tags: [a, b]
+//
+// Keys are written as "key: value" or "key = value", list items as "- key: value" with the following keys
+// indented by two spaces, node headers as "[a.b : base]", and the content of block literals is indented
+// by two spaces more than its key. Other keys, node headers and comments start at the beginning of lines.
+// Arrays longer than the line width are wrapped, and runs of more than two blank lines are shortened,
+// as two of them already end a node list.
+//
+// The source must parse with the default options, otherwise the parsing error is returned.
+// Formatting a formatted document doesn't change it.
+func Format(src []byte, opts ...FormatOption) ([]byte, error) {
+	o := defaultFormatOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.Delimiter != 0 && o.Delimiter != ':' && o.Delimiter != '=' {
+		return nil, errFormatDelimiter
+	}
+
+	doc, err := Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := scanner.Scan(src)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &formatter{opts: o, src: src}
+	f.collect(tokens)
+	out := f.render()
+
+	//the formatted document must mean the same, a safety net against changing it silently
+	if formatted, err := Parse(out); err != nil || !reflect.DeepEqual(doc, formatted) {
+		return nil, errFormatChanged
+	}
+	return out, nil
+}
+
+//a fmtLine is a line of the formatted document, a key line may span lines for its value
+type fmtLine struct {
+	blank bool
+	//the content of lines other than key lines, like a node header or a comment
+	text string
+	//the prefix of a key, "", "- " for a list item or "  " for the following keys of an item
+	prefix string
+	key    string
+	delim  byte
+	//the value, the items if it is an array
+	value   string
+	items   []string
+	isArray bool
+	comment string
+	//the spaces aligning the value
+	pad int
+}
+
+func (l *fmtLine) isKey() bool {
+	return len(l.key) != 0
+}
+
+type formatter struct {
+	opts  *FormatOptions
+	src   []byte
+	lines []*fmtLine
+	//whether the next key line follows a list item
+	inItem bool
+}
+
+func (f *formatter) text(t scanner.Token) string {
+	return string(f.src[t.Start:t.End])
+}
+
+//collect turns the tokens into lines, a line ends by a newline token
+func (f *formatter) collect(tokens []scanner.Token) {
+	start := 0
+	for i, t := range tokens {
+		if t.Kind == scanner.Newline || t.Kind == scanner.EOF {
+			f.collectLine(tokens[start:i])
+			start = i + 1
+		}
+	}
+}
+
+func (f *formatter) collectLine(tokens []scanner.Token) {
+	if len(tokens) == 0 {
+		f.inItem = false
+		f.lines = append(f.lines, &fmtLine{blank: true})
+		return
+	}
+
+	switch t := tokens[0]; t.Kind {
+	case scanner.Comment:
+		f.inItem = false
+		f.lines = append(f.lines, &fmtLine{text: f.comment(t)})
+	case scanner.NodeHeader:
+		f.inItem = false
+		l := &fmtLine{text: formatHeader(f.text(t))}
+		f.lines = append(f.lines, l)
+		if len(tokens) > 1 && tokens[1].Kind == scanner.Comment {
+			l.text += " " + f.comment(tokens[1])
+		} else if len(tokens) > 1 {
+			//the content after a node header goes to the next line
+			f.collectLine(tokens[1:])
+		}
+	case scanner.ListMarker:
+		f.inItem = false
+		rest := tokens[1:]
+		switch {
+		case len(rest) == 0:
+			//an empty item needs the space after the marker
+			f.lines = append(f.lines, &fmtLine{text: "- "})
+		case rest[0].Kind == scanner.Comment:
+			f.lines = append(f.lines, &fmtLine{text: "- " + f.comment(rest[0])})
+		case rest[0].Kind == scanner.NodeHeader:
+			f.lines = append(f.lines, &fmtLine{text: "- "})
+			f.collectLine(rest)
+		default:
+			f.keyLine("- ", rest)
+			f.inItem = true
+		}
+	case scanner.Key:
+		prefix := ""
+		if f.inItem {
+			prefix = "  "
+		}
+		f.keyLine(prefix, tokens)
+	}
+}
+
+//keyLine adds a key line from the tokens of a key, its delimiter, its value and its comment
+func (f *formatter) keyLine(prefix string, tokens []scanner.Token) {
+	l := &fmtLine{prefix: prefix, key: f.text(tokens[0]), delim: f.src[tokens[1].Start]}
+	if f.opts.Delimiter != 0 {
+		l.delim = f.opts.Delimiter
+	}
+	for _, t := range tokens[2:] {
+		switch t.Kind {
+		case scanner.ArrayStart:
+			l.isArray = true
+		case scanner.Scalar, scanner.String, scanner.Literal:
+			text := f.text(t)
+			if l.isArray {
+				l.items = append(l.items, text)
+			} else if t.Kind == scanner.Literal && (text[0] == '|' || text[0] == '>') {
+				l.value = f.blockLiteral(text, len(prefix)+2)
+			} else {
+				l.value = text
+			}
+		case scanner.Comment:
+			l.comment = f.comment(t)
+		}
+	}
+	f.lines = append(f.lines, l)
+}
+
+func (f *formatter) comment(t scanner.Token) string {
+	return strings.TrimRight(f.text(t), " \t")
+}
+
+//formatHeader formats a node header like [ a . b:base ] to [a.b : base]
+func formatHeader(header string) string {
+	name := header[1 : len(header)-1]
+	base := ""
+	if i := strings.IndexByte(name, ':'); i != -1 {
+		name, base = name[:i], strings.TrimSpace(name[i+1:])
+	}
+	segs := strings.Split(name, ".")
+	for i := range segs {
+		segs[i] = strings.TrimSpace(segs[i])
+	}
+	name = strings.Join(segs, ".")
+	if len(base) != 0 {
+		name += " : " + base
+	}
+	return "[" + name + "]"
+}
+
+//blockLiteral formats a block literal, its content lines are indented by indent,
+//keeping how much more indented they are than the first one
+func (f *formatter) blockLiteral(text string, indent int) string {
+	lines := splitLines(text)
+	header := lines[0]
+	i := 1
+	if i < len(header) && header[i] == '-' {
+		i++
+	}
+	var b strings.Builder
+	b.WriteString(header[:i])
+	if rest := strings.TrimSpace(header[i:]); len(rest) != 0 {
+		b.WriteString(" " + rest)
+	}
+
+	strip := -1
+	for _, line := range lines[1:] {
+		n := len(line) - len(strings.TrimLeft(line, " \t"))
+		b.WriteByte('\n')
+		if n == len(line) {
+			continue
+		}
+		if strip == -1 {
+			strip = n
+		}
+		b.WriteString(strings.Repeat(" ", indent))
+		b.WriteString(line[strip:])
+	}
+	return b.String()
+}
+
+//splitLines splits text by line ends, "\r\n" is a single one
+func splitLines(text string) (lines []string) {
+	start := 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\r', '\n', '\f':
+			lines = append(lines, text[start:i])
+			if text[i] == '\r' && i+1 < len(text) && text[i+1] == '\n' {
+				i++
+			}
+			start = i + 1
+		}
+	}
+	return append(lines, text[start:])
+}
+
+func (f *formatter) render() []byte {
+	if f.opts.Align {
+		f.align()
+	}
+
+	var b strings.Builder
+	blanks := 0
+	for _, l := range f.lines {
+		if l.blank {
+			blanks++
+			continue
+		}
+		//leading blank lines are dropped, and runs of them shortened
+		if b.Len() != 0 {
+			if blanks > 2 {
+				blanks = 2
+			}
+			b.WriteString(strings.Repeat("\n", blanks))
+		}
+		blanks = 0
+
+		if l.isKey() {
+			f.renderKey(&b, l)
+		} else {
+			b.WriteString(l.text)
+		}
+		b.WriteByte('\n')
+	}
+	return []byte(b.String())
+}
+
+func (f *formatter) renderKey(b *strings.Builder, l *fmtLine) {
+	first := l.prefix + l.key
+	hasValue := l.isArray || len(l.value) != 0
+	pad := ""
+	if hasValue {
+		pad = strings.Repeat(" ", l.pad)
+	}
+	if l.delim == '=' && l.key != "-" {
+		first += pad + " ="
+	} else if l.delim == '=' {
+		//"- =" would start a list item
+		first += "=" + pad
+	} else {
+		first += ":" + pad
+	}
+
+	value := l.value
+	if l.isArray {
+		value = "[" + strings.Join(l.items, ", ") + "]"
+		width := utf8.RuneCountInString(first) + 1 + utf8.RuneCountInString(value)
+		if f.opts.LineWidth > 0 && width > f.opts.LineWidth {
+			value = wrapArray(l.items, len(l.prefix))
+		}
+	}
+
+	b.WriteString(first)
+	if hasValue {
+		b.WriteString(" " + value)
+	}
+	if len(l.comment) != 0 {
+		b.WriteString(" " + l.comment)
+	}
+}
+
+//wrapArray writes the items of an array a line each, indented by two spaces more than the key
+func wrapArray(items []string, indent int) string {
+	var b strings.Builder
+	b.WriteString("[\n")
+	for i, item := range items {
+		b.WriteString(strings.Repeat(" ", indent+2))
+		b.WriteString(item)
+		if i < len(items)-1 {
+			b.WriteByte(',')
+		}
+		b.WriteByte('\n')
+	}
+	b.WriteString(strings.Repeat(" ", indent) + "]")
+	return b.String()
+}
+
+//align pads the keys of consecutive key lines, so their values start at the same column.
+//A list item starts a new group.
+func (f *formatter) align() {
+	var group []*fmtLine
+	flush := func() {
+		width := 0
+		for _, l := range group {
+			if n := utf8.RuneCountInString(l.key); n > width {
+				width = n
+			}
+		}
+		for _, l := range group {
+			l.pad = width - utf8.RuneCountInString(l.key)
+		}
+		group = group[:0]
+	}
+	for _, l := range f.lines {
+		if !l.isKey() || l.prefix == "- " {
+			flush()
+		}
+		if l.isKey() {
+			group = append(group, l)
+		}
+	}
+	flush()
+}
@@ -0,0 +1,44 @@
+package fml
+
+import (
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	cases := []struct {
+		input, expected string
+		opts            []FormatOption
+	}{
+		{"a:1\nb =  2 # two  \n", "a: 1\nb = 2 # two\n", nil},
+		{"\n\n# top\n[ base ]\nport:1\n\n[ db . main:base ]   # the db\nhost :local\n",
+			"# top\n[base]\nport: 1\n\n[db.main : base] # the db\nhost: local\n", nil},
+		{"[staff]\n  - name:Abby\n      age:12\n-   name:Tony\n\n\n\n[x] y:1\n",
+			"[staff]\n- name: Abby\n  age: 12\n- name: Tony\n\n\n[x]\ny: 1\n", nil},
+		{"sql: |- # query\n      SELECT *\n\n        FROM t\nnext:1\n", "sql: |- # query\n  SELECT *\n\n    FROM t\nnext: 1\n", nil},
+		{"tags:[ a,b ,  \"c, d\"]\n", "tags: [a, b, \"c, d\"]\n", nil},
+		{"a:[]\nb: [ \n ]\n", "a: []\nb: []\n", nil},
+		{"tags:[aaaa,bbbb,cccc] # long\n", "tags: [\n  aaaa,\n  bbbb,\n  cccc\n] # long\n", []FormatOption{WithLineWidth(20)}},
+		{"name: a\nlonger: b\n\n[n]\n- x: 1\n  yy:\n  zzz: 3\n", "name:   a\nlonger: b\n\n[n]\n- x:   1\n  yy:\n  zzz: 3\n", []FormatOption{WithAlign()}},
+		{"a = 1\nbb: 2\n", "a  = 1\nbb = 2\n", []FormatOption{WithAlign(), WithKeyDelimiter('=')}},
+		{"[n]\n-: 1\n", "[n]\n-= 1\n", []FormatOption{WithKeyDelimiter('=')}},
+		{"[n]\n- \n- # empty\n- a: 1\n", "[n]\n- \n- # empty\n- a: 1\n", nil},
+	}
+	for _, c := range cases {
+		out, err := Format([]byte(c.input), c.opts...)
+		if err != nil || string(out) != c.expected {
+			t.Errorf("Should format %q\nexpected: %q\ngot: %q, err: %v", c.input, c.expected, out, err)
+			continue
+		}
+		again, _ := Format(out, c.opts...)
+		if string(again) != string(out) {
+			t.Errorf("Should be idempotent, got: %q", again)
+		}
+	}
+
+	if _, err := Format([]byte("a: \"open\n")); err == nil {
+		t.Error("Should fail on invalid input")
+	}
+	if _, err := Format([]byte("a: 1\n"), WithKeyDelimiter('-')); err == nil {
+		t.Error("Should reject an invalid delimiter")
+	}
+}
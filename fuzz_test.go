@@ -0,0 +1,196 @@
+package fml
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var fuzzSeeds = []string{
+	"title: Scala Basic\ntoclevel: 2\nforceProcess: true\n",
+	"name=Jimmy\nAge=15",
+	"[database]\nhost:local\nport:1433\n",
+	"[staff]\n- name: Abby\n  age: 12\n- name: Tony\n  age: 13\n",
+	"content: [\n$cover,\ncontent/$lang/preface\n]\n",
+	"list: [1.5, 2.5]\ndates: [2014-07-06, 2014-07-07T12:03:31Z]\n",
+	"text: \"tab\\t \\u00e9\"\nraw: 'a # b'\nempty:\nnull: null\n",
+	"sql: |\n  SELECT *\n    FROM t\nnext: >-\n  a\n  b\n",
+	"lit: ```a\nb```\none: `x`\n",
+	"[prod : base]\nhost: p\n\n[base]\nport: 1\n",
+	"[db@prod]\nhost: p\nport@prod: 2\n",
+	"[a.b.c]\nd: 1\n\n[a]\n",
+	"secret: enc:aes:abc\n# comment\n",
+	//found by fuzzing
+	"0:\x1b\xbb0",
+	"0:+0",
+	"0:00.",
+	"[.0]",
+	"\v:",
+	"[0]-  ",
+	"[0]\n- ",
+	"0:\"\xa0\"",
+	"\v#00:",
+	"0:>0",
+	"[0]-:",
+	"[000]- \n- ",
+	"0:[\v ]",
+	"0:[a,\u00a0]",
+}
+
+// checkParseError fails on errors from bugs rather than from invalid input
+func checkParseError(t *testing.T, err error) {
+	if err != nil && strings.Contains(err.Error(), "runtime error") {
+		t.Fatal(err)
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, input []byte) {
+		_, err := ParseWithOptions(input, WithProfiles("prod", "dev"), WithProfile("prod"))
+		checkParseError(t, err)
+		doc, err := Parse(input)
+		checkParseError(t, err)
+		if err == nil {
+			for _, key := range doc.KeySet() {
+				doc.GetString(key)
+				doc.GetInt(key)
+				doc.GetTimeArray(key)
+				doc.GetNodeList(key)
+			}
+		}
+	})
+}
+
+func FuzzUnmarshal(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add([]byte(seed))
+	}
+	type Item struct {
+		Name string
+		Age  *int
+	}
+	type Config struct {
+		Title    string
+		Toclevel uint8
+		Port     int16
+		Ratio    float32
+		Passed   *bool
+		Date     time.Time
+		Database struct {
+			Host string
+			Port int
+		}
+		Staff *Item
+		Null  *string
+	}
+	f.Fuzz(func(t *testing.T, input []byte) {
+		err := Unmarshal(input, new(Config))
+		checkParseError(t, err)
+	})
+}
+
+func FuzzWriteRoundTrip(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, input []byte) {
+		doc, err := Parse(input)
+		if err != nil {
+			return
+		}
+
+		buf := &bytes.Buffer{}
+		writer := bufio.NewWriter(buf)
+		doc.WriteTo(writer)
+		writer.Flush()
+
+		doc2, err := Parse(buf.Bytes())
+		if err != nil {
+			t.Fatalf("Should parse written document, err: %v\ninput: %q\nwritten: %q", err, input, buf.String())
+		}
+		if !reflect.DeepEqual(doc, doc2) {
+			t.Fatalf("Should read back the same document\ninput: %q\nwritten: %q", input, buf.String())
+		}
+	})
+}
+
+func FuzzFormat(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, input []byte) {
+		if _, err := Parse(input); err != nil {
+			return
+		}
+		for _, opts := range [][]FormatOption{nil, {WithAlign(), WithLineWidth(10), WithKeyDelimiter('=')}} {
+			out, err := Format(input, opts...)
+			if err != nil {
+				t.Fatalf("Should format, err: %v\ninput: %q", err, input)
+			}
+			again, err := Format(out, opts...)
+			if err != nil || !bytes.Equal(out, again) {
+				t.Fatalf("Should be idempotent, err: %v\ninput: %q\nformatted: %q\nagain: %q", err, input, out, again)
+			}
+		}
+	})
+}
+
+func FuzzPatch(f *testing.F) {
+	for i, seed := range fuzzSeeds {
+		f.Add([]byte(seed), []byte(fuzzSeeds[(i+1)%len(fuzzSeeds)]), i%2 == 0)
+	}
+	//found by fuzzing
+	f.Add([]byte("[staff]- name:Aaff]"), []byte("[staff]- name:Aaff].00"), true)
+	f.Add([]byte(""), []byte("0:[]"), false)
+	f.Fuzz(func(t *testing.T, a, b []byte, byName bool) {
+		docA, err := Parse(a)
+		if err != nil {
+			return
+		}
+		docB, err := Parse(b)
+		if err != nil || !pathKeys(docA) || !pathKeys(docB) {
+			return
+		}
+		var opts []DiffOption
+		if byName {
+			opts = append(opts, WithIdentityKey("name"))
+		}
+		p := NewPatch(Diff(docA, docB, opts...))
+		if err = docA.ApplyPatch(p); err != nil {
+			t.Fatalf("Should apply the diff, err: %v\na: %q\nb: %q", err, a, b)
+		}
+		if changes := Diff(docA, docB); len(changes) != 0 {
+			t.Fatalf("Should get the new document, got: %v\na: %q\nb: %q", changes, a, b)
+		}
+		//the source may not take the patch in place, but it must not break
+		PatchSource(a, p)
+	})
+}
+
+//pathKeys reports whether all keys can be in key paths
+func pathKeys(doc *FML) bool {
+	for k, v := range doc.dict {
+		if strings.ContainsAny(k, ".[]") {
+			return false
+		}
+		switch node := v.(type) {
+		case *FML:
+			if !pathKeys(node) {
+				return false
+			}
+		case []*FML:
+			for _, item := range node {
+				if !pathKeys(item) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
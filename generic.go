@@ -0,0 +1,202 @@
+package fml
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"time"
+)
+
+var (
+	errOutOfRange = errors.New("value out of range")
+
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// Get gets a value of the path from the document as T, converted the same way as the getters.
+// T can be any scalar type, like int64, uint8, float32 or time.Duration from a string like "1m30s",
+// or a string from any scalar, written as it is in fml like "8080",
+// a slice of any T from an array or a node list, a map from string to any T from a node,
+// a struct from a node, decoded like GetStruct, or a pointer to any T, which is nil if the value is null.
+// interface{} gets natural Go types like ToMap.
+// Values out of the range of T, like 300 as uint8, are errors.
+// Types with decode hooks, or implementing Unmarshaler or encoding.TextUnmarshaler, are decoded by them.
+//
+//	port, err := fml.Get[uint16](doc, "server.port")
+//	timeout, err := fml.Get[time.Duration](doc, "server.timeout")
+//	staff, err := fml.Get[[]Staff](doc, "staff")
+func Get[T any](doc *FML, path string) (val T, err error) {
+	raw, err := doc.decodedVal(path)
+	if err != nil {
+		return
+	}
+
+	err = convertValue(reflect.ValueOf(&val).Elem(), raw)
+	return
+}
+
+// GetOr gets a value of the path from the document as T like Get,
+// or return defaultVal if the key does not exist or other error happens.
+func GetOr[T any](doc *FML, path string, defaultVal T) T {
+	val, err := Get[T](doc, path)
+	if err != nil {
+		return defaultVal
+	}
+	return val
+}
+
+// GetSlice gets an array or a node list of the path from the document as a slice of T, see Get.
+func GetSlice[T any](doc *FML, path string) ([]T, error) {
+	return Get[[]T](doc, path)
+}
+
+//convertValue sets the value to out, converting it to the type of out
+func convertValue(out reflect.Value, val interface{}) (err error) {
+	if val, err = reveal(val); err != nil {
+		return
+	}
+	if ok, err := decodeCustom(out, val); ok {
+		return err
+	}
+	t := out.Type()
+	if t.Kind() == reflect.Interface && t.NumMethod() == 0 {
+		if val != nil {
+			out.Set(reflect.ValueOf(naturalValue(val)))
+		} else {
+			out.Set(reflect.Zero(t))
+		}
+		return
+	}
+	if val != nil && reflect.TypeOf(val).AssignableTo(t) {
+		out.Set(reflect.ValueOf(val))
+		return
+	}
+
+	switch {
+	case t.Kind() == reflect.Ptr:
+		if val == nil {
+			out.Set(reflect.Zero(t))
+			return
+		}
+		ptr := reflect.New(t.Elem())
+		if err = convertValue(ptr.Elem(), val); err == nil {
+			out.Set(ptr)
+		}
+		return
+	case val == nil:
+		return errValueNotFound
+	case t == durationType:
+		return convertDuration(out, val)
+	case t == timeType:
+		var v time.Time
+		if v, err = getTime(val); err == nil {
+			out.Set(reflect.ValueOf(v))
+		}
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		var s string
+		if s, err = scalarString(val); err == nil {
+			out.SetString(s)
+		}
+	case reflect.Bool:
+		var b bool
+		if b, err = getBool(val); err == nil {
+			out.SetBool(b)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int
+		if i, err = getInt(val); err == nil {
+			if out.OverflowInt(int64(i)) {
+				return errOutOfRange
+			}
+			out.SetInt(int64(i))
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var i int
+		if i, err = getInt(val); err == nil {
+			if i < 0 || out.OverflowUint(uint64(i)) {
+				return errOutOfRange
+			}
+			out.SetUint(uint64(i))
+		}
+	case reflect.Float32, reflect.Float64:
+		var fl float64
+		if fl, err = getFloat(val); err == nil {
+			if !math.IsInf(fl, 0) && out.OverflowFloat(fl) {
+				return errOutOfRange
+			}
+			out.SetFloat(fl)
+		}
+	case reflect.Interface:
+		//only interfaces the value doesn't implement get here
+		if node, ok := val.(*FML); ok && getVariants(t) != nil {
+			return new(decoder).decodeVariant(out, getVariants(t), node, "")
+		}
+		return errTypeMismatch
+	case reflect.Slice:
+		return convertSlice(out, val)
+	case reflect.Map:
+		return convertMap(out, val)
+	case reflect.Struct:
+		node, ok := val.(*FML)
+		if !ok {
+			return errTypeMismatch
+		}
+		return getStruct(node, out.Addr().Interface())
+	default:
+		return errTypeMismatch
+	}
+	return
+}
+
+//convertDuration parses a duration from a string like "1m30s"
+func convertDuration(out reflect.Value, val interface{}) error {
+	s, ok := val.(string)
+	if !ok {
+		return errTypeMismatch
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return errTypeMismatch
+	}
+	out.SetInt(int64(d))
+	return nil
+}
+
+//convertSlice converts an array or a node list item by item
+func convertSlice(out reflect.Value, val interface{}) error {
+	rv := reflect.ValueOf(val)
+	if rv.Kind() != reflect.Slice {
+		return errTypeMismatch
+	}
+	slice := reflect.MakeSlice(out.Type(), rv.Len(), rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		if err := convertValue(slice.Index(i), rv.Index(i).Interface()); err != nil {
+			return err
+		}
+	}
+	out.Set(slice)
+	return nil
+}
+
+//convertMap converts a node to a map keyed by its keys
+func convertMap(out reflect.Value, val interface{}) error {
+	node, ok := val.(*FML)
+	t := out.Type()
+	if !ok || t.Key().Kind() != reflect.String {
+		return errTypeMismatch
+	}
+	m := reflect.MakeMapWithSize(t, len(node.dict))
+	for k, v := range node.dict {
+		item := reflect.New(t.Elem()).Elem()
+		if err := convertValue(item, v); err != nil {
+			return err
+		}
+		m.SetMapIndex(reflect.ValueOf(k).Convert(t.Key()), item)
+	}
+	out.Set(m)
+	return nil
+}
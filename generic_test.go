@@ -0,0 +1,105 @@
+package fml
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetGeneric(t *testing.T) {
+	doc, _ := ParseString(`port: 8080
+ratio: 0.5
+big: 300
+neg: -1
+timeout: 1m30s
+debug: true
+tags: [a, b]
+ids: [1, 2]
+
+[limits]
+cpu: 2
+mem: 4
+
+[staff]
+- name: Abby
+  age: 20
+- name: Tony
+  age: 30
+`)
+
+	if port, err := Get[uint16](doc, "port"); err != nil || port != 8080 {
+		t.Error("Should get uint16, got:", port, err)
+	}
+	if port, err := Get[int64](doc, "port"); err != nil || port != 8080 {
+		t.Error("Should get int64, got:", port, err)
+	}
+	if ratio, err := Get[float32](doc, "ratio"); err != nil || ratio != 0.5 {
+		t.Error("Should get float32, got:", ratio, err)
+	}
+	if timeout, err := Get[time.Duration](doc, "timeout"); err != nil || timeout != 90*time.Second {
+		t.Error("Should get duration, got:", timeout, err)
+	}
+	if debug, err := Get[bool](doc, "debug"); err != nil || !debug {
+		t.Error("Should get bool, got:", debug, err)
+	}
+	if _, err := Get[uint8](doc, "big"); err != errOutOfRange {
+		t.Error("Should fail for values out of range, got:", err)
+	}
+	if _, err := Get[uint](doc, "neg"); err != errOutOfRange {
+		t.Error("Should fail for negative uint, got:", err)
+	}
+	if _, err := Get[int](doc, "tags"); err != errTypeMismatch {
+		t.Error("Should fail for mismatched types, got:", err)
+	}
+	if _, err := Get[int](doc, "missing"); err != errValueNotFound {
+		t.Error("Should fail for missing keys, got:", err)
+	}
+
+	doc.SetValue("nothing", nil)
+	if p, err := Get[*int](doc, "nothing"); err != nil || p != nil {
+		t.Error("Should get a nil pointer for null, got:", p, err)
+	}
+	if p, err := Get[*int](doc, "port"); err != nil || *p != 8080 {
+		t.Error("Should get a pointer, got:", p, err)
+	}
+	if v, err := Get[interface{}](doc, "tags"); err != nil || len(v.([]interface{})) != 2 {
+		t.Error("Should get natural types, got:", v, err)
+	}
+
+	if ids, err := GetSlice[int64](doc, "ids"); err != nil || len(ids) != 2 || ids[1] != 2 {
+		t.Error("Should get a slice, got:", ids, err)
+	}
+	if tags, err := Get[[]string](doc, "tags"); err != nil || tags[0] != "a" {
+		t.Error("Should get a slice of string, got:", tags, err)
+	}
+
+	limits, err := Get[map[string]uint](doc, "limits")
+	if err != nil || len(limits) != 2 || limits["mem"] != 4 {
+		t.Error("Should get a map, got:", limits, err)
+	}
+
+	type person struct {
+		Name string
+		Age  int
+	}
+	staff, err := GetSlice[person](doc, "staff")
+	if err != nil || len(staff) != 2 || staff[1].Name != "Tony" || staff[1].Age != 30 {
+		t.Error("Should get a slice of structs, got:", staff, err)
+	}
+	maps, err := GetSlice[map[string]string](doc, "staff")
+	if err != nil || maps[0]["age"] != "20" {
+		t.Error("Should get a slice of maps, got:", maps, err)
+	}
+}
+
+func TestGetOr(t *testing.T) {
+	doc, _ := ParseString("port: 8080\nname: fml\n")
+	if GetOr(doc, "port", 80) != 8080 {
+		t.Error("Should get the value")
+	}
+	if GetOr(doc, "missing", 80) != 80 || GetOr[uint8](doc, "port", 1) != 1 || GetOr(doc, "name", 2) != 2 {
+		t.Error("Should get the default value")
+	}
+	if GetOr(doc, "timeout", 3*time.Second) != 3*time.Second {
+		t.Error("Should get the default duration")
+	}
+}
@@ -0,0 +1,105 @@
+package fml
+
+import (
+	"encoding"
+	"reflect"
+	"sync"
+)
+
+// An Unmarshaler decodes itself from a fml value, which is as it is in the document,
+// like a string, an int, a []string, a *FML for a node or a []*FML for a node list, or nil if it is null.
+// Sealed secrets are opened before.
+type Unmarshaler interface {
+	UnmarshalFML(val interface{}) error
+}
+
+// A Marshaler encodes itself to a fml value, like a string, an int, a []string, a *FML for a node,
+// a []*FML for a node list, or nil for null.
+type Marshaler interface {
+	MarshalFML() (interface{}, error)
+}
+
+// A DecodeHook decodes a value of the type it is registered for from a fml value, see Unmarshaler.
+type DecodeHook func(val interface{}) (interface{}, error)
+
+var (
+	hooksMu     sync.RWMutex
+	decodeHooks = make(map[reflect.Type]DecodeHook)
+
+	unmarshalerType     = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// RegisterDecodeHook makes values of the type decoded by the hook, for types which can't implement Unmarshaler,
+// like types of other packages:
+//
+//	fml.RegisterDecodeHook(reflect.TypeOf(url.URL{}), func(val interface{}) (interface{}, error) {
+//		s, _ := val.(string)
+//		u, err := url.Parse(s)
+//		if err != nil {
+//			return nil, err
+//		}
+//		return *u, nil
+//	})
+//
+// A hook is preferred to the methods of the type. Registering a nil hook removes the hook of the type.
+func RegisterDecodeHook(t reflect.Type, hook DecodeHook) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	if hook == nil {
+		delete(decodeHooks, t)
+	} else {
+		decodeHooks[t] = hook
+	}
+}
+
+func getDecodeHook(t reflect.Type) DecodeHook {
+	hooksMu.RLock()
+	defer hooksMu.RUnlock()
+	return decodeHooks[t]
+}
+
+//decodeCustom decodes the value by the hook of the type of out, or its UnmarshalFML or UnmarshalText method.
+//It reports false if the type has none of them, time.Time is decoded as usual.
+func decodeCustom(out reflect.Value, val interface{}) (bool, error) {
+	t := out.Type()
+	hook := getDecodeHook(t)
+	isUnmarshaler := out.CanAddr() && reflect.PtrTo(t).Implements(unmarshalerType)
+	isText := out.CanAddr() && t != timeType && reflect.PtrTo(t).Implements(textUnmarshalerType)
+	if hook == nil && !isUnmarshaler && !isText {
+		return false, nil
+	}
+
+	val, err := reveal(val)
+	if err != nil {
+		return true, err
+	}
+	switch {
+	case hook != nil:
+		v, err := hook(val)
+		if err != nil {
+			return true, err
+		}
+		rv := reflect.ValueOf(v)
+		if !rv.IsValid() {
+			out.Set(reflect.Zero(t))
+		} else if rv.Type().AssignableTo(t) {
+			out.Set(rv)
+		} else {
+			return true, errTypeMismatch
+		}
+	case isUnmarshaler:
+		return true, out.Addr().Interface().(Unmarshaler).UnmarshalFML(val)
+	default:
+		if _, ok := val.(*FML); ok {
+			//a struct decoded from a node key by key
+			return false, nil
+		}
+		s, err := scalarString(val)
+		if err != nil {
+			return true, err
+		}
+		return true, out.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+	return true, nil
+}
@@ -0,0 +1,118 @@
+package fml
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type level int
+
+func (l *level) UnmarshalText(text []byte) error {
+	switch strings.ToLower(string(text)) {
+	case "debug":
+		*l = 0
+	case "info":
+		*l = 1
+	default:
+		return errors.New("unknown level " + string(text))
+	}
+	return nil
+}
+
+func (l level) MarshalText() ([]byte, error) {
+	return []byte([]string{"debug", "info"}[l]), nil
+}
+
+//endpoint decodes itself from "host:port" or a node
+type endpoint struct {
+	Host string
+	Port int
+}
+
+func (e *endpoint) UnmarshalFML(val interface{}) error {
+	switch v := val.(type) {
+	case string:
+		host, port, err := net.SplitHostPort(v)
+		if err != nil {
+			return err
+		}
+		e.Host = host
+		e.Port, err = strconv.Atoi(port)
+		return err
+	case *FML:
+		e.Host, e.Port = v.GetString("host"), v.GetInt("port")
+		return nil
+	}
+	return errTypeMismatch
+}
+
+func (e endpoint) MarshalFML() (interface{}, error) {
+	return e.Host + ":" + wrapVal(e.Port), nil
+}
+
+func TestUnmarshalHooks(t *testing.T) {
+	RegisterDecodeHook(reflect.TypeOf(url.URL{}), func(val interface{}) (interface{}, error) {
+		s, _ := val.(string)
+		u, err := url.Parse(s)
+		if err != nil {
+			return nil, err
+		}
+		return *u, nil
+	})
+	defer RegisterDecodeHook(reflect.TypeOf(url.URL{}), nil)
+
+	type config struct {
+		IP       net.IP `fml:"ip"`
+		Level    level
+		Levels   *level
+		Home     *url.URL
+		Primary  endpoint
+		Replica  endpoint
+		Fallback *endpoint
+	}
+	var c config
+	err := UnmarshalString(`ip: 10.0.0.1
+level: info
+levels: debug
+home: https://fipress.org/fml
+primary: db1:5432
+fallback: db3:80
+
+[replica]
+host: db2
+port: 5433
+`, &c)
+	if err != nil {
+		t.Fatal("Unmarshal failed:", err)
+	}
+	if !c.IP.Equal(net.IPv4(10, 0, 0, 1)) || c.Level != 1 || c.Levels == nil || *c.Levels != 0 {
+		t.Error("Should decode by UnmarshalText, got:", c)
+	}
+	if c.Home == nil || c.Home.Host != "fipress.org" {
+		t.Error("Should decode by the hook, got:", c.Home)
+	}
+	if c.Primary != (endpoint{"db1", 5432}) || c.Replica != (endpoint{"db2", 5433}) ||
+		c.Fallback == nil || *c.Fallback != (endpoint{"db3", 80}) {
+		t.Error("Should decode by UnmarshalFML, got:", c.Primary, c.Replica, c.Fallback)
+	}
+
+	if err = UnmarshalString("level: trace", &c); err == nil || !strings.Contains(err.Error(), "trace") {
+		t.Error("Should return the error of UnmarshalText, got:", err)
+	}
+	if err = UnmarshalString("primary: db1", &c); err == nil {
+		t.Error("Should return the error of UnmarshalFML")
+	}
+
+	doc, _ := ParseString("levels: [debug, info]\nip: 10.0.0.2\n")
+	if levels, err := GetSlice[level](doc, "levels"); err != nil || len(levels) != 2 || levels[1] != 1 {
+		t.Error("Should get values by UnmarshalText, got:", levels, err)
+	}
+	if ip, err := Get[net.IP](doc, "ip"); err != nil || ip.String() != "10.0.0.2" {
+		t.Error("Should get a net.IP, got:", ip, err)
+	}
+}
@@ -0,0 +1,104 @@
+package fml
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+var errDuplicateIndex = errors.New("duplicate index value")
+
+// GetNodeListIndex gets a node list from the node, indexed by the value of the field of its items:
+//
+//	[lang]
+//	- code: zh
+//	  name: 中文
+//	- code: en
+//	  name: English
+//
+// doc.GetNodeListIndex("lang", "code") gets the items by "zh" and "en". Items without a value of the field,
+// or sharing one, are errors. It returns a nil map without error if the value is null.
+func (f *FML) GetNodeListIndex(key, field string) (index map[string]*FML, err error) {
+	f.rlock()
+	defer f.runlock()
+	raw, err := f.rawVal(key)
+	if err != nil {
+		return
+	}
+
+	switch list := raw.(type) {
+	case []*FML:
+		index = make(map[string]*FML, len(list))
+		for _, item := range list {
+			id, err := indexValue(item, field)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := index[id]; ok {
+				return nil, errDuplicateIndex
+			}
+			index[id] = item
+		}
+	case nil:
+	default:
+		err = errTypeMismatch
+	}
+	return
+}
+
+// GetNodeListIndex gets a node list from the snapshot indexed by the value of the field of its items,
+// see FML.GetNodeListIndex.
+func (s *Snapshot) GetNodeListIndex(key, field string) (map[string]*Snapshot, error) {
+	index, err := s.doc.GetNodeListIndex(key, field)
+	if err != nil || index == nil {
+		return nil, err
+	}
+	snaps := make(map[string]*Snapshot, len(index))
+	for id, item := range index {
+		snaps[id] = &Snapshot{doc: item}
+	}
+	return snaps, nil
+}
+
+//indexValue gets the value of the field of an item as a string, it must be a scalar
+func indexValue(item *FML, field string) (string, error) {
+	v, ok := item.dict[item.normalizeKey(field)]
+	if !ok || v == nil {
+		return "", errValueNotFound
+	}
+	if !isScalar(v) {
+		return "", errTypeMismatch
+	}
+	return scalarString(v)
+}
+
+//decodeIndex decodes a node list of the path into a map, keyed by the value of the field of the items,
+//for fields tagged like `fml:"lang,key=code"`
+func (d *decoder) decodeIndex(out reflect.Value, list []*FML, field, path string) error {
+	t := out.Type()
+	if t.Key().Kind() != reflect.String {
+		return &FieldError{Path: path, Line: d.line(path), Msg: "is indexed by " + field + ", index maps must have string keys"}
+	}
+	m := reflect.MakeMapWithSize(t, len(list))
+	for i, item := range list {
+		itemPath := fmt.Sprintf("%s[%d]", path, i)
+		id, err := indexValue(item, field)
+		if err != nil {
+			return &FieldError{Path: itemPath, Line: d.line(itemPath), Msg: "has no index value of " + field}
+		}
+		key := reflect.ValueOf(id).Convert(t.Key())
+		if m.MapIndex(key).IsValid() {
+			return &FieldError{Path: itemPath, Line: d.line(itemPath), Msg: "has a duplicate index value " + field + "=" + id}
+		}
+
+		val := reflect.New(t.Elem()).Elem()
+		if t.Elem() == nodeType {
+			val.Set(reflect.ValueOf(item))
+		} else if err = d.setField(val, item, itemPath); err != nil {
+			return err
+		}
+		m.SetMapIndex(key, val)
+	}
+	out.Set(m)
+	return nil
+}
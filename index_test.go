@@ -0,0 +1,91 @@
+package fml
+
+import (
+	"errors"
+	"testing"
+)
+
+const langInput = `name: book
+
+[lang]
+- code: zh
+  name: 中文
+- code: en
+  name: English
+
+[meta]
+author: Abby
+pages: 120
+`
+
+func TestGetNodeListIndex(t *testing.T) {
+	doc, _ := ParseString(langInput)
+	index, err := doc.GetNodeListIndex("lang", "code")
+	if err != nil || len(index) != 2 || index["en"].GetString("name") != "English" {
+		t.Error("Should index the items, got:", index, err)
+	}
+	if _, err = doc.GetNodeListIndex("lang", "name2"); err != errValueNotFound {
+		t.Error("Should fail for items without the field, got:", err)
+	}
+	if _, err = doc.GetNodeListIndex("meta", "code"); err != errTypeMismatch {
+		t.Error("Should fail for nodes, got:", err)
+	}
+
+	dup, _ := ParseString("[lang]\n- code: zh\n- code: zh\n")
+	if _, err = dup.GetNodeListIndex("lang", "code"); err != errDuplicateIndex {
+		t.Error("Should fail for duplicate values, got:", err)
+	}
+
+	snaps, err := doc.Freeze().GetNodeListIndex("lang", "code")
+	if err != nil || snaps["zh"].GetString("name") != "中文" {
+		t.Error("Should index the items of a snapshot, got:", snaps, err)
+	}
+}
+
+func TestUnmarshalIndex(t *testing.T) {
+	type lang struct {
+		Code string `fml:"code"`
+		Name string `fml:"name" required:"true"`
+	}
+	var book struct {
+		Lang  map[string]lang        `fml:"lang,key=code"`
+		Nodes map[string]*FML        `fml:"lang2,key=code"`
+		Meta  map[string]string      `fml:"meta"`
+		Any   map[string]interface{} `fml:"any"`
+	}
+	err := UnmarshalString(langInput+"\n[lang2]\n- code: x\n\n\n[any]\nn: 1\nok: true\n", &book)
+	if err != nil {
+		t.Fatal("Unmarshal failed:", err)
+	}
+	if len(book.Lang) != 2 || book.Lang["zh"] != (lang{"zh", "中文"}) || book.Nodes["x"] == nil {
+		t.Error("Should decode a node list into a map, got:", book.Lang, book.Nodes)
+	}
+	if book.Meta["author"] != "Abby" || book.Meta["pages"] != "120" {
+		t.Error("Should decode a node into a map, got:", book.Meta)
+	}
+	if book.Any["n"] != 1 || book.Any["ok"] != true {
+		t.Error("Should decode a node into a map of any values, got:", book.Any)
+	}
+
+	var fe *FieldError
+	err = UnmarshalString("[lang]\n- code: zh\n  name: a\n- code: zh\n  name: b\n", &book)
+	if !errors.As(err, &fe) || fe.Path != "lang[1]" || fe.Line != 4 {
+		t.Error("Should fail for duplicate values, got:", err)
+	}
+	err = UnmarshalString("[lang]\n- code: zh\n  name: a\n- name: b\n", &book)
+	if !errors.As(err, &fe) || fe.Path != "lang[1]" || fe.Msg != "has no index value of code" {
+		t.Error("Should fail for items without the value, got:", err)
+	}
+	err = UnmarshalString("[lang]\n- code: zh\n", &book)
+	if !errors.As(err, &fe) || fe.Path != "lang[0].name" || fe.Line != 2 {
+		t.Error("Should check the tags of items, got:", err)
+	}
+
+	var byID struct {
+		Lang map[int]lang `fml:"lang,key=code"`
+	}
+	err = UnmarshalString(langInput, &byID)
+	if !errors.As(err, &fe) || fe.Path != "lang" || fe.Line != 3 || fe.Msg != "is indexed by code, index maps must have string keys" {
+		t.Error("Should fail for maps without string keys, got:", err)
+	}
+}
@@ -0,0 +1,84 @@
+package fml
+
+const (
+	baseNotFound = "base node not found: "
+	inheritCycle = "inheritance cycle at node: "
+)
+
+// An extension records a node inheriting a base node, like [prod : base]
+type extension struct {
+	path string
+	base string
+}
+
+func (p *parser) addExtension(node *FML, path, base string) {
+	if len(base) == 0 {
+		return
+	}
+	if p.extensions == nil {
+		p.extensions = make(map[*FML]extension)
+	}
+	p.extensions[node] = extension{path: path, base: base}
+}
+
+// resolveExtensions merges the base nodes into the nodes inheriting them.
+// It runs after the whole document is parsed, so a base node can be defined anywhere.
+func (p *parser) resolveExtensions(doc *FML) {
+	resolved := make(map[*FML]bool)
+	for node := range p.extensions {
+		p.resolveExtension(doc, node, resolved, make(map[*FML]bool))
+	}
+}
+
+func (p *parser) resolveExtension(doc *FML, node *FML, resolved, visiting map[*FML]bool) {
+	ext, ok := p.extensions[node]
+	if !ok || resolved[node] {
+		return
+	}
+	if visiting[node] {
+		panic(inheritCycle + ext.path)
+	}
+	visiting[node] = true
+
+	base, err := doc.GetNode(ext.base)
+	if err != nil || base == nil {
+		panic(baseNotFound + ext.base)
+	}
+	//the base and the nodes inside it must be complete before being copied
+	p.resolveTree(doc, base, resolved, visiting)
+
+	mergeNode(node, base)
+	resolved[node] = true
+	delete(visiting, node)
+}
+
+func (p *parser) resolveTree(doc *FML, node *FML, resolved, visiting map[*FML]bool) {
+	p.resolveExtension(doc, node, resolved, visiting)
+	for _, v := range node.dict {
+		switch sub := v.(type) {
+		case *FML:
+			p.resolveTree(doc, sub, resolved, visiting)
+		case []*FML:
+			for _, item := range sub {
+				p.resolveTree(doc, item, resolved, visiting)
+			}
+		}
+	}
+}
+
+// mergeNode copies the keys of src missing in dst, sub-nodes existing in both are merged.
+func mergeNode(dst, src *FML) {
+	for k, v := range src.dict {
+		old, ok := dst.dict[k]
+		if !ok {
+			dst.dict[k] = cloneValue(v)
+			continue
+		}
+
+		dstNode, ok1 := old.(*FML)
+		srcNode, ok2 := v.(*FML)
+		if ok1 && ok2 {
+			mergeNode(dstNode, srcNode)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package fml
+
+import "testing"
+
+func TestInheritNode(t *testing.T) {
+	input := `[prod : base]
+host: prod.local
+
+[prod.pool]
+max: 20
+
+[base]
+host: localhost
+port: 5432
+tags: [a, b]
+
+[base.pool]
+min: 1
+max: 5
+
+[shard : prod]
+port: 6432
+`
+	doc, err := ParseString(input)
+	if err != nil {
+		t.Fatal("Should parse, err:", err)
+	}
+
+	if doc.GetString("prod.host") != "prod.local" || doc.GetInt("prod.port") != 5432 {
+		t.Error("Should inherit keys and keep local ones")
+	}
+	if doc.GetInt("prod.pool.min") != 1 || doc.GetInt("prod.pool.max") != 20 {
+		t.Error("Should merge sub-nodes")
+	}
+	if doc.GetString("shard.host") != "prod.local" || doc.GetInt("shard.port") != 6432 ||
+		doc.GetInt("shard.pool.max") != 20 {
+		t.Error("Should inherit multiple levels")
+	}
+
+	tags := doc.GetStringArray("prod.tags")
+	tags[0] = "changed"
+	if doc.GetStringArray("base.tags")[0] != "a" {
+		t.Error("Inherited values should be copies")
+	}
+
+	type Pool struct {
+		Min, Max int
+	}
+	type DB struct {
+		Host string
+		Port int
+		Pool Pool
+	}
+	db := new(DB)
+	if err = doc.GetStruct("shard", db); err != nil || db.Port != 6432 || db.Pool.Min != 1 {
+		t.Error("Should get resolved struct, db:", db)
+	}
+}
+
+func TestInheritNodeList(t *testing.T) {
+	input := `[defaults]
+timeout: 30
+
+[jobs : defaults]
+- name: a
+- name: b
+  timeout: 5
+`
+	doc, err := ParseString(input)
+	if err != nil {
+		t.Fatal("Should parse, err:", err)
+	}
+	jobs, _ := doc.GetNodeList("jobs")
+	if len(jobs) != 2 || jobs[0].GetInt("timeout") != 30 || jobs[1].GetInt("timeout") != 5 {
+		t.Error("Each item should inherit the base node")
+	}
+}
+
+func TestInheritErrors(t *testing.T) {
+	_, err := ParseString("[a : missing]\nk: 1\n")
+	if err == nil {
+		t.Error("Should fail on missing base node")
+	}
+
+	_, err = ParseString("[a : b]\nk: 1\n\n[b : a]\nk: 2\n")
+	if err == nil {
+		t.Error("Should fail on inheritance cycle")
+	}
+}
@@ -0,0 +1,181 @@
+package fml
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+var errJSONValue = errors.New("convert json failed: unsupported value")
+
+// JSONOptions controls how JSON is converted to fml.
+type JSONOptions struct {
+	// DetectDatetimes converts strings in the datetime formats of fml, like RFC3339, to datetimes.
+	DetectDatetimes bool
+}
+
+// A JSONOption sets a JSON conversion option.
+type JSONOption func(*JSONOptions)
+
+// WithDetectDatetimes converts strings like "2014-07-06T12:00:00Z" to datetimes, as ToJSON writes datetimes so.
+func WithDetectDatetimes() JSONOption {
+	return func(o *JSONOptions) {
+		o.DetectDatetimes = true
+	}
+}
+
+// ToJSON converts the document to a JSON object. Nodes are objects, node lists are arrays of objects,
+// datetimes are RFC3339 strings, sealed secrets are strings like "enc:aes:...", and null is null.
+// Keys are written in order, and each level is indented by the indent if it is not empty.
+func ToJSON(doc *FML, indent string) ([]byte, error) {
+	if len(indent) == 0 {
+		return json.Marshal(doc)
+	}
+	return json.MarshalIndent(doc, "", indent)
+}
+
+// FromJSON converts a JSON object to a document, the reverse of ToJSON. Objects are nodes,
+// arrays of objects are node lists, other arrays must have items of the same type, numbers are int
+// if they are integers in the range of int, or float64, and strings like "enc:aes:..." are sealed secrets.
+// Arrays of arrays, arrays mixing types or holding null, and keys like "a:b", "#a" or "a@b" can't be converted.
+func FromJSON(data []byte, opts ...JSONOption) (*FML, error) {
+	o := &JSONOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	if _, err := d.Token(); err != io.EOF {
+		return nil, errors.New("convert json failed: data after the object")
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("convert json failed: not an object")
+	}
+
+	val, err := fromJSONValue(m, o)
+	if err != nil {
+		return nil, err
+	}
+	return val.(*FML), nil
+}
+
+// MarshalJSON converts the node to a JSON object, see ToJSON.
+func (f *FML) MarshalJSON() ([]byte, error) {
+	f.rlock()
+	defer f.runlock()
+	return json.Marshal(toJSONValue(f))
+}
+
+// UnmarshalJSON replaces the content of the node by a JSON object, see FromJSON.
+func (f *FML) UnmarshalJSON(data []byte) error {
+	doc, err := FromJSON(data)
+	if err != nil {
+		return err
+	}
+
+	f.lock()
+	defer f.unlock()
+	shareMutex(doc, f.mu)
+	f.dict = make(map[string]interface{}, len(doc.dict))
+	for k, v := range doc.dict {
+		f.dict[f.normalizeKey(k)] = v
+	}
+	return nil
+}
+
+//toJSONValue converts a value to the types encoding/json writes as fml means them
+func toJSONValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case *FML:
+		if v == nil {
+			return nil
+		}
+		m := make(map[string]interface{}, len(v.dict))
+		for k, sub := range v.dict {
+			m[k] = toJSONValue(sub)
+		}
+		return m
+	case []*FML:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = toJSONValue(item)
+		}
+		return list
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case []time.Time:
+		list := make([]string, len(v))
+		for i, t := range v {
+			list[i] = t.Format(time.RFC3339Nano)
+		}
+		return list
+	case Secret:
+		return v.String()
+	}
+	return val
+}
+
+//fromJSONValue converts a value decoded by encoding/json with numbers as json.Number
+func fromJSONValue(val interface{}, o *JSONOptions) (interface{}, error) {
+	switch v := val.(type) {
+	case map[string]interface{}:
+		node := NewFml()
+		for k, sub := range v {
+			sv, err := fromJSONValue(sub, o)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", k, err)
+			}
+			if !canWriteKey(k, sv) {
+				return nil, fmt.Errorf("convert json failed: the key %q can't be expressed in fml", k)
+			}
+			node.dict[k] = sv
+		}
+		return node, nil
+	case []interface{}:
+		return fromJSONArray(v, o)
+	case json.Number:
+		if i, err := v.Int64(); err == nil && !strings.ContainsAny(v.String(), ".eE") && int64(int(i)) == i {
+			return int(i), nil
+		}
+		return v.Float64()
+	case string:
+		if secret, ok := evalSecret(v); ok {
+			return secret, nil
+		}
+		if o.DetectDatetimes {
+			if t, ok := evalDatetime(v); ok {
+				return t, nil
+			}
+		}
+		return v, nil
+	}
+	return val, nil
+}
+
+//fromJSONArray converts an array to a typed array, or a node list if its items are objects
+func fromJSONArray(list []interface{}, o *JSONOptions) (interface{}, error) {
+	items := make([]interface{}, len(list))
+	for i, item := range list {
+		v, err := fromJSONValue(item, o)
+		if err != nil {
+			return nil, err
+		}
+		items[i] = v
+	}
+
+	arr, err := typedArray(items)
+	if err != nil {
+		return nil, errJSONValue
+	}
+	return arr, nil
+}
@@ -0,0 +1,104 @@
+package fml
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestToJSON(t *testing.T) {
+	doc, _ := ParseString(`name: app
+port: 8080
+ratio: 0.5
+tags: [a, b]
+when: 2014-07-06T12:00:00+08:00
+password: enc:aes:c2VjcmV0
+
+[db]
+host: local
+
+[staff]
+- name: Abby
+`)
+	doc.SetValue("nothing", nil)
+	out, err := ToJSON(doc, "")
+	if err != nil {
+		t.Fatal("ToJSON failed:", err)
+	}
+	expected := `{"db":{"host":"local"},"name":"app","nothing":null,"password":"enc:aes:c2VjcmV0","port":8080,` +
+		`"ratio":0.5,"staff":[{"name":"Abby"}],"tags":["a","b"],"when":"2014-07-06T12:00:00+08:00"}`
+	if string(out) != expected {
+		t.Error("Should convert to json, got:", string(out))
+	}
+
+	back, err := FromJSON(out, WithDetectDatetimes())
+	if err != nil || !Equal(doc, back) {
+		t.Error("Should convert back, got:", back, err)
+	}
+	plain, _ := FromJSON(out)
+	if when, _ := plain.Lookup("when"); when != "2014-07-06T12:00:00+08:00" {
+		t.Error("Should keep datetimes as strings by default, got:", when)
+	}
+}
+
+func TestFromJSON(t *testing.T) {
+	doc, err := FromJSON([]byte(`{"n": 1, "big": 1e3, "f": [1, 2.5], "ids": [1, 2], "none": [], "items": [{"a": true}]}`))
+	if err != nil {
+		t.Fatal("FromJSON failed:", err)
+	}
+	if doc.GetInt("n") != 1 || doc.GetFloat("big") != 1000 || len(doc.GetIntArray("ids")) != 2 {
+		t.Error("Should convert numbers, got:", doc)
+	}
+	if f := doc.GetFloatArray("f"); len(f) != 2 || f[0] != 1 {
+		t.Error("Should convert mixed numbers to floats, got:", f)
+	}
+	if items, err := doc.GetNodeList("items"); err != nil || !items[0].GetBool("a") {
+		t.Error("Should convert arrays of objects to node lists, got:", items, err)
+	}
+	if doc, err = FromJSON([]byte(`{"a": []}`)); err != nil {
+		t.Fatal("FromJSON failed:", err)
+	}
+	if back, err := ParseString(doc.String()); err != nil || len(back.GetStringArray("a")) != 0 || !back.Has("a") {
+		t.Error("Should write an empty array that parses back, got:", doc.String(), err)
+	}
+
+	for _, input := range []string{`[1]`, `{"a": [[1]]}`, `{"a": [1, "b"]}`, `{"a": 1} {}`, `{"a": `} {
+		if _, err = FromJSON([]byte(input)); err == nil {
+			t.Error("Should fail for", input)
+		}
+	}
+
+	keys := map[string]string{
+		`{"#x": 1}`:             `convert json failed: the key "#x" can't be expressed in fml`,
+		`{"a:b": 2}`:            `convert json failed: the key "a:b" can't be expressed in fml`,
+		`{"a": {"b=c": true}}`:  `a: convert json failed: the key "b=c" can't be expressed in fml`,
+		`{"a.b": {"c": 1}}`:     `convert json failed: the key "a.b" can't be expressed in fml`,
+		`{"a": [{"[b": null}]}`: `a: convert json failed: the key "[b" can't be expressed in fml`,
+	}
+	for input, msg := range keys {
+		if _, err = FromJSON([]byte(input)); err == nil || err.Error() != msg {
+			t.Errorf("Should fail for %s with %q, got: %v", input, msg, err)
+		}
+	}
+	if doc, err = FromJSON([]byte(`{"a.b": 1, "c": {"d e": "x"}}`)); err != nil || doc.dict["a.b"] != 1 {
+		t.Error("Should keep keys with dots for values, got:", doc, err)
+	}
+}
+
+func TestJSONMarshaler(t *testing.T) {
+	var s struct {
+		Config *FML `json:"config"`
+	}
+	if err := json.Unmarshal([]byte(`{"config": {"port": 8080, "when": "2014-07-06"}}`), &s); err != nil {
+		t.Fatal("Unmarshal failed:", err)
+	}
+	if s.Config.GetInt("port") != 8080 || s.Config.GetString("when") != "2014-07-06" {
+		t.Error("Should unmarshal json, got:", s.Config)
+	}
+
+	s.Config.SetValue("when", time.Date(2014, 7, 6, 0, 0, 0, 0, time.UTC))
+	out, err := json.Marshal(s)
+	if err != nil || string(out) != `{"config":{"port":8080,"when":"2014-07-06T00:00:00Z"}}` {
+		t.Error("Should marshal json, got:", string(out), err)
+	}
+}
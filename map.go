@@ -0,0 +1,53 @@
+package fml
+
+import (
+	"reflect"
+	"time"
+)
+
+// ToMap converts the node to a map with natural Go types, for other libraries like encoding/json.
+// Nodes are map[string]interface{}, node lists and arrays are []interface{}, null is nil,
+// and scalars are string, int, float64, bool, time.Time, or Secret if sealed.
+func (f *FML) ToMap() map[string]interface{} {
+	f.rlock()
+	defer f.runlock()
+	m, _ := naturalValue(f).(map[string]interface{})
+	return m
+}
+
+// FromMap converts a map to a node, the reverse of ToMap. Maps from string are nodes,
+// slices are arrays if their items are values of the same type, or node lists if they are all maps,
+// and integers and floats of any size are int and float64. Other values are converted like Marshal.
+// Empty slices become empty arrays of string, and nil slices become null.
+func FromMap(m map[string]interface{}) (*FML, error) {
+	return ToNode(m)
+}
+
+//naturalValue converts a fml value to natural Go types, see ToMap
+func naturalValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case *FML:
+		if v == nil {
+			return nil
+		}
+		m := make(map[string]interface{}, len(v.dict))
+		for k, sub := range v.dict {
+			m[k] = naturalValue(sub)
+		}
+		return m
+	case []*FML:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = naturalValue(item)
+		}
+		return list
+	case []string, []int, []float64, []bool, []time.Time:
+		rv := reflect.ValueOf(v)
+		list := make([]interface{}, rv.Len())
+		for i := range list {
+			list[i] = rv.Index(i).Interface()
+		}
+		return list
+	}
+	return val
+}
@@ -0,0 +1,129 @@
+package fml
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const mapInput = `name: app
+port: 8080
+ratio: 0.5
+debug: true
+tags: [a, b]
+when: 2014-07-06T12:00:00Z
+
+[db]
+host: local
+
+[staff]
+- name: Abby
+- name: Tony
+`
+
+func TestToMap(t *testing.T) {
+	doc, _ := ParseString(mapInput)
+	doc.SetValue("nothing", nil)
+	m := doc.ToMap()
+	expected := map[string]interface{}{
+		"name": "app", "port": 8080, "ratio": 0.5, "debug": true, "nothing": nil,
+		"tags": []interface{}{"a", "b"}, "when": time.Date(2014, 7, 6, 12, 0, 0, 0, time.UTC),
+		"db": map[string]interface{}{"host": "local"},
+		"staff": []interface{}{
+			map[string]interface{}{"name": "Abby"},
+			map[string]interface{}{"name": "Tony"},
+		},
+	}
+	for k, v := range expected {
+		if got := m[k]; !reflect.DeepEqual(got, v) && !(k == "when" && got.(time.Time).Equal(v.(time.Time))) {
+			t.Error("Should convert", k, "to", v, "got:", got)
+		}
+	}
+	if len(m) != len(expected) {
+		t.Error("Should convert all the keys, got:", m)
+	}
+
+	back, err := FromMap(m)
+	if err != nil || !Equal(doc, back) {
+		t.Error("Should convert the map back, got:", back, err)
+	}
+}
+
+func TestFromMap(t *testing.T) {
+	doc, err := FromMap(map[string]interface{}{
+		"port":  int64(8080),
+		"ratio": float32(0.5),
+		"ids":   []interface{}{1, 2},
+		"db":    map[string]interface{}{"host": "local"},
+		"staff": []map[string]interface{}{{"name": "Abby"}},
+	})
+	if err != nil {
+		t.Fatal("FromMap failed:", err)
+	}
+	if doc.GetInt("port") != 8080 || doc.GetFloat("ratio") != 0.5 || len(doc.GetIntArray("ids")) != 2 ||
+		doc.GetString("db.host") != "local" {
+		t.Error("Should convert the values, got:", doc)
+	}
+	if staff, err := doc.GetNodeList("staff"); err != nil || staff[0].GetString("name") != "Abby" {
+		t.Error("Should convert slices of maps to node lists, got:", staff, err)
+	}
+	if _, err = FromMap(map[string]interface{}{"mixed": []interface{}{1, "a"}}); err != errMarshalType {
+		t.Error("Should fail for mixed arrays, got:", err)
+	}
+
+	doc, err = FromMap(map[string]interface{}{"empty": []interface{}{}, "none": []string(nil)})
+	if err != nil {
+		t.Fatal("FromMap failed:", err)
+	}
+	buf := &bytes.Buffer{}
+	bw := bufio.NewWriter(buf)
+	doc.WriteTo(bw)
+	bw.Flush()
+	back, err := Parse(buf.Bytes())
+	if err != nil {
+		t.Fatal("Should parse the written empty slices, got:", err, buf.String())
+	}
+	if v, _ := back.Lookup("empty"); !reflect.DeepEqual(v, []string{}) {
+		t.Error("Should read back an empty array, got:", v)
+	}
+	if v, ok := back.Lookup("none"); !ok || v != nil {
+		t.Error("Should read back null for nil slices, got:", v, ok)
+	}
+}
+
+func TestUnmarshalAny(t *testing.T) {
+	var m map[string]interface{}
+	if err := UnmarshalString(mapInput, &m); err != nil {
+		t.Fatal("Unmarshal failed:", err)
+	}
+	if m["port"] != 8080 || m["db"].(map[string]interface{})["host"] != "local" || len(m["staff"].([]interface{})) != 2 {
+		t.Error("Should decode into a map, got:", m)
+	}
+
+	var v interface{}
+	if err := UnmarshalString(mapInput, &v); err != nil {
+		t.Fatal("Unmarshal failed:", err)
+	}
+	if !reflect.DeepEqual(v, m) {
+		t.Error("Should decode into interface{} as a map, got:", v)
+	}
+
+	var s struct {
+		Extra interface{}         `fml:"db"`
+		Tags  []interface{}       `fml:"tags"`
+		Staff []map[string]string `fml:"staff"`
+	}
+	if err := UnmarshalString(mapInput, &s); err != nil {
+		t.Fatal("Unmarshal failed:", err)
+	}
+	if s.Extra.(map[string]interface{})["host"] != "local" || s.Tags[1] != "b" || s.Staff[1]["name"] != "Tony" {
+		t.Error("Should decode fields into natural types, got:", s)
+	}
+
+	var n int
+	if err := UnmarshalString(mapInput, &n); err != errTypeMismatch {
+		t.Error("Should fail for other types, got:", err)
+	}
+}
@@ -0,0 +1,134 @@
+package fml
+
+// DuplicatePolicy decides what to do when a key or a node is defined more than once.
+type DuplicatePolicy int
+
+const (
+	// DuplicateError fails the parsing, it is the default policy.
+	DuplicateError DuplicatePolicy = iota
+	// DuplicateLastWins keeps the last value.
+	DuplicateLastWins
+	// DuplicateCollect collects the values into an array, or nodes into a node list.
+	DuplicateCollect
+)
+
+// Options controls how a document is parsed.
+type Options struct {
+	// Delimiters are the accepted delimiters between keys and values, ":=" by default.
+	Delimiters string
+	// Duplicate is the policy for duplicate keys and nodes.
+	Duplicate DuplicatePolicy
+	// CommentChars are the characters starting a comment, "#" by default.
+	CommentChars string
+	// IgnoreCase makes keys and node names case-insensitive.
+	IgnoreCase bool
+	// MaxDepth limits the nesting depth of nodes, 0 means no limit.
+	MaxDepth int
+	// MaxInputSize limits the size of the input in bytes, 0 means no limit.
+	MaxInputSize int
+	// MaxArrayLength limits the number of items of an array, 0 means no limit.
+	MaxArrayLength int
+	// MaxKeys limits the number of keys in the document, 0 means no limit.
+	MaxKeys int
+	// Profile is the active profile, see WithProfile.
+	Profile string
+	// Profiles are the known profiles, see WithProfiles.
+	Profiles []string
+}
+
+// An Option sets a parsing option.
+type Option func(*Options)
+
+func defaultOptions() *Options {
+	return &Options{
+		Delimiters:   ":=",
+		CommentChars: "#",
+	}
+}
+
+// WithDelimiters sets the accepted delimiters between keys and values, like ":", "=" or ":=".
+func WithDelimiters(delimiters string) Option {
+	return func(o *Options) {
+		o.Delimiters = delimiters
+	}
+}
+
+// WithDuplicatePolicy sets the policy for duplicate keys and nodes.
+func WithDuplicatePolicy(policy DuplicatePolicy) Option {
+	return func(o *Options) {
+		o.Duplicate = policy
+	}
+}
+
+// WithCommentChars sets the characters starting a comment.
+func WithCommentChars(chars string) Option {
+	return func(o *Options) {
+		o.CommentChars = chars
+	}
+}
+
+// WithIgnoreCase makes keys and node names case-insensitive,
+// both while parsing and when getting values from the document.
+func WithIgnoreCase() Option {
+	return func(o *Options) {
+		o.IgnoreCase = true
+	}
+}
+
+// WithMaxDepth limits the nesting depth of nodes, for example [a.b.c] has a depth of 3.
+func WithMaxDepth(depth int) Option {
+	return func(o *Options) {
+		o.MaxDepth = depth
+	}
+}
+
+// WithMaxInputSize limits the size of the input in bytes.
+func WithMaxInputSize(size int) Option {
+	return func(o *Options) {
+		o.MaxInputSize = size
+	}
+}
+
+// WithMaxArrayLength limits the number of items of an array.
+func WithMaxArrayLength(length int) Option {
+	return func(o *Options) {
+		o.MaxArrayLength = length
+	}
+}
+
+// WithMaxKeys limits the number of keys in the document, including keys of nodes and list items.
+func WithMaxKeys(keys int) Option {
+	return func(o *Options) {
+		o.MaxKeys = keys
+	}
+}
+
+// WithUntrustedLimits sets limits suitable for documents from untrusted users:
+// 1MB of input, 16 levels of nodes, 10000 items in an array and 10000 keys.
+func WithUntrustedLimits() Option {
+	return func(o *Options) {
+		o.MaxInputSize = 1 << 20
+		o.MaxDepth = 16
+		o.MaxArrayLength = 10000
+		o.MaxKeys = 10000
+	}
+}
+
+// WithProfile activates a profile. Entries qualified with the active profile, like [database@prod] or port@prod,
+// override the unqualified ones, entries of other known profiles are dropped, see WithProfiles.
+// The active profile is known even if it is not given to WithProfiles, but if the known profiles are given,
+// it must be one of them. Without them, names qualified with other profiles, like port@staging, are kept as they are.
+func WithProfile(profile string) Option {
+	return func(o *Options) {
+		o.Profile = profile
+	}
+}
+
+// WithProfiles sets the known profiles. Only names qualified with a known profile, like [database@prod]
+// or port@prod, are entries of the profile, they are dropped if no profile is active.
+// Other names keep their '@' as it is, like email@host.
+func WithProfiles(profiles ...string) Option {
+	return func(o *Options) {
+		o.Profiles = profiles
+	}
+}
@@ -3,50 +3,238 @@ package fml
 import "io/ioutil"
 
 import (
+	"bytes"
 	"errors"
-	"log"
+	"fmt"
+	"os"
+	"strings"
 )
 
+// A parser holds the options of one parsing, so parsings with different options don't interfere.
+type parser struct {
+	opts       *Options
+	extensions map[*FML]extension
+	overrides  []override
+
+	//delimiters and comment chars by byte, so checking them costs an index
+	delimiters [256]bool
+	comments   [256]bool
+
+	//the input as a string, keys and values are substrings of it instead of copies
+	src string
+
+	//where the current key or node starts, for errors
+	pos  int
+	keys int
+
+	//spans of values by key path, only recorded if not nil
+	input []byte
+	spans map[string]span
+	paths map[*FML]string
+	//where node headers and list items start by path, only recorded if not nil
+	starts map[string]int
+}
+
+// A ParseError is returned when the input is not a valid fml document.
+type ParseError struct {
+	// Line is where the key or node failed to parse, starting from 1.
+	Line int
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("parse fml failed at line %d: %s", e.Line, e.Msg)
+}
+
+func lineOf(input []byte, pos int) int {
+	if pos > len(input) {
+		pos = len(input)
+	} else if pos < 0 {
+		pos = 0
+	}
+	return bytes.Count(input[:pos], []byte{'\n'}) + 1
+}
+
+// A span is where a value is in the input
+type span struct {
+	start, end int
+}
+
+func newParser(opts []Option) *parser {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	p := &parser{opts: o}
+	for i := 0; i < len(o.Delimiters); i++ {
+		p.delimiters[o.Delimiters[i]] = true
+	}
+	for i := 0; i < len(o.CommentChars); i++ {
+		p.comments[o.CommentChars[i]] = true
+	}
+	return p
+}
+
 func Load(path string) (doc *FML, err error) {
+	return LoadWithOptions(path)
+}
+
+// LoadWithOptions loads a fml file with the parsing options.
+func LoadWithOptions(path string, opts ...Option) (doc *FML, err error) {
 	bytes, err := ioutil.ReadFile(path)
 	if err != nil {
 		return
 	}
-	doc, err = Parse(bytes)
+	doc, err = ParseWithOptions(bytes, opts...)
 
 	return
 }
 
+// LoadWithProfile loads a fml file with a profile activated, see WithProfile.
+// If the profile is empty, the one named by the FML_PROFILE environment variable is used.
+// Entries of other profiles are only dropped if the known profiles are given with WithProfiles:
+//
+//	doc, err := fml.LoadWithProfile("app.fml", "prod", fml.WithProfiles("prod", "staging"))
+func LoadWithProfile(path string, profile string, opts ...Option) (doc *FML, err error) {
+	if len(profile) == 0 {
+		profile = os.Getenv(ProfileEnv)
+	}
+	return LoadWithOptions(path, append(opts, WithProfile(profile))...)
+}
+
 func ParseString(input string) (doc *FML, err error) {
 	return Parse([]byte(input))
 }
 
 func Parse(input []byte) (doc *FML, err error) {
+	return ParseWithOptions(input)
+}
+
+// ParseWithOptions parses the input with the parsing options.
+func ParseWithOptions(input []byte, opts ...Option) (doc *FML, err error) {
+	return newParser(opts).parse(input)
+}
+
+//parseWithSpans parses the input, and records where the values are by key path,
+//like "key", "node.key" or "list[0].key".
+func parseWithSpans(input []byte, opts ...Option) (doc *FML, spans map[string]span, err error) {
+	p := newParser(opts)
+	p.spans = make(map[string]span)
+	p.paths = make(map[*FML]string)
+	doc, err = p.parse(input)
+	return doc, p.spans, err
+}
+
+//parseSource parses the input, and records where the values are like parseWithSpans,
+//and where node headers and list items start, by path like "node" or "list[0]"
+func parseSource(input []byte, opts ...Option) (doc *FML, spans map[string]span, starts map[string]int, err error) {
+	p := newParser(opts)
+	p.spans = make(map[string]span)
+	p.paths = make(map[*FML]string)
+	p.starts = make(map[string]int)
+	doc, err = p.parse(input)
+	return doc, p.spans, p.starts, err
+}
+
+func (p *parser) parse(input []byte) (doc *FML, err error) {
+	if len(p.opts.Profile) != 0 && len(p.opts.Profiles) != 0 && !p.isListedProfile(p.opts.Profile) {
+		return nil, errors.New("parse fml failed: " + unknownProfile + p.opts.Profile)
+	}
 	defer func() {
 		if r := recover(); r != nil {
-			log.Println(r)
-			err = errors.New("parse fipml failed")
+			doc, err = nil, &ParseError{Line: lineOf(input, p.pos), Msg: fmt.Sprint(r)}
 		}
 	}()
 
-	doc = NewFml()
+	p.input = input
+	p.src = string(input)
+	if p.opts.MaxInputSize > 0 && len(input) > p.opts.MaxInputSize {
+		panic(tooLarge)
+	}
+	doc = p.newNode()
 	idx, delta := 0, 0
 
 	for idx < len(input) {
-		idx += skipLeft(input[idx:])
+		idx += p.skipLeft(input[idx:])
 		if idx >= len(input) {
-			return
+			break
 		}
 
 		if input[idx] == '[' {
-			delta = extractNode(input[idx:], doc)
+			delta = p.extractNode(input[idx:], doc)
 		} else {
 			//delta = extractBlock(input[idx:],doc)
-			delta = extractKeyValue(input[idx:], doc)
+			delta = p.extractKeyValue(input[idx:], doc)
 		}
 		idx += delta
 		//idx += extractBlock(input[idx:],doc)
 	}
 
+	p.applyOverrides()
+	p.resolveExtensions(doc)
 	return
 }
+
+//mark records where the current key or node starts
+func (p *parser) mark(part []byte) {
+	p.pos = p.offset(part)
+}
+
+//offset gets the position of a part of the input, all parts are suffixes of it
+func (p *parser) offset(part []byte) int {
+	return len(p.input) - len(part)
+}
+
+func (p *parser) setPath(node *FML, path string) {
+	if p.paths != nil {
+		p.paths[node] = path
+	}
+}
+
+func (p *parser) recordStart(path string, part []byte) {
+	if p.starts != nil {
+		p.starts[path] = p.offset(part)
+	}
+}
+
+func (p *parser) recordSpan(doc *FML, key string, start, end int) {
+	if p.spans == nil {
+		return
+	}
+	if path := p.paths[doc]; len(path) != 0 {
+		key = path + "." + key
+	}
+	p.spans[key] = span{start, end}
+}
+
+func (p *parser) newNode() *FML {
+	node := NewFml()
+	node.ignoreCase = p.opts.IgnoreCase
+	return node
+}
+
+func (p *parser) isDelimiter(c byte) bool {
+	return p.delimiters[c]
+}
+
+func (p *parser) isComment(c byte) bool {
+	return p.comments[c]
+}
+
+//str gets part[from:to] as a string, sharing the memory of the input when part is a suffix of it
+func (p *parser) str(part []byte, from, to int) string {
+	if from == to {
+		return ""
+	}
+	if off := len(p.input) - len(part); off >= 0 && len(part) > 0 && &p.input[off] == &part[0] {
+		return p.src[off+from : off+to]
+	}
+	return string(part[from:to])
+}
+
+func (p *parser) normalizeKey(key string) string {
+	if p.opts.IgnoreCase {
+		return strings.ToLower(key)
+	}
+	return key
+}
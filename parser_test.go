@@ -4,6 +4,8 @@ import (
 	"testing"
 )
 
+var testParser = newParser(nil)
+
 func TestParse(t *testing.T) {
 	/*
 
@@ -67,6 +69,125 @@ content1: [
 	IterateFimlDoc(doc)
 }
 
+func TestParseWithDelimiters(t *testing.T) {
+	input := `a: 1
+b = 2`
+	doc, err := ParseString(input)
+	if err != nil || doc.GetInt("a") != 1 || doc.GetInt("b") != 2 {
+		t.Error("Should accept both delimiters by default, err:", err)
+	}
+
+	_, err = ParseWithOptions([]byte(input), WithDelimiters("="))
+	if err == nil {
+		t.Error("Should NOT accept ':' as delimiter")
+	}
+
+	doc, err = ParseWithOptions([]byte("url = http://host:80"), WithDelimiters("="))
+	if err != nil || doc.GetString("url") != "http://host:80" {
+		t.Error("Should get url, err:", err)
+	}
+}
+
+func TestParseWithDuplicatePolicy(t *testing.T) {
+	input := `port: 1
+port: 2
+
+[server]
+name: a
+
+[server]
+name: b
+`
+	_, err := ParseString(input)
+	if err == nil {
+		t.Error("Should fail on duplicate key")
+	}
+
+	doc, err := ParseWithOptions([]byte(input), WithDuplicatePolicy(DuplicateLastWins))
+	if err != nil || doc.GetInt("port") != 2 || doc.GetString("server.name") != "b" {
+		t.Error("Last value should win, err:", err)
+	}
+
+	doc, err = ParseWithOptions([]byte(input), WithDuplicatePolicy(DuplicateCollect))
+	if err != nil {
+		t.Fatal("Should collect values, err:", err)
+	}
+	ports := doc.GetIntArray("port")
+	servers, _ := doc.GetNodeList("server")
+	if len(ports) != 2 || ports[1] != 2 || len(servers) != 2 || servers[1].GetString("name") != "b" {
+		t.Error("Should collect into arrays, ports:", ports, "servers:", servers)
+	}
+}
+
+func TestParseWithCommentAndCase(t *testing.T) {
+	input := `; comment
+Name: Tony ; inline
+
+[DataBase]
+Host: local`
+	doc, err := ParseWithOptions([]byte(input), WithCommentChars(";"), WithIgnoreCase())
+	if err != nil {
+		t.Fatal("Should parse, err:", err)
+	}
+	if doc.GetString("NAME") != "Tony" || doc.GetString("database.HOST") != "local" {
+		t.Error("Should get values ignoring case")
+	}
+}
+
+func TestParseWithMaxDepth(t *testing.T) {
+	input := `[a.b.c]
+d: 1`
+	doc, err := ParseString(input)
+	if err != nil || doc.GetInt("a.b.c.d") != 1 {
+		t.Error("Should get nested value, err:", err)
+	}
+
+	_, err = ParseWithOptions([]byte(input), WithMaxDepth(2))
+	if err == nil {
+		t.Error("Should fail on nesting too deep")
+	}
+}
+
+func TestParseWithLimits(t *testing.T) {
+	input := `a: [1, 2, 3]
+b: 2
+
+[c]
+d: 3`
+	if _, err := ParseWithOptions([]byte(input), WithUntrustedLimits()); err != nil {
+		t.Error("Should parse within limits, err:", err)
+	}
+
+	limits := map[string]Option{
+		"size":  WithMaxInputSize(10),
+		"array": WithMaxArrayLength(2),
+		"keys":  WithMaxKeys(2),
+	}
+	for name, opt := range limits {
+		if _, err := ParseWithOptions([]byte(input), opt); err == nil {
+			t.Error("Should fail on limit:", name)
+		}
+	}
+}
+
+func TestParseError(t *testing.T) {
+	input := `a: 1
+
+[node]
+b: "not closed
+`
+	_, err := ParseString(input)
+	pe, ok := err.(*ParseError)
+	if !ok || pe.Line != 4 {
+		t.Error("Should get parse error at line 4, err:", err)
+	}
+
+	_, err = ParseString("[]")
+	if _, ok = err.(*ParseError); !ok {
+		t.Error("Should get parse error, err:", err)
+	}
+}
+
 /*func TestA(t *testing.T) {
 	fml := NewFml()
 	fml.SetValue("img/class-hierarchy.png",fiputil.MinTime)
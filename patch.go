@@ -0,0 +1,893 @@
+package fml
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/fipress/fiputil"
+)
+
+// The operations of a patch.
+const (
+	// PatchAdd adds a key, a node, or an item of a node list. The key must not exist,
+	// an item is inserted at its index, or appended if the path selects it by an identity key.
+	PatchAdd = "add"
+	// PatchRemove removes a key, a node, or an item of a node list. A node list goes with its last item.
+	PatchRemove = "remove"
+	// PatchReplace replaces the value of an existing key, node or item.
+	PatchReplace = "replace"
+	// PatchMove removes the value at From and adds it at Path.
+	PatchMove = "move"
+)
+
+// An Operation changes a document at a key path, like "database.port", "staff[1]" or "staff[name=Abby].age",
+// so keys with '.', '[' or ']' in them can't be changed. Selector values holding them are quoted, like staff[name="a.b"].
+// Values are of the types of parsed documents: string, int, float64, bool, time.Time, Secret,
+// arrays of them, *FML for nodes, []*FML for node lists, or nil for null.
+type Operation struct {
+	Op    string
+	Path  string
+	From  string
+	Value interface{}
+}
+
+// A Patch is a list of operations applied in order.
+type Patch []Operation
+
+var (
+	errPathNotFound = errors.New("path not found")
+	errPathExists   = errors.New("path exists")
+	errInvalidPath  = errors.New("invalid path")
+	errInvalidOp    = errors.New("invalid operation")
+	errPatchValue   = errors.New("invalid value")
+	errPatchSource  = errors.New("can not be applied to the source in place")
+)
+
+// NewPatch makes a patch from the changes of Diff, which turns the old document into the new one.
+func NewPatch(changes []Change) Patch {
+	p := make(Patch, 0, len(changes))
+	for i := 0; i < len(changes); i++ {
+		c := changes[i]
+		switch c.Kind {
+		case Added:
+			p = append(p, Operation{Op: PatchAdd, Path: c.Path, Value: c.New})
+		case Modified:
+			p = append(p, Operation{Op: PatchReplace, Path: c.Path, Value: c.New})
+		case Removed:
+			//items removed by index go from the last, so the indexes stay valid
+			list := indexedList(c.Path)
+			j := i
+			for len(list) != 0 && j+1 < len(changes) && changes[j+1].Kind == Removed && indexedList(changes[j+1].Path) == list {
+				j++
+			}
+			for k := j; k >= i; k-- {
+				p = append(p, Operation{Op: PatchRemove, Path: changes[k].Path})
+			}
+			i = j
+		}
+	}
+	return p
+}
+
+//indexedList gets the list of a path to an item by index, like "a.list" of "a.list[2]"
+func indexedList(path string) string {
+	i := strings.LastIndexByte(path, '[')
+	if i == -1 || !strings.HasSuffix(path, "]") {
+		return ""
+	}
+	if _, err := strconv.Atoi(path[i+1 : len(path)-1]); err != nil {
+		return ""
+	}
+	return path[:i]
+}
+
+// ParsePatch reads a patch from a fml document, the operations are the items of the node list "patch":
+//
+//	[patch]
+//	- op: replace
+//	  path: database.port
+//	  value: 5432
+//	- op: move
+//	  from: database.host
+//	  path: database.address
+func ParsePatch(src []byte) (Patch, error) {
+	doc, err := Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	items, err := doc.GetNodeList("patch")
+	if err != nil {
+		return nil, fmt.Errorf("patch not found: %v", err)
+	}
+	p := make(Patch, len(items))
+	for i, item := range items {
+		op := Operation{Op: item.GetString("op"), Path: item.GetString("path"), From: item.GetString("from")}
+		op.Value, _ = item.Lookup("value")
+		switch op.Op {
+		case PatchAdd, PatchRemove, PatchReplace, PatchMove:
+		default:
+			return nil, fmt.Errorf("%v: %s", errInvalidOp, op.Op)
+		}
+		p[i] = op
+	}
+	return p, nil
+}
+
+// ApplyPatch applies the operations in order. It is atomic, if any of them fails the node is unchanged.
+func (f *FML) ApplyPatch(p Patch) error {
+	f.lock()
+	defer f.unlock()
+	doc := cloneValue(f).(*FML)
+	for _, op := range p {
+		if err := op.apply(doc); err != nil {
+			return op.error(err)
+		}
+	}
+	shareMutex(doc, f.mu)
+	f.dict = doc.dict
+	return nil
+}
+
+func (op Operation) error(err error) error {
+	return fmt.Errorf("patch %s %s failed: %v", op.Op, op.Path, err)
+}
+
+func (op Operation) apply(root *FML) error {
+	segs, err := parsePath(op.Path)
+	if err != nil {
+		return err
+	}
+	switch op.Op {
+	case PatchAdd, PatchReplace:
+		if !isValue(op.Value) {
+			return errPatchValue
+		}
+		parent, err := container(root, segs)
+		if err != nil {
+			return err
+		}
+		if op.Op == PatchAdd {
+			return addAt(parent, segs[len(segs)-1], cloneValue(op.Value))
+		}
+		return replaceAt(parent, segs[len(segs)-1], cloneValue(op.Value))
+	case PatchRemove:
+		parent, err := container(root, segs)
+		if err != nil {
+			return err
+		}
+		_, err = removeAt(parent, segs[len(segs)-1])
+		return err
+	case PatchMove:
+		from, err := parsePath(op.From)
+		if err != nil {
+			return err
+		}
+		parent, err := container(root, from)
+		if err != nil {
+			return err
+		}
+		val, err := removeAt(parent, from[len(from)-1])
+		if err != nil {
+			return err
+		}
+		//the target is found after removing, as indexes may shift
+		if parent, err = container(root, segs); err != nil {
+			return err
+		}
+		return addAt(parent, segs[len(segs)-1], val)
+	}
+	return errInvalidOp
+}
+
+//isValue reports whether a value is of the types of parsed documents
+func isValue(val interface{}) bool {
+	switch v := val.(type) {
+	case nil, string, int, float64, bool, time.Time, Secret,
+		[]string, []int, []float64, []bool, []time.Time:
+		return true
+	case *FML:
+		if v == nil {
+			return false
+		}
+		for _, sub := range v.dict {
+			if !isValue(sub) {
+				return false
+			}
+		}
+		return true
+	case []*FML:
+		for _, item := range v {
+			if !isValue(item) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// A pathSeg is a segment of a key path, like "name", "list[1]" or "list[name=Abby]"
+type pathSeg struct {
+	name string
+	//an item of a node list, by index or by a selector like name=Abby
+	isItem   bool
+	index    int
+	selector string
+}
+
+func parsePath(path string) (segs []pathSeg, err error) {
+	start, depth := 0, 0
+	for i := 0; i <= len(path); i++ {
+		if i < len(path) {
+			switch path[i] {
+			case '[':
+				depth++
+				continue
+			case ']':
+				depth--
+				continue
+			case '"':
+				//a quoted selector value may hold any of them
+				if depth != 0 {
+					if i = quotedEnd(path, i); i == len(path) {
+						return nil, errInvalidPath
+					}
+				}
+				continue
+			case '.':
+				if depth != 0 {
+					continue
+				}
+			default:
+				continue
+			}
+		}
+		seg, err := parseSeg(path[start:i])
+		if err != nil {
+			return nil, err
+		}
+		segs = append(segs, seg)
+		start = i + 1
+	}
+	return
+}
+
+func parseSeg(s string) (seg pathSeg, err error) {
+	i := strings.IndexByte(s, '[')
+	if i == -1 {
+		seg.name = s
+	} else if strings.HasSuffix(s, "]") {
+		seg.name, seg.isItem = s[:i], true
+		inner := s[i+1 : len(s)-1]
+		if eq := strings.IndexByte(inner, '='); eq > 0 {
+			val := inner[eq+1:]
+			if len(val) != 0 && val[0] == '"' && quotedEnd(val, 0) != len(val)-1 {
+				return seg, errInvalidPath
+			}
+			seg.selector = inner
+		} else if seg.index, err = strconv.Atoi(inner); err != nil || seg.index < 0 {
+			return seg, errInvalidPath
+		}
+	}
+	if len(seg.name) == 0 {
+		return seg, errInvalidPath
+	}
+	return seg, nil
+}
+
+//quotedEnd gets the index of the quote closing the quoted string starting at i, len(s) if it is not closed
+func quotedEnd(s string, i int) int {
+	for i++; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return len(s)
+}
+
+//find gets the index of the item in the list, -1 if not found
+func (s pathSeg) find(list []*FML) int {
+	if len(s.selector) == 0 {
+		if s.index < len(list) {
+			return s.index
+		}
+		return -1
+	}
+	i := strings.IndexByte(s.selector, '=')
+	key, val := s.selector[:i], s.selector[i+1:]
+	for j, item := range list {
+		v, ok := item.dict[item.normalizeKey(key)]
+		if ok && isScalar(v) && selectorValue(v) == val {
+			return j
+		}
+	}
+	return -1
+}
+
+//container gets the node holding the last segment of the path
+func container(root *FML, segs []pathSeg) (*FML, error) {
+	node := root
+	for _, s := range segs[:len(segs)-1] {
+		v, ok := getAt(node, s)
+		if !ok {
+			return nil, errPathNotFound
+		}
+		sub, ok := v.(*FML)
+		if !ok {
+			return nil, errPathNotFound
+		}
+		node = sub
+	}
+	return node, nil
+}
+
+func getAt(parent *FML, s pathSeg) (interface{}, bool) {
+	v, ok := parent.dict[parent.normalizeKey(s.name)]
+	if !ok || !s.isItem {
+		return v, ok
+	}
+	list, _ := v.([]*FML)
+	i := s.find(list)
+	if i == -1 {
+		return nil, false
+	}
+	return list[i], true
+}
+
+//getPath gets the value at a path
+func getPath(root *FML, path string) (interface{}, error) {
+	segs, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	parent, err := container(root, segs)
+	if err != nil {
+		return nil, err
+	}
+	v, ok := getAt(parent, segs[len(segs)-1])
+	if !ok {
+		return nil, errPathNotFound
+	}
+	return v, nil
+}
+
+func addAt(parent *FML, s pathSeg, val interface{}) error {
+	key := parent.normalizeKey(s.name)
+	old, ok := parent.dict[key]
+	if !s.isItem {
+		if ok {
+			return errPathExists
+		}
+		parent.dict[key] = val
+		return nil
+	}
+
+	item, isNode := val.(*FML)
+	if !isNode {
+		return errPatchValue
+	}
+	list, isList := old.([]*FML)
+	if ok && !isList {
+		return errPathNotFound
+	}
+	i := len(list)
+	if len(s.selector) != 0 {
+		if s.find(list) != -1 {
+			return errPathExists
+		}
+	} else if i = s.index; i > len(list) {
+		return errPathNotFound
+	}
+	updated := make([]*FML, 0, len(list)+1)
+	updated = append(append(append(updated, list[:i]...), item), list[i:]...)
+	parent.dict[key] = updated
+	return nil
+}
+
+func replaceAt(parent *FML, s pathSeg, val interface{}) error {
+	key := parent.normalizeKey(s.name)
+	old, ok := parent.dict[key]
+	if !ok {
+		return errPathNotFound
+	}
+	if !s.isItem {
+		parent.dict[key] = val
+		return nil
+	}
+
+	item, isNode := val.(*FML)
+	if !isNode {
+		return errPatchValue
+	}
+	list, _ := old.([]*FML)
+	i := s.find(list)
+	if i == -1 {
+		return errPathNotFound
+	}
+	updated := append([]*FML(nil), list...)
+	updated[i] = item
+	parent.dict[key] = updated
+	return nil
+}
+
+func removeAt(parent *FML, s pathSeg) (interface{}, error) {
+	key := parent.normalizeKey(s.name)
+	old, ok := parent.dict[key]
+	if !ok {
+		return nil, errPathNotFound
+	}
+	if !s.isItem {
+		delete(parent.dict, key)
+		return old, nil
+	}
+
+	list, _ := old.([]*FML)
+	i := s.find(list)
+	if i == -1 {
+		return nil, errPathNotFound
+	}
+	if len(list) == 1 {
+		//a document has no empty node lists
+		delete(parent.dict, key)
+	} else {
+		parent.dict[key] = append(append([]*FML(nil), list[:i]...), list[i+1:]...)
+	}
+	return list[i], nil
+}
+
+// PatchSource applies the patch to the source of a document, touching only the lines of what changes,
+// so comments and the rest of the source stay as they are.
+// New keys go after the last key of their node or item, new items after the last item of their list,
+// and new nodes to the end. Operations the source can't take in place fail, like adding keys to nodes
+// without headers, and the source is unchanged if any operation fails.
+func PatchSource(src []byte, p Patch) ([]byte, error) {
+	doc, err := Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	out := src
+	for _, op := range p {
+		if err = op.apply(doc); err != nil {
+			return nil, op.error(err)
+		}
+		if out, err = op.applySource(out); err != nil {
+			return nil, op.error(err)
+		}
+		//the source must read as the patched document
+		patched, err := Parse(out)
+		if err != nil || !equalNode(patched, doc, false) {
+			return nil, op.error(errPatchSource)
+		}
+	}
+	return out, nil
+}
+
+func (op Operation) applySource(src []byte) ([]byte, error) {
+	s, err := newSource(src)
+	if err != nil {
+		return nil, err
+	}
+	switch op.Op {
+	case PatchAdd:
+		return s.add(op.Path, op.Value)
+	case PatchRemove:
+		return s.remove(op.Path)
+	case PatchReplace:
+		if out, ok, err := s.replaceValue(op.Path, op.Value); ok || err != nil {
+			return out, err
+		}
+		if src, err = s.remove(op.Path); err != nil {
+			return nil, err
+		}
+	case PatchMove:
+		val, err := getPath(s.doc, op.From)
+		if err != nil {
+			return nil, err
+		}
+		if src, err = s.remove(op.From); err != nil {
+			return nil, err
+		}
+		op.Value = val
+	}
+	//replacing and moving add after removing
+	if s, err = newSource(src); err != nil {
+		return nil, err
+	}
+	return s.add(op.Path, op.Value)
+}
+
+// A source is a document with where its values, node headers and list items are
+type source struct {
+	src    []byte
+	doc    *FML
+	spans  map[string]span
+	starts map[string]int
+}
+
+func newSource(src []byte) (*source, error) {
+	doc, spans, starts, err := parseSource(src)
+	if err != nil {
+		return nil, err
+	}
+	return &source{src: src, doc: doc, spans: spans, starts: starts}, nil
+}
+
+//indexPath turns the selectors of a path into indexes, like "list[name=Abby].age" to "list[0].age".
+//The last segment is kept if it is not found.
+func (s *source) indexPath(path string) (string, error) {
+	segs, err := parsePath(path)
+	if err != nil {
+		return "", err
+	}
+	node := s.doc
+	names := make([]string, len(segs))
+	for i, seg := range segs {
+		names[i] = node.normalizeKey(seg.name)
+		v, ok := node.dict[names[i]]
+		if seg.isItem {
+			list, _ := v.([]*FML)
+			j := seg.find(list)
+			if j == -1 {
+				if i < len(segs)-1 {
+					return "", errPathNotFound
+				}
+				j = seg.index
+				if len(seg.selector) != 0 {
+					j = len(list)
+				}
+			} else {
+				v = list[j]
+			}
+			names[i] += "[" + strconv.Itoa(j) + "]"
+		}
+		if i < len(segs)-1 {
+			if node, ok = v.(*FML); !ok {
+				return "", errPathNotFound
+			}
+		}
+	}
+	return strings.Join(names, "."), nil
+}
+
+func (s *source) edit(start, end int, text string) []byte {
+	out := make([]byte, 0, len(s.src)-(end-start)+len(text))
+	return append(append(append(out, s.src[:start]...), text...), s.src[end:]...)
+}
+
+//lineStart gets where the line of i starts
+func (s *source) lineStart(i int) int {
+	for i > 0 && !IsLineEnd(s.src[i-1]) {
+		i--
+	}
+	return i
+}
+
+//nextLine gets where the line after the one of i starts
+func (s *source) nextLine(i int) int {
+	i += SkipUntilFunc(s.src[i:], IsLineEnd, false)
+	return i + skipLineEnd(s.src[i:])
+}
+
+//contentEnd gets where the last line of a node, a node list or an item ends, the line end included
+func (s *source) contentEnd(path string) int {
+	end := s.starts[path]
+	for p, sp := range s.spans {
+		if isOwnKey(p, path) && sp.end > end {
+			end = sp.end
+		}
+	}
+	for p, start := range s.starts {
+		if isOwnKey(p, path) && start > end {
+			end = start
+		}
+	}
+	return s.nextLine(end)
+}
+
+//isOwnKey reports whether a path is of a key or an item of the node, the node list or the item,
+//not of a sub node. The top level is the empty path.
+func isOwnKey(p, path string) bool {
+	if !strings.HasPrefix(p, path) || len(p) == len(path) {
+		return false
+	}
+	rest := p[len(path):]
+	if len(path) == 0 {
+		return strings.IndexAny(rest, ".[") == -1
+	}
+	if rest[0] == '[' {
+		i := strings.IndexByte(rest, ']')
+		if i == -1 || i == len(rest)-1 {
+			return i != -1
+		}
+		rest = rest[i+1:]
+	}
+	return rest[0] == '.' && strings.IndexAny(rest[1:], ".[") == -1
+}
+
+//keyLine gets where the line of a key starts, where its key starts,
+//and whether it is the first key of a list item
+func (s *source) keyLine(path string) (lineStart, keyStart int, first bool, err error) {
+	sp, ok := s.spans[path]
+	if !ok {
+		return 0, 0, false, errPatchSource
+	}
+	lineStart = s.lineStart(sp.start)
+	keyStart = lineStart + SkipSpace(s.src[lineStart:])
+	if ok, delta := isListPrefix(s.src[keyStart:]); ok {
+		keyStart += delta
+		keyStart += SkipSpace(s.src[keyStart:])
+		first = true
+	} else if s.src[keyStart] == '[' {
+		//a key on the line of a node header
+		return 0, 0, false, errPatchSource
+	}
+	return
+}
+
+func (s *source) remove(path string) ([]byte, error) {
+	path, err := s.indexPath(path)
+	if err != nil {
+		return nil, err
+	}
+	if start, ok := s.starts[path]; ok {
+		list := indexedList(path)
+		if len(list) == 0 {
+			return s.removeNodes(path), nil
+		} else if _, ok := s.starts[list+"[1]"]; !ok {
+			//the only item goes with its list
+			return s.removeNodes(list), nil
+		}
+		return s.edit(start, s.contentEnd(path), ""), nil
+	}
+
+	lineStart, keyStart, first, err := s.keyLine(path)
+	if err != nil {
+		return nil, err
+	}
+	next := s.nextLine(s.spans[path].end)
+	if !first {
+		return s.edit(lineStart, next, ""), nil
+	}
+	//the next key of the item moves up to the line of the list marker
+	if next < len(s.src) && !s.isBlankLine(next) && s.src[next+SkipSpace(s.src[next:])] != '[' {
+		if ok, _ := isListPrefix(s.src[next:]); !ok {
+			return s.edit(keyStart, next+SkipSpace(s.src[next:]), ""), nil
+		}
+	}
+	end := s.spans[path].end
+	return s.edit(keyStart, end+SkipUntilFunc(s.src[end:], IsLineEnd, false), ""), nil
+}
+
+func (s *source) isBlankLine(i int) bool {
+	blank, _ := newParser(nil).isBlankLine(s.src[i:])
+	return blank
+}
+
+//removeNodes removes a node or a node list with its sub nodes, and the blank line after each of them
+func (s *source) removeNodes(path string) []byte {
+	type block struct{ start, end int }
+	var blocks []block
+	for p, start := range s.starts {
+		if (p == path || strings.HasPrefix(p, path+".")) && !strings.HasSuffix(p, "]") {
+			end := s.contentEnd(p)
+			if end < len(s.src) && s.isBlankLine(end) && (start == 0 || IsLineEnd(s.src[start-1])) {
+				end = s.nextLine(end)
+			}
+			blocks = append(blocks, block{start, end})
+		}
+	}
+	//remove from the end, so the blocks before stay where they are
+	sort.Slice(blocks, func(i, j int) bool {
+		return blocks[i].start > blocks[j].start
+	})
+	for _, b := range blocks {
+		s.src = s.edit(b.start, b.end, "")
+	}
+	return s.src
+}
+
+//replaceValue replaces a value in place if neither it nor the new one is a node or a node list
+func (s *source) replaceValue(path string, val interface{}) (out []byte, ok bool, err error) {
+	switch val.(type) {
+	case *FML, []*FML:
+		return nil, false, nil
+	}
+	if path, err = s.indexPath(path); err != nil {
+		return nil, false, err
+	}
+	sp, found := s.spans[path]
+	if !found {
+		return nil, false, nil
+	}
+	lineStart, keyStart, _, err := s.keyLine(path)
+	if err != nil {
+		return nil, false, err
+	}
+	text := valueText(val, keyStart-lineStart)
+	end := sp.end
+	if i := strings.IndexByte(text, '\n'); i != -1 {
+		//a comment after the value stays on the first line
+		end += SkipUntilFunc(s.src[end:], IsLineEnd, false)
+		text = text[:i] + string(s.src[sp.end:end]) + text[i:]
+	}
+	return s.edit(sp.start, end, text), true, nil
+}
+
+//valueText writes a value, the content of a block literal is indented from the column of its key
+func valueText(val interface{}, col int) string {
+	text := wrapVal(val)
+	if col == 0 || !strings.Contains(text, "\n") {
+		return text
+	}
+	lines := strings.Split(text, "\n")
+	for i := 1; i < len(lines); i++ {
+		if len(lines[i]) != 0 {
+			lines[i] = strings.Repeat(" ", col) + lines[i]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (s *source) add(path string, val interface{}) ([]byte, error) {
+	path, err := s.indexPath(path)
+	if err != nil {
+		return nil, err
+	}
+	parent, name := "", path
+	if i := strings.LastIndexByte(path, '.'); i != -1 {
+		parent, name = path[:i], path[i+1:]
+	}
+
+	if list := indexedList(name); len(list) != 0 {
+		return s.addItem(joinPath(parent, list), path, val)
+	}
+	switch val.(type) {
+	case *FML, []*FML:
+		if strings.IndexByte(path, '[') != -1 {
+			//items hold no nodes
+			return nil, errPatchSource
+		}
+		return s.appendNode(path, val), nil
+	}
+	return s.addKey(parent, name, val)
+}
+
+func (s *source) addKey(parent, name string, val interface{}) ([]byte, error) {
+	start, ok := s.starts[parent]
+	if !ok && len(parent) != 0 {
+		return nil, errPatchSource
+	}
+	isItem := strings.HasSuffix(parent, "]")
+	indent := ""
+	if isItem {
+		indent = "  "
+	}
+
+	//after the last key of the node, or after the header
+	last := -1
+	for p, sp := range s.spans {
+		if isOwnKey(p, parent) && sp.end > last {
+			last = sp.end
+		}
+	}
+	if len(parent) == 0 && last == -1 {
+		return s.edit(0, 0, name+": "+valueText(val, 0)+"\n"), nil
+	}
+	if last == -1 && isItem {
+		//an empty item takes the key on the line of its marker
+		at := start + 2
+		if at > len(s.src) || !s.isBlankLine(at-1) {
+			return nil, errPatchSource
+		}
+		end := at + SkipUntilFunc(s.src[at:], IsLineEnd, false)
+		return s.edit(at, end, name+": "+valueText(val, 2)), nil
+	}
+	if last == -1 {
+		last = start
+	}
+	at := s.nextLine(last)
+	text := indent + name + ": " + valueText(val, len(indent)) + "\n"
+	if at == len(s.src) && at > 0 && !IsLineEnd(s.src[at-1]) {
+		text = "\n" + text
+	}
+	return s.edit(at, at, text), nil
+}
+
+func (s *source) addItem(list, path string, val interface{}) ([]byte, error) {
+	item, ok := val.(*FML)
+	if !ok {
+		return nil, errPatchValue
+	}
+	text, ok := itemText(item)
+	if !ok {
+		return nil, errPatchSource
+	}
+	if at, ok := s.starts[path]; ok {
+		//insert before the item at the index
+		return s.edit(at, at, text), nil
+	}
+	if _, ok := s.starts[list]; !ok {
+		if strings.IndexByte(list, '[') != -1 {
+			return nil, errPatchSource
+		}
+		return s.appendNode(list, []*FML{item}), nil
+	}
+	at := s.contentEnd(list)
+	if at == len(s.src) && at > 0 && !IsLineEnd(s.src[at-1]) {
+		text = "\n" + text
+	}
+	return s.edit(at, at, text), nil
+}
+
+//itemText writes an item of a node list, false if it holds nodes
+func itemText(item *FML) (string, bool) {
+	keys := item.KeySet()
+	sort.Strings(keys)
+	if len(keys) == 0 {
+		return "- \n", true
+	}
+	var b strings.Builder
+	for i, k := range keys {
+		switch item.dict[k].(type) {
+		case *FML, []*FML:
+			return "", false
+		}
+		if i == 0 {
+			b.WriteString("- ")
+		} else {
+			b.WriteString("  ")
+		}
+		b.WriteString(k + ": " + valueText(item.dict[k], 2) + "\n")
+	}
+	return b.String(), true
+}
+
+//appendNode writes a node or a node list at the end, after a blank line
+func (s *source) appendNode(path string, val interface{}) []byte {
+	var b strings.Builder
+	if len(s.src) != 0 {
+		if !IsLineEnd(s.src[len(s.src)-1]) {
+			b.WriteByte('\n')
+		}
+		b.WriteByte('\n')
+	}
+	writeNodeSource(&b, path, val)
+	return s.edit(len(s.src), len(s.src), strings.TrimSuffix(b.String(), "\n\n")+"\n")
+}
+
+//writeNodeSource writes a node with its keys first and then its sub nodes, or a node list
+func writeNodeSource(b *strings.Builder, path string, val interface{}) {
+	b.WriteString("[" + path + "]\n")
+	if list, ok := val.([]*FML); ok {
+		for _, item := range list {
+			text, _ := itemText(item)
+			b.WriteString(text)
+		}
+		b.WriteString("\n")
+		return
+	}
+
+	node := val.(*FML)
+	keys := node.KeySet()
+	sort.Strings(keys)
+	var nodes []string
+	for _, k := range keys {
+		switch node.dict[k].(type) {
+		case *FML, []*FML:
+			nodes = append(nodes, k)
+		default:
+			b.WriteString(k + ": " + valueText(node.dict[k], 0) + "\n")
+		}
+	}
+	b.WriteString("\n")
+	for _, k := range nodes {
+		writeNodeSource(b, path+"."+k, node.dict[k])
+	}
+}
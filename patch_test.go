@@ -0,0 +1,162 @@
+package fml
+
+import (
+	"strings"
+	"testing"
+)
+
+const patchDoc = `# the app
+name: demo # the name
+port: 1433
+
+[db]
+host: localhost # the host
+user: admin
+
+[staff]
+- name: Abby
+  age: 12
+- name: Tony
+  age: 13
+`
+
+func TestApplyPatch(t *testing.T) {
+	doc, _ := ParseString(patchDoc)
+	tony := NewFml()
+	tony.SetValue("age", 14)
+	err := doc.ApplyPatch(Patch{
+		{Op: PatchReplace, Path: "port", Value: 5432},
+		{Op: PatchMove, From: "db.user", Path: "db.login"},
+		{Op: PatchRemove, Path: "staff[name=Abby]"},
+		{Op: PatchAdd, Path: "staff[0]", Value: tony},
+	})
+	if err != nil {
+		t.Fatal("Should apply patch, err:", err)
+	}
+	staff, _ := doc.GetNodeList("staff")
+	if doc.GetInt("port") != 5432 || doc.Has("db.user") || doc.GetString("db.login") != "admin" ||
+		len(staff) != 2 || staff[0].GetInt("age") != 14 || staff[1].GetString("name") != "Tony" {
+		t.Error("Should get patched document, got:", doc)
+	}
+
+	err = doc.ApplyPatch(Patch{
+		{Op: PatchReplace, Path: "port", Value: 1},
+		{Op: PatchRemove, Path: "db.missing"},
+	})
+	if err == nil || err.Error() != "patch remove db.missing failed: path not found" || doc.GetInt("port") != 5432 {
+		t.Error("Should fail as a whole, err:", err)
+	}
+	for _, op := range []Operation{
+		{Op: PatchAdd, Path: "port", Value: 1},
+		{Op: PatchAdd, Path: "x", Value: int64(1)},
+		{Op: PatchAdd, Path: "staff[5]", Value: NewFml()},
+		{Op: PatchReplace, Path: "a[", Value: 1},
+		{Op: "copy", Path: "port"},
+	} {
+		if err = doc.ApplyPatch(Patch{op}); err == nil {
+			t.Error("Should reject", op)
+		}
+	}
+}
+
+func TestNewPatch(t *testing.T) {
+	a, _ := ParseString(patchDoc)
+	b, _ := ParseString(`name: demo
+port: 5432
+debug: true
+
+[db]
+host: db.local
+
+[staff]
+- name: Tony
+  age: 14
+
+[cache]
+size: 10
+`)
+	for _, opts := range [][]DiffOption{nil, {WithIdentityKey("name")}} {
+		doc, _ := ParseString(patchDoc)
+		if err := doc.ApplyPatch(NewPatch(Diff(a, b, opts...))); err != nil {
+			t.Fatal("Should apply the diff, err:", err)
+		}
+		if changes := Diff(doc, b); len(changes) != 0 {
+			t.Error("Should get the new document, got:", changes)
+		}
+	}
+
+	//identity values quoted in paths
+	e, _ := ParseString("[staff]\n- name: Aaff]\n")
+	f, _ := ParseString("[staff]\n- name: Aaff].00\n- name: \"a.[b\\\"]\"\n")
+	if err := e.ApplyPatch(NewPatch(Diff(e, f, WithIdentityKey("name")))); err != nil || len(Diff(e, f)) != 0 {
+		t.Error("Should find items by quoted values, err:", err)
+	}
+	for _, path := range []string{`staff[name="a].x`, `staff[name="a"b]`} {
+		if err := e.ApplyPatch(Patch{{Op: PatchRemove, Path: path}}); err == nil || !strings.Contains(err.Error(), "invalid path") {
+			t.Error("Should reject", path, "got:", err)
+		}
+	}
+
+	//items removed by index
+	c, _ := ParseString("[l]\n- a: 1\n- a: 2\n- a: 3\n")
+	d, _ := ParseString("[l]\n- a: 1\n")
+	if err := c.ApplyPatch(NewPatch(Diff(c, d))); err != nil || len(Diff(c, d)) != 0 {
+		t.Error("Should remove items from the last, err:", err)
+	}
+}
+
+func TestParsePatch(t *testing.T) {
+	p, err := ParsePatch([]byte("[patch]\n- op: replace\n  path: db.port\n  value: 5432\n- op: move\n  from: a\n  path: b\n"))
+	if err != nil || len(p) != 2 || p[0] != (Operation{Op: PatchReplace, Path: "db.port", Value: 5432}) ||
+		p[1] != (Operation{Op: PatchMove, From: "a", Path: "b"}) {
+		t.Error("Should parse patch, got:", p, err)
+	}
+	if _, err = ParsePatch([]byte("[patch]\n- op: copy\n")); err == nil {
+		t.Error("Should reject unknown operations")
+	}
+}
+
+func TestPatchSource(t *testing.T) {
+	item := NewFml()
+	item.SetValue("name", "Lily")
+	item.SetValue("age", 11)
+	cache := NewFml()
+	cache.SetValue("size", 10)
+
+	cases := []struct {
+		patch    Patch
+		expected string
+	}{
+		{Patch{{Op: PatchReplace, Path: "port", Value: 5432}},
+			"# the app\nname: demo # the name\nport: 5432\n"},
+		{Patch{{Op: PatchAdd, Path: "db.port", Value: 5432}, {Op: PatchRemove, Path: "db.user"}},
+			"[db]\nhost: localhost # the host\nport: 5432\n\n"},
+		{Patch{{Op: PatchRemove, Path: "staff[name=Abby].name"}},
+			"[staff]\n- age: 12\n- name: Tony\n"},
+		{Patch{{Op: PatchAdd, Path: "staff[name=Lily]", Value: item}},
+			"  age: 13\n- age: 11\n  name: Lily\n"},
+		{Patch{{Op: PatchRemove, Path: "staff[0]"}},
+			"[staff]\n- name: Tony\n"},
+		{Patch{{Op: PatchRemove, Path: "db"}},
+			"port: 1433\n\n[staff]\n"},
+		{Patch{{Op: PatchAdd, Path: "cache", Value: cache}},
+			"  age: 13\n\n[cache]\nsize: 10\n"},
+		{Patch{{Op: PatchMove, From: "db.host", Path: "host"}, {Op: PatchReplace, Path: "name", Value: "a\nb\n"}},
+			"name: | # the name\n  a\n  b\nport: 1433\nhost: localhost\n\n[db]\nuser: admin\n"},
+	}
+	for _, c := range cases {
+		out, err := PatchSource([]byte(patchDoc), c.patch)
+		if err != nil {
+			t.Error("Should patch the source, err:", err)
+			continue
+		}
+		if !strings.Contains(string(out), c.expected) {
+			t.Errorf("Should patch in place, expected %q in:\n%s", c.expected, out)
+		}
+	}
+
+	_, err := PatchSource([]byte(patchDoc), Patch{{Op: PatchReplace, Path: "port", Value: 1}, {Op: PatchRemove, Path: "x"}})
+	if err == nil {
+		t.Error("Should fail on a missing path")
+	}
+}
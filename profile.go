@@ -0,0 +1,84 @@
+package fml
+
+import "strings"
+
+// ProfileEnv is the environment variable naming the active profile for LoadWithProfile.
+const ProfileEnv = "FML_PROFILE"
+
+// An override is an entry of the active profile, it is applied after the whole document is parsed,
+// so it wins over the unqualified entry wherever they are.
+type override struct {
+	doc *FML
+	key string
+	val interface{}
+}
+
+// splitProfile splits a name like "database@prod" into the name and the profile,
+// a name is kept as it is if it is not qualified with a known profile, like "email@host"
+func (p *parser) splitProfile(name string) (string, string) {
+	i := strings.LastIndexByte(name, '@')
+	if i <= 0 {
+		return name, ""
+	}
+	profile := strings.TrimSpace(name[i+1:])
+	if !p.isKnownProfile(profile) {
+		return name, ""
+	}
+	return strings.TrimSpace(name[:i]), profile
+}
+
+//isKnownProfile reports whether the profile is the active one or one of the known profiles
+func (p *parser) isKnownProfile(profile string) bool {
+	if len(p.opts.Profile) != 0 && p.sameProfile(profile, p.opts.Profile) {
+		return true
+	}
+	return p.isListedProfile(profile)
+}
+
+func (p *parser) isListedProfile(profile string) bool {
+	for _, known := range p.opts.Profiles {
+		if p.sameProfile(profile, known) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) isActiveProfile(profile string) bool {
+	return len(profile) == 0 || p.sameProfile(profile, p.opts.Profile)
+}
+
+func (p *parser) sameProfile(a, b string) bool {
+	if p.opts.IgnoreCase {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+func (p *parser) addOverride(doc *FML, key string, val interface{}) {
+	p.overrides = append(p.overrides, override{doc: doc, key: key, val: val})
+}
+
+func (p *parser) applyOverrides() {
+	for _, o := range p.overrides {
+		p.overrideValue(o.doc, o.key, o.val)
+	}
+}
+
+// overrideValue sets the value, a node is merged deeply into the existing one.
+func (p *parser) overrideValue(doc *FML, key string, val interface{}) {
+	dst, ok1 := doc.dict[key].(*FML)
+	src, ok2 := val.(*FML)
+	if !ok1 || !ok2 {
+		doc.dict[key] = val
+		return
+	}
+
+	if ext, ok := p.extensions[src]; ok {
+		p.addExtension(dst, ext.path, ext.base)
+		delete(p.extensions, src)
+	}
+	for k, v := range src.dict {
+		p.overrideValue(dst, k, v)
+	}
+}
@@ -0,0 +1,100 @@
+package fml
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const profileInput = `name: app
+level@prod: warn
+level: debug
+
+[database@prod]
+host: db.prod
+user@staging: stage
+
+[database]
+host: localhost
+port: 5432
+
+[database.pool@prod]
+max: 50
+
+[database@staging]
+host: db.staging
+`
+
+func TestParseWithProfile(t *testing.T) {
+	profiles := WithProfiles("prod", "staging")
+	doc, err := ParseWithOptions([]byte(profileInput), profiles, WithProfile("prod"))
+	if err != nil {
+		t.Fatal("Should parse, err:", err)
+	}
+	if doc.GetString("level") != "warn" || doc.GetString("name") != "app" {
+		t.Error("Active profile key should override, level:", doc.GetString("level"))
+	}
+	if doc.GetString("database.host") != "db.prod" || doc.GetInt("database.port") != 5432 ||
+		doc.GetInt("database.pool.max") != 50 {
+		t.Error("Active profile node should be merged deeply")
+	}
+	if doc.Has("database.user") || doc.Has("level@prod") {
+		t.Error("Inactive profile entries should be dropped")
+	}
+
+	doc, err = ParseWithOptions([]byte(profileInput), profiles)
+	if err != nil {
+		t.Fatal("Should parse, err:", err)
+	}
+	if doc.GetString("level") != "debug" || doc.GetString("database.host") != "localhost" || doc.Has("database.pool") {
+		t.Error("Profile entries should be dropped without profile")
+	}
+
+	doc, err = ParseWithOptions([]byte("email@host: a\nlevel@prod: warn\n\n[mirror@eu]\nhost: m\n"), profiles, WithProfile("prod"))
+	if err != nil || doc.GetString("email@host") != "a" || doc.GetString("level") != "warn" {
+		t.Error("Keys of unknown profiles should be kept as they are, got:", doc, err)
+	}
+	if node, _ := doc.GetNode("mirror@eu"); node == nil || node.GetString("host") != "m" {
+		t.Error("Nodes of unknown profiles should be kept as they are, got:", doc)
+	}
+	doc, err = ParseString(profileInput)
+	if err != nil || doc.GetString("level@prod") != "warn" || !doc.Has("database@staging") {
+		t.Error("Names should be kept as they are without known profiles, got:", doc, err)
+	}
+	_, err = ParseWithOptions([]byte(profileInput), profiles, WithProfile("prd"))
+	if err == nil || err.Error() != "parse fml failed: unknown profile: prd" {
+		t.Error("Should report an unknown profile, got:", err)
+	}
+}
+
+func TestLoadWithProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.fml")
+	ioutil.WriteFile(path, []byte(profileInput), 0644)
+
+	os.Setenv(ProfileEnv, "staging")
+	defer os.Unsetenv(ProfileEnv)
+
+	doc, err := LoadWithProfile(path, "", WithProfiles("prod", "staging"))
+	if err != nil || doc.GetString("database.host") != "db.staging" {
+		t.Error("Should use the profile from environment, err:", err)
+	}
+
+	doc, err = LoadWithProfile(path, "prod", WithProfiles("prod", "staging"))
+	if err != nil || doc.GetString("database.host") != "db.prod" {
+		t.Error("Should use the given profile, err:", err)
+	}
+
+	doc, err = LoadWithProfile(path, "prod")
+	if err != nil || doc.GetString("database.host") != "db.prod" || doc.GetString("level") != "warn" || doc.Has("level@prod") {
+		t.Error("Should know the given profile without WithProfiles, err:", err)
+	}
+	if !doc.Has("database@staging") {
+		t.Error("Should keep entries of other profiles without WithProfiles, got:", doc)
+	}
+}
@@ -0,0 +1,179 @@
+package fml
+
+import (
+	"bufio"
+	"bytes"
+	"path"
+	"reflect"
+	"strings"
+)
+
+// DefaultMask replaces sensitive values.
+const DefaultMask = "******"
+
+// A Redactor decides which values are sensitive, and masks them when a document is written or dumped.
+type Redactor struct {
+	// Patterns match names of keys or nodes case-insensitively, like "*password*".
+	// A key is sensitive if its name or the name of any node containing it matches.
+	Patterns []string
+	// Keys are paths of sensitive keys, like "database.password".
+	// Items of node lists share the path of the list, like "servers.password".
+	Keys []string
+	// Mask replaces sensitive values, DefaultMask if empty.
+	Mask string
+}
+
+// DefaultRedactor is used by String, IterateFimlDoc and parsing errors.
+var DefaultRedactor = &Redactor{
+	Patterns: []string{"*password*", "*passwd*", "*secret*", "*token*", "*credential*",
+		"*apikey*", "*api_key*", "*private_key*", "*privatekey*"},
+}
+
+// NewRedactor creates a redactor with the key name patterns.
+func NewRedactor(patterns ...string) *Redactor {
+	return &Redactor{Patterns: patterns}
+}
+
+// AddKeys marks the key paths sensitive.
+func (r *Redactor) AddKeys(keys ...string) *Redactor {
+	r.Keys = append(r.Keys, keys...)
+	return r
+}
+
+// AddStruct marks the keys of struct fields tagged with `fml:",secret"` sensitive,
+// v is a struct or a pointer to a struct.
+func (r *Redactor) AddStruct(v interface{}) *Redactor {
+	t := reflect.TypeOf(v)
+	if t != nil {
+		r.addStructType(t, "", make(map[reflect.Type]bool))
+	}
+	return r
+}
+
+func (r *Redactor) addStructType(t reflect.Type, prefix string, seen map[reflect.Type]bool) {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == timeType || seen[t] {
+		return
+	}
+	seen[t] = true
+	defer delete(seen, t)
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, opts := parseTag(f.Tag.Get("fml"))
+		if name == "-" || f.PkgPath != "" {
+			continue
+		}
+		if len(name) == 0 {
+			name = f.Name
+		}
+		if len(prefix) != 0 {
+			name = prefix + "." + name
+		}
+		if hasOpt(opts, "secret") {
+			r.Keys = append(r.Keys, name)
+		} else {
+			r.addStructType(f.Type, name, seen)
+		}
+	}
+}
+
+// IsSensitive reports whether the value of the key path is sensitive.
+func (r *Redactor) IsSensitive(key string) bool {
+	if r == nil {
+		return false
+	}
+	key = strings.ToLower(stripIndexes(key))
+	for _, k := range r.Keys {
+		if strings.ToLower(k) == key || strings.HasPrefix(key, strings.ToLower(k)+".") {
+			return true
+		}
+	}
+
+	names := strings.Split(key, ".")
+	for _, pattern := range r.Patterns {
+		pattern = strings.ToLower(pattern)
+		for _, name := range names {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r *Redactor) mask() string {
+	if len(r.Mask) == 0 {
+		return DefaultMask
+	}
+	return r.Mask
+}
+
+// redactVal wraps a value, or the mask if it is sensitive
+func (r *Redactor) redactVal(key string, val interface{}) string {
+	if r.IsSensitive(key) {
+		return r.mask()
+	}
+	return wrapVal(val)
+}
+
+// redactInline wraps a value on a single line, or the mask if it is sensitive
+func (r *Redactor) redactInline(key string, val interface{}) string {
+	if r.IsSensitive(key) {
+		return r.mask()
+	}
+	return wrapInline(val)
+}
+
+//stripIndexes removes indexes of node list items from a path, "a[0].b" becomes "a.b"
+func stripIndexes(key string) string {
+	if strings.IndexByte(key, '[') == -1 {
+		return key
+	}
+	var b strings.Builder
+	skip := false
+	for i := 0; i < len(key); i++ {
+		switch {
+		case key[i] == '[':
+			skip = true
+		case key[i] == ']':
+			skip = false
+		case !skip:
+			b.WriteByte(key[i])
+		}
+	}
+	return b.String()
+}
+
+// WriteRedactedTo writes the node like WriteTo, with sensitive values masked.
+func (f *FML) WriteRedactedTo(writer *bufio.Writer, r *Redactor) {
+	f.rlock()
+	defer f.runlock()
+	f.writeTo("", writer, r)
+}
+
+// Dump returns the node in fml format with sensitive values masked.
+func (f *FML) Dump(r *Redactor) string {
+	buf := &bytes.Buffer{}
+	writer := bufio.NewWriter(buf)
+	f.WriteRedactedTo(writer, r)
+	writer.Flush()
+	return buf.String()
+}
+
+// String returns the node in fml format, values found sensitive by DefaultRedactor are masked.
+func (f *FML) String() string {
+	return f.Dump(DefaultRedactor)
+}
+
+//redactPanic rewrites a parsing error of a sensitive key, so it never quotes the value
+func redactPanic(key string) {
+	if r := recover(); r != nil {
+		if DefaultRedactor.IsSensitive(key) {
+			panic(invalidValue + key)
+		}
+		panic(r)
+	}
+}
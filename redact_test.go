@@ -0,0 +1,84 @@
+package fml
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedactor(t *testing.T) {
+	r := NewRedactor("*password*", "credentials")
+	r.AddKeys("database.dsn")
+
+	sensitive := []string{"password", "database.Password", "db_password", "credentials.user",
+		"database.dsn", "servers[1].password"}
+	for _, key := range sensitive {
+		if !r.IsSensitive(key) {
+			t.Error("Should be sensitive:", key)
+		}
+	}
+	if r.IsSensitive("database.host") || r.IsSensitive("dsn") {
+		t.Error("Should NOT be sensitive")
+	}
+
+	type DB struct {
+		Host  string
+		Token string `fml:"api_token,secret"`
+	}
+	type Config struct {
+		DB      DB `fml:"database"`
+		Servers []DB
+	}
+	r = NewRedactor().AddStruct(&Config{})
+	if !r.IsSensitive("database.api_token") || !r.IsSensitive("servers[0].api_token") ||
+		r.IsSensitive("database.host") {
+		t.Error("Should get sensitive keys from struct tags, keys:", r.Keys)
+	}
+}
+
+func TestDump(t *testing.T) {
+	doc := NewFml()
+	doc.SetValue("user", "tony")
+	db := NewFml()
+	db.SetValue("password", "s3cret")
+	db.SetValue("port", 5432)
+	doc.SetValue("database", db)
+
+	output := doc.String()
+	if strings.Contains(output, "s3cret") || !strings.Contains(output, "password:"+DefaultMask) ||
+		!strings.Contains(output, "port:5432") {
+		t.Error("Should mask password, output:", output)
+	}
+
+	output = doc.Dump(&Redactor{Keys: []string{"database.port"}, Mask: "xxx"})
+	if !strings.Contains(output, "s3cret") || !strings.Contains(output, "port:xxx") {
+		t.Error("Should mask port only, output:", output)
+	}
+}
+
+func TestRedactParseError(t *testing.T) {
+	defer func() {
+		r := recover()
+		if msg, _ := r.(string); strings.Contains(msg, `\q`) || !strings.Contains(msg, "password") {
+			t.Error("Should redact error of sensitive key, got:", r)
+		}
+	}()
+	testParser.extractKeyValue([]byte(`password: "a\qb"`), NewFml())
+}
+
+func TestGetStructByTag(t *testing.T) {
+	type DB struct {
+		Host     string `fml:"hostname"`
+		Password string `fml:",secret"`
+		Ignored  string `fml:"-"`
+	}
+	doc := NewFml()
+	doc.SetValue("hostname", "local")
+	doc.SetValue("password", "s3cret")
+	doc.SetValue("Ignored", "x")
+
+	db := new(DB)
+	getStruct(doc, db)
+	if db.Host != "local" || db.Password != "s3cret" || db.Ignored != "" {
+		t.Error("Should get struct by tags, db:", db)
+	}
+}
@@ -0,0 +1,545 @@
+// Package scanner splits fml source into tokens with their exact byte spans,
+// for tools like editors, linters and syntax highlighters.
+//
+// The tokens follow how fml.Parse reads the source. For example, a line
+// starting with "- " is a list item only right after a node header or inside
+// a node list, anywhere else it is a key starting with "- ".
+//
+// By default scanning stops at the first error. With WithFaultTolerance,
+// the rest of the failed line becomes an Illegal token and scanning goes on
+// from the next line.
+package scanner
+
+import (
+	"bytes"
+)
+
+const (
+	invalidNodeName        = "invalid node name"
+	invalidKeyName         = "invalid key name"
+	invalidValueEnd        = "unexpected content after value"
+	invalidArray           = "invalid array"
+	literalClosingErr      = "literal is not closed"
+	multipleLineClosingErr = "multiple line literal is not closed"
+	quotedClosingErr       = "quoted string is not closed"
+)
+
+var multipleLiteral = []byte("```")
+
+// An Option sets a scanning option.
+type Option func(*Scanner)
+
+// WithDelimiters sets the accepted delimiters between keys and values, ":=" by default.
+func WithDelimiters(delimiters string) Option {
+	return func(s *Scanner) {
+		s.delimiters = [256]bool{}
+		for i := 0; i < len(delimiters); i++ {
+			s.delimiters[delimiters[i]] = true
+		}
+	}
+}
+
+// WithCommentChars sets the characters starting a comment, "#" by default.
+func WithCommentChars(chars string) Option {
+	return func(s *Scanner) {
+		s.comments = [256]bool{}
+		for i := 0; i < len(chars); i++ {
+			s.comments[chars[i]] = true
+		}
+	}
+}
+
+// WithFaultTolerance keeps scanning after errors.
+func WithFaultTolerance() Option {
+	return func(s *Scanner) {
+		s.tolerant = true
+	}
+}
+
+//listState is whether a line starting with "- " is a list item
+type listState int
+
+const (
+	noList listState = iota
+	//the line after a node header may start a node list
+	afterHeader
+	//after a comment on the line of a node header, comment lines and a blank line
+	//may come before the node list
+	afterHeaderComment
+	//inside an item of a node list
+	inList
+	//a blank line inside a node list, the next line may start another item
+	afterListBlank
+)
+
+// A Scanner produces the tokens of a source.
+type Scanner struct {
+	src        []byte
+	delimiters [256]bool
+	comments   [256]bool
+	tolerant   bool
+
+	pos    int
+	list   listState
+	tokens []Token
+	errors []*Error
+	done   bool
+}
+
+// New creates a scanner of src.
+func New(src []byte, opts ...Option) *Scanner {
+	s := &Scanner{src: src}
+	WithDelimiters(":=")(s)
+	WithCommentChars("#")(s)
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Scan gets all tokens of src, ending with EOF.
+// Without WithFaultTolerance the error is the first one, and the tokens end at it.
+func Scan(src []byte, opts ...Option) (tokens []Token, err error) {
+	s := New(src, opts...)
+	for {
+		t := s.Next()
+		tokens = append(tokens, t)
+		if t.Kind == EOF {
+			break
+		}
+	}
+	if errs := s.Errors(); len(errs) != 0 {
+		err = errs[0]
+	}
+	return
+}
+
+// Next gets the next token, it keeps returning EOF at the end.
+func (s *Scanner) Next() Token {
+	for len(s.tokens) == 0 {
+		if s.done || s.pos >= len(s.src) {
+			s.done = true
+			return Token{EOF, len(s.src), len(s.src)}
+		}
+		s.scanLine()
+	}
+	t := s.tokens[0]
+	s.tokens = s.tokens[1:]
+	return t
+}
+
+// Text gets the source text of a token.
+func (s *Scanner) Text(t Token) string {
+	return string(s.src[t.Start:t.End])
+}
+
+// Errors gets the errors so far.
+func (s *Scanner) Errors() []*Error {
+	return s.errors
+}
+
+// Position gets the line and the column of an offset, both start from 1.
+func (s *Scanner) Position(offset int) (line, col int) {
+	if offset > len(s.src) {
+		offset = len(s.src)
+	}
+	lineStart := bytes.LastIndexByte(s.src[:offset], '\n') + 1
+	return bytes.Count(s.src[:offset], []byte{'\n'}) + 1, offset - lineStart + 1
+}
+
+func (s *Scanner) emit(kind Kind, start, end int) {
+	s.tokens = append(s.tokens, Token{kind, start, end})
+}
+
+//fail records an error at i, the rest of the line is illegal
+func (s *Scanner) fail(i int, msg string) {
+	s.failSpan(i, i, s.lineEnd(i), msg)
+}
+
+//failSpan records an error at i, src[start:end] is illegal
+func (s *Scanner) failSpan(i, start, end int, msg string) {
+	line, col := s.Position(i)
+	s.errors = append(s.errors, &Error{Offset: i, Line: line, Col: col, Msg: msg})
+	s.emit(Illegal, start, end)
+	if !s.tolerant {
+		s.done = true
+		return
+	}
+	s.list = noList
+	s.pos = s.newline(end)
+}
+
+//scanLine scans from the start of a line to the start of the next one,
+//or further for multiple line values
+func (s *Scanner) scanLine() {
+	s.scanContent(s.skipSpace(s.pos), true)
+}
+
+//scanContent scans from i to the end of the line, i is where the content of a line starts
+func (s *Scanner) scanContent(i int, listAllowed bool) {
+	switch {
+	case s.isLineEnd(i):
+		s.blankLine(i, false)
+	case s.comments[s.src[i]]:
+		s.blankLine(s.comment(i), true)
+	case s.src[i] == '[':
+		s.header(i)
+	case listAllowed && s.isListPrefix(i) && s.list != noList:
+		s.emit(ListMarker, i, i+1)
+		s.list = inList
+		i = s.skipSpace(i + 2)
+		if s.isLineEnd(i) || s.comments[s.src[i]] {
+			//an empty item
+			s.list = afterListBlank
+			if !s.isLineEnd(i) {
+				i = s.comment(i)
+			}
+			s.pos = s.newline(i)
+			return
+		}
+		s.scanContent(i, false)
+	default:
+		if s.list != inList {
+			s.list = noList
+		}
+		s.keyValue(i)
+	}
+}
+
+//blankLine ends a line with nothing but spaces or a comment
+func (s *Scanner) blankLine(i int, comment bool) {
+	switch s.list {
+	case inList:
+		s.list = afterListBlank
+	case afterHeaderComment:
+		if !comment {
+			s.list = afterHeader
+		}
+	default:
+		s.list = noList
+	}
+	s.pos = s.newline(i)
+}
+
+func (s *Scanner) header(i int) {
+	end := i + 1
+	for end < len(s.src) && s.src[end] != ']' && !isLineEnd(s.src[end]) {
+		end++
+	}
+	if end >= len(s.src) || s.src[end] != ']' || !validNodeName(s.src[i+1:end]) {
+		s.fail(i, invalidNodeName)
+		return
+	}
+	s.emit(NodeHeader, i, end+1)
+	i = s.skipSpace(end + 1)
+	switch {
+	case s.isLineEnd(i):
+		s.list = afterHeader
+		s.pos = s.newline(i)
+	case s.comments[s.src[i]]:
+		s.list = afterHeaderComment
+		s.pos = s.newline(s.comment(i))
+	default:
+		//the content after a node header belongs to the node
+		s.list = afterHeader
+		s.scanContent(i, true)
+	}
+}
+
+//validNodeName checks a name like a.b or a.b : base
+func validNodeName(name []byte) bool {
+	if i := bytes.IndexByte(name, ':'); i != -1 {
+		if len(bytes.TrimSpace(name[i+1:])) == 0 {
+			return false
+		}
+		name = name[:i]
+	}
+	for _, seg := range bytes.Split(name, []byte{'.'}) {
+		if len(bytes.TrimSpace(seg)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Scanner) keyValue(i int) {
+	d := i
+	for d < len(s.src) && !s.delimiters[s.src[d]] && !isLineEnd(s.src[d]) {
+		d++
+	}
+	from, to := i, d
+	for to > from && isSpace(s.src[to-1]) {
+		to--
+	}
+	if d >= len(s.src) || !s.delimiters[s.src[d]] || to == from {
+		s.fail(i, invalidKeyName)
+		return
+	}
+	for k := from; k < to; k++ {
+		if s.src[k] < ' ' || s.src[k] == 0x7f {
+			s.fail(i, invalidKeyName)
+			return
+		}
+	}
+	s.emit(Key, from, to)
+	s.emit(Delimiter, d, d+1)
+
+	i = s.skipSpace(d + 1)
+	if s.isLineEnd(i) {
+		s.pos = s.newline(i)
+		return
+	}
+	if s.comments[s.src[i]] {
+		s.pos = s.newline(s.comment(i))
+		return
+	}
+	s.value(i)
+}
+
+func (s *Scanner) value(i int) {
+	var end int
+	var ok bool
+	switch s.src[i] {
+	case '`':
+		end, ok = s.literal(i)
+	case '"', '\'':
+		end, ok = s.quoted(i)
+		if !ok {
+			s.fail(i, quotedClosingErr)
+			return
+		}
+		s.emit(String, i, end)
+	case '[':
+		end, ok = s.array(i)
+	case '|', '>':
+		if s.isBlockLiteralHeader(i) {
+			s.blockLiteral(i)
+			return
+		}
+		fallthrough
+	default:
+		end, ok = s.raw(i), true
+		s.emit(Scalar, i, end)
+	}
+	if !ok {
+		return
+	}
+
+	end = s.skipSpace(end)
+	if !s.isLineEnd(end) && s.comments[s.src[end]] {
+		end = s.comment(end)
+	}
+	if !s.isLineEnd(end) {
+		s.fail(end, invalidValueEnd)
+		return
+	}
+	s.pos = s.newline(end)
+}
+
+//raw gets where a raw value ends, at the line end or a comment after a space,
+//trailing spaces excluded
+func (s *Scanner) raw(i int) int {
+	end := i
+	for end < len(s.src) && !isLineEnd(s.src[end]) {
+		if end > i && s.comments[s.src[end]] && isSpace(s.src[end-1]) {
+			end--
+			break
+		}
+		end++
+	}
+	for end > i && isSpace(s.src[end-1]) {
+		end--
+	}
+	return end
+}
+
+func (s *Scanner) literal(i int) (int, bool) {
+	if len(s.src)-i > 6 && bytes.HasPrefix(s.src[i:], multipleLiteral) {
+		end := bytes.Index(s.src[i+3:], multipleLiteral)
+		if end == -1 {
+			s.failSpan(i, i, len(s.src), multipleLineClosingErr)
+			return 0, false
+		}
+		end += i + 6
+		s.emit(Literal, i, end)
+		return end, true
+	}
+	end := i + 1
+	for end < len(s.src) && s.src[end] != '`' && !isLineEnd(s.src[end]) {
+		end++
+	}
+	if end >= len(s.src) || s.src[end] != '`' {
+		s.fail(i, literalClosingErr)
+		return 0, false
+	}
+	s.emit(Literal, i, end+1)
+	return end + 1, true
+}
+
+//quoted gets where a quoted string ends, a double-quoted one may escape quotes
+func (s *Scanner) quoted(i int) (int, bool) {
+	quote := s.src[i]
+	escaped := false
+	for end := i + 1; end < len(s.src) && !isLineEnd(s.src[end]); end++ {
+		c := s.src[end]
+		if quote == '"' && c == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		if c == quote && !escaped {
+			return end + 1, true
+		}
+		escaped = false
+	}
+	return 0, false
+}
+
+//array scans the items of an array, they may span lines.
+//If it fails, the tokens of the array are dropped and it is illegal as a whole.
+func (s *Scanner) array(i int) (int, bool) {
+	tokens := len(s.tokens)
+	fail := func(at int, msg string) (int, bool) {
+		s.tokens = s.tokens[:tokens]
+		end := len(s.src)
+		if at != i {
+			end = s.lineEnd(at)
+		}
+		s.failSpan(at, i, end, msg)
+		return 0, false
+	}
+
+	s.emit(ArrayStart, i, i+1)
+	from, kind := -1, Scalar
+	item := func(to int) {
+		for to > from && (isSpace(s.src[to-1]) || isLineEnd(s.src[to-1])) {
+			to--
+		}
+		s.emit(kind, from, to)
+		from = -1
+	}
+	for end := i + 1; end < len(s.src); end++ {
+		switch c := s.src[end]; c {
+		case '"', '\'':
+			//a quoted item is a string, unless it's followed by more
+			kind = Scalar
+			if from == -1 {
+				from, kind = end, String
+			}
+			q, ok := s.quoted(end)
+			if !ok {
+				return fail(end, quotedClosingErr)
+			}
+			end = q - 1
+		case ' ', '\t', '\n', '\r', '\f':
+		case ',':
+			if from == -1 {
+				return fail(end, invalidArray)
+			}
+			item(end)
+			s.emit(Comma, end, end+1)
+		case ']':
+			if from != -1 {
+				item(end)
+			}
+			s.emit(ArrayEnd, end, end+1)
+			return end + 1, true
+		default:
+			if from == -1 {
+				from = end
+			}
+			kind = Scalar
+		}
+	}
+	return fail(i, invalidArray)
+}
+
+//A block literal header is '|' or '>', optionally followed by '-',
+//and nothing but spaces or a comment on the rest of the line.
+func (s *Scanner) isBlockLiteralHeader(i int) bool {
+	i++
+	if i < len(s.src) && s.src[i] == '-' {
+		i++
+	}
+	i = s.skipSpace(i)
+	return s.isLineEnd(i) || s.comments[s.src[i]]
+}
+
+//blockLiteral scans the header and the content lines, which are more indented than 0
+//and not less than the first one, trailing blank lines excluded
+func (s *Scanner) blockLiteral(i int) {
+	end := s.lineEnd(i)
+	next := s.nextLine(end)
+	indent := -1
+	for next < len(s.src) {
+		lineEnd := s.lineEnd(next)
+		n := s.skipSpace(next) - next
+		if next+n < lineEnd {
+			if indent == -1 {
+				indent = n
+			}
+			if n == 0 || n < indent {
+				break
+			}
+			end = lineEnd
+		}
+		next = s.nextLine(lineEnd)
+	}
+	s.emit(Literal, i, end)
+	s.pos = s.newline(end)
+}
+
+func (s *Scanner) comment(i int) int {
+	end := s.lineEnd(i)
+	s.emit(Comment, i, end)
+	return end
+}
+
+//newline emits the line end at i if any, and gets where the next line starts
+func (s *Scanner) newline(i int) int {
+	end := s.nextLine(i)
+	if end > i {
+		s.emit(Newline, i, end)
+	}
+	return end
+}
+
+//nextLine gets where the next line starts, i is at a line end
+func (s *Scanner) nextLine(i int) int {
+	if i >= len(s.src) {
+		return i
+	}
+	if s.src[i] == '\r' && i+1 < len(s.src) && s.src[i+1] == '\n' {
+		return i + 2
+	}
+	return i + 1
+}
+
+func (s *Scanner) lineEnd(i int) int {
+	for i < len(s.src) && !isLineEnd(s.src[i]) {
+		i++
+	}
+	return i
+}
+
+func (s *Scanner) skipSpace(i int) int {
+	for i < len(s.src) && isSpace(s.src[i]) {
+		i++
+	}
+	return i
+}
+
+func (s *Scanner) isLineEnd(i int) bool {
+	return i >= len(s.src) || isLineEnd(s.src[i])
+}
+
+func (s *Scanner) isListPrefix(i int) bool {
+	return s.src[i] == '-' && i+1 < len(s.src) && isSpace(s.src[i+1])
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t'
+}
+
+func isLineEnd(c byte) bool {
+	return c == '\n' || c == '\r' || c == '\f'
+}
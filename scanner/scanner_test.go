@@ -0,0 +1,153 @@
+package scanner_test
+
+import (
+	"strings"
+	"testing"
+	"unicode"
+
+	"github.com/fipress/fml"
+	. "github.com/fipress/fml/scanner"
+)
+
+//tokenString formats tokens as kind:text, separated by spaces
+func tokenString(src string, tokens []Token) string {
+	var parts []string
+	for _, t := range tokens {
+		switch t.Kind {
+		case Newline, EOF:
+			parts = append(parts, t.Kind.String())
+		default:
+			parts = append(parts, t.Kind.String()+":"+src[t.Start:t.End])
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestScan(t *testing.T) {
+	src := "title: Scala Basic # the title\n" +
+		"tags: [scala, \"basic\", 'a b']\n" +
+		"lit: `raw`\n\n" +
+		"[prod : base]\r\n" +
+		"sql: |-\n  SELECT *\n    FROM t\n\n" +
+		"port=1433\n"
+	tokens, err := Scan([]byte(src))
+	if err != nil {
+		t.Fatal("Should scan, err:", err)
+	}
+	expected := "Key:title Delimiter:: Scalar:Scala Basic Comment:# the title Newline " +
+		"Key:tags Delimiter:: ArrayStart:[ Scalar:scala Comma:, String:\"basic\" Comma:, String:'a b' ArrayEnd:] Newline " +
+		"Key:lit Delimiter:: Literal:`raw` Newline Newline " +
+		"NodeHeader:[prod : base] Newline " +
+		"Key:sql Delimiter:: Literal:|-\n  SELECT *\n    FROM t Newline Newline " +
+		"Key:port Delimiter:= Scalar:1433 Newline EOF"
+	if got := tokenString(src, tokens); got != expected {
+		t.Error("Should get tokens,\n got:", got, "\nwant:", expected)
+	}
+}
+
+func TestScanListMarker(t *testing.T) {
+	src := "[staff]\n- name: Abby\n  age: 12\n\n- name: Tony\n\ntop: 1\n- top: 2\n"
+	tokens, err := Scan([]byte(src))
+	if err != nil {
+		t.Fatal("Should scan, err:", err)
+	}
+	expected := "NodeHeader:[staff] Newline " +
+		"ListMarker:- Key:name Delimiter:: Scalar:Abby Newline Key:age Delimiter:: Scalar:12 Newline Newline " +
+		"ListMarker:- Key:name Delimiter:: Scalar:Tony Newline Newline " +
+		"Key:top Delimiter:: Scalar:1 Newline Key:- top Delimiter:: Scalar:2 Newline EOF"
+	if got := tokenString(src, tokens); got != expected {
+		t.Error("Should get tokens,\n got:", got, "\nwant:", expected)
+	}
+}
+
+func TestScanError(t *testing.T) {
+	src := "a: 1\nb: \"open\nc: 3\n"
+	tokens, err := Scan([]byte(src))
+	scanErr, ok := err.(*Error)
+	if !ok || scanErr.Line != 2 || scanErr.Col != 4 || scanErr.Msg != "quoted string is not closed" {
+		t.Error("Should get error at 2:4, err:", err)
+	}
+	expected := "Key:a Delimiter:: Scalar:1 Newline Key:b Delimiter:: Illegal:\"open EOF"
+	if got := tokenString(src, tokens); got != expected {
+		t.Error("Should stop at the error,\n got:", got, "\nwant:", expected)
+	}
+}
+
+func TestScanFaultTolerant(t *testing.T) {
+	src := "a: 1\nnot a key\n[]\nb: [1,,2]\nc: 3 x\"\nd: 4"
+	s := New([]byte(src), WithFaultTolerance())
+	var tokens []Token
+	for t := s.Next(); t.Kind != EOF; t = s.Next() {
+		tokens = append(tokens, t)
+	}
+	expected := "Key:a Delimiter:: Scalar:1 Newline " +
+		"Illegal:not a key Newline " +
+		"Illegal:[] Newline " +
+		"Key:b Delimiter:: Illegal:[1,,2] Newline " +
+		"Key:c Delimiter:: Scalar:3 x\" Newline " +
+		"Key:d Delimiter:: Scalar:4"
+	if got := tokenString(src, tokens); got != expected {
+		t.Error("Should keep scanning after errors,\n got:", got, "\nwant:", expected)
+	}
+	if len(s.Errors()) != 3 {
+		t.Error("Should get 3 errors, errors:", s.Errors())
+	}
+}
+
+func FuzzScan(f *testing.F) {
+	seeds := []string{
+		"title: Scala Basic\ntoclevel: 2\n",
+		"[staff]\n- name: Abby\n  age: 12\n- name: Tony\n",
+		"[n] # c\n# d\n\n- a: 1\n",
+		"list: [1.5, \"a\" x, 'b']\n",
+		"sql: |\n  SELECT *\n    FROM t\nnext: >-\n  a\n",
+		"lit: ```a\nb```\none: `x`\n",
+		"[prod : base]\nhost: p\n",
+		"a: [1,\n2\n",
+		"sql: | # c\n  a\n",
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, src string) {
+		tokens, err := Scan([]byte(src))
+		if _, parseErr := fml.ParseString(src); parseErr == nil && err != nil {
+			t.Fatalf("Should scan what parses, err: %v\nsrc: %q", err, src)
+		}
+		checkTokens(t, src, tokens)
+
+		s := New([]byte(src), WithFaultTolerance())
+		tokens = tokens[:0]
+		for i := 0; i <= len(src)+1; i++ {
+			tok := s.Next()
+			tokens = append(tokens, tok)
+			if tok.Kind == EOF {
+				break
+			}
+		}
+		checkTokens(t, src, tokens)
+	})
+}
+
+//checkTokens checks the tokens end with EOF, and are in order without overlapping,
+//anything between them is space, unless scanning stopped at an error
+func checkTokens(t *testing.T, src string, tokens []Token) {
+	if len(tokens) == 0 || tokens[len(tokens)-1].Kind != EOF {
+		t.Fatalf("Should end with EOF, tokens: %v\nsrc: %q", tokens, src)
+	}
+	last := 0
+	for i, tok := range tokens {
+		if tok.Start < last || tok.End < tok.Start || tok.End > len(src) {
+			t.Fatalf("Should be in order, token: %v, last end: %d\nsrc: %q", tok, last, src)
+		}
+		if tok.Kind == EOF && i > 0 && tokens[i-1].Kind == Illegal {
+			break
+		}
+		for _, c := range []byte(src[last:tok.Start]) {
+			if c < 0x80 && !unicode.IsSpace(rune(c)) {
+				t.Fatalf("Should only skip spaces, skipped: %q\nsrc: %q", src[last:tok.Start], src)
+			}
+		}
+		last = tok.End
+	}
+}
@@ -0,0 +1,82 @@
+package scanner
+
+import "fmt"
+
+// A Kind is the kind of a token.
+type Kind int
+
+const (
+	// Illegal is the part of a line that failed to scan, up to the line end.
+	Illegal Kind = iota
+	// EOF ends the token stream.
+	EOF
+	// Newline is a line end, "\r\n" is a single one.
+	// Line ends inside arrays and multiple line literals are part of them.
+	Newline
+	// Comment runs from a comment character to the line end.
+	Comment
+	// NodeHeader is a node name in brackets, like [a.b] or [prod : base].
+	NodeHeader
+	// ListMarker is the '-' starting an item of a node list.
+	ListMarker
+	// Key is a key without surrounding spaces.
+	Key
+	// Delimiter is the character between a key and its value.
+	Delimiter
+	// Scalar is a raw value, like 123, true, 2014-07-06 or some text.
+	Scalar
+	// String is a quoted value.
+	String
+	// Literal is a backtick literal, or a block literal starting with '|' or '>',
+	// the comment on the line of a block literal header is part of it.
+	Literal
+	// ArrayStart is the '[' starting an array value.
+	ArrayStart
+	// ArrayEnd is the ']' ending an array value.
+	ArrayEnd
+	// Comma separates the items of an array.
+	Comma
+)
+
+var kindNames = [...]string{
+	Illegal:    "Illegal",
+	EOF:        "EOF",
+	Newline:    "Newline",
+	Comment:    "Comment",
+	NodeHeader: "NodeHeader",
+	ListMarker: "ListMarker",
+	Key:        "Key",
+	Delimiter:  "Delimiter",
+	Scalar:     "Scalar",
+	String:     "String",
+	Literal:    "Literal",
+	ArrayStart: "ArrayStart",
+	ArrayEnd:   "ArrayEnd",
+	Comma:      "Comma",
+}
+
+func (k Kind) String() string {
+	if k >= 0 && int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// A Token is a kind with where it is in the source, src[Start:End].
+type Token struct {
+	Kind       Kind
+	Start, End int
+}
+
+// An Error is where and why the source failed to scan.
+type Error struct {
+	// Offset is the byte offset in the source.
+	Offset int
+	// Line and Col start from 1, Col counts bytes.
+	Line, Col int
+	Msg       string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Col, e.Msg)
+}
@@ -0,0 +1,285 @@
+package fml
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const secretPrefix = "enc:"
+
+var (
+	errInvalidSecret = errors.New("invalid secret")
+	errInvalidKey    = errors.New("invalid AES key, it should be 16, 24 or 32 bytes")
+
+	providersMu sync.RWMutex
+	providers   = make(map[string]SecretProvider)
+)
+
+// A SecretProvider encrypts and decrypts secret values.
+type SecretProvider interface {
+	Encrypt(plaintext string) (ciphertext string, err error)
+	Decrypt(ciphertext string) (plaintext string, err error)
+}
+
+// RegisterSecretProvider makes a secret provider available by the name.
+// A secret value is written as enc:<name>:<ciphertext>, for example
+//
+//	password: enc:aes:bXkgc2VjcmV0...
+func RegisterSecretProvider(name string, provider SecretProvider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	if provider == nil {
+		delete(providers, name)
+	} else {
+		providers[name] = provider
+	}
+}
+
+func getSecretProvider(name string) (SecretProvider, error) {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	provider, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("secret provider not found: %s", name)
+	}
+	return provider, nil
+}
+
+// A Secret is an encrypted value. Its plaintext is a fml value,
+// it is decrypted and evaluated when the value is got from the node.
+type Secret struct {
+	Provider   string
+	Ciphertext string
+}
+
+// EncryptValue encrypts a value with the provider registered by the name.
+func EncryptValue(provider string, val interface{}) (secret Secret, err error) {
+	p, err := getSecretProvider(provider)
+	if err != nil {
+		return
+	}
+
+	ciphertext, err := p.Encrypt(wrapInline(val))
+	if err != nil {
+		return
+	}
+	return Secret{Provider: provider, Ciphertext: ciphertext}, nil
+}
+
+// Decrypt decrypts the secret and reads the plaintext as a fml value.
+func (s Secret) Decrypt() (val interface{}, err error) {
+	plaintext, err := s.decrypt()
+	if err != nil {
+		return
+	}
+	return evalPlaintext(plaintext)
+}
+
+//evalPlaintext reads a plaintext the way the parser reads a value,
+//a plaintext which is not a single value fails instead of panicking.
+func evalPlaintext(plaintext string) (val interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			val, err = nil, errors.New("invalid secret value: "+fmt.Sprint(r))
+		}
+	}()
+	input := []byte(plaintext)
+	val, _, idx := newParser(nil).scanValue(input)
+	if idx < len(input) {
+		panic(invalidValueEnd)
+	}
+	return
+}
+
+func (s Secret) decrypt() (string, error) {
+	p, err := getSecretProvider(s.Provider)
+	if err != nil {
+		return "", err
+	}
+	return p.Decrypt(s.Ciphertext)
+}
+
+// String returns the secret as it is written in a fml file, so it never shows the plaintext.
+func (s Secret) String() string {
+	return secretPrefix + s.Provider + ":" + s.Ciphertext
+}
+
+func evalSecret(raw string) (secret Secret, ok bool) {
+	if !strings.HasPrefix(raw, secretPrefix) {
+		return
+	}
+	parts := strings.SplitN(raw[len(secretPrefix):], ":", 2)
+	if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+		return
+	}
+	return Secret{Provider: parts[0], Ciphertext: parts[1]}, true
+}
+
+//reveal decrypts a secret value, other values are returned as they are
+func reveal(rawVal interface{}) (interface{}, error) {
+	if s, ok := rawVal.(Secret); ok {
+		return s.Decrypt()
+	}
+	return rawVal, nil
+}
+
+// AESProvider is a SecretProvider using AES-GCM,
+// the ciphertext is the base64 encoding of the nonce followed by the sealed data.
+type AESProvider struct {
+	aead cipher.AEAD
+}
+
+// NewAESProvider creates an AES-GCM provider, the key should be 16, 24 or 32 bytes.
+func NewAESProvider(key []byte) (*AESProvider, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errInvalidKey
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &AESProvider{aead: aead}, nil
+}
+
+// LoadAESKeyFile creates an AES-GCM provider with the key in a local file,
+// the key is written in hex or base64.
+func LoadAESKeyFile(path string) (*AESProvider, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	text := strings.TrimSpace(string(content))
+	key, err := hex.DecodeString(text)
+	if err != nil {
+		key, err = base64.StdEncoding.DecodeString(text)
+	}
+	if err != nil {
+		return nil, errInvalidKey
+	}
+	return NewAESProvider(key)
+}
+
+// GenerateAESKey generates a random 32 bytes key in hex, which can be saved as a key file.
+func GenerateAESKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(key), nil
+}
+
+// Encrypt implements SecretProvider.
+func (p *AESProvider) Encrypt(plaintext string) (string, error) {
+	nonce := make([]byte, p.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := p.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt implements SecretProvider.
+func (p *AESProvider) Decrypt(ciphertext string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil || len(sealed) < p.aead.NonceSize() {
+		return "", errInvalidSecret
+	}
+	size := p.aead.NonceSize()
+	plaintext, err := p.aead.Open(nil, sealed[:size], sealed[size:], nil)
+	if err != nil {
+		return "", errInvalidSecret
+	}
+	return string(plaintext), nil
+}
+
+// SealValues encrypts the values of the keys in the source with the provider registered by the name.
+// Only the values are rewritten, the rest of the source stays as it is.
+// Keys are paths like "database.password", or "servers[0].password" for items of node lists.
+func SealValues(src []byte, provider string, keys ...string) ([]byte, error) {
+	p, err := getSecretProvider(provider)
+	if err != nil {
+		return nil, err
+	}
+
+	return replaceValues(src, keys, func(key string, val interface{}, text string) (string, error) {
+		switch val.(type) {
+		case *FML, []*FML:
+			return "", fmt.Errorf("not a value: %s", key)
+		case Secret:
+			return "", fmt.Errorf("already sealed: %s", key)
+		}
+		if strings.ContainsAny(text, "\r\n") {
+			return "", fmt.Errorf("multiple line value can not be sealed: %s", key)
+		}
+		ciphertext, err := p.Encrypt(text)
+		if err != nil {
+			return "", err
+		}
+		return Secret{Provider: provider, Ciphertext: ciphertext}.String(), nil
+	})
+}
+
+// OpenValues decrypts the sealed values of the keys in the source,
+// the values are written back as they were before being sealed.
+func OpenValues(src []byte, keys ...string) ([]byte, error) {
+	return replaceValues(src, keys, func(key string, val interface{}, text string) (string, error) {
+		s, ok := val.(Secret)
+		if !ok {
+			return "", fmt.Errorf("not sealed: %s", key)
+		}
+		return s.decrypt()
+	})
+}
+
+//replaceValues replaces the value text of the keys in the source
+func replaceValues(src []byte, keys []string,
+	replace func(key string, val interface{}, text string) (string, error)) ([]byte, error) {
+	_, spans, err := parseWithSpans(src)
+	if err != nil {
+		return nil, err
+	}
+	p := newParser(nil)
+	done := make(map[string]bool)
+
+	type edit struct {
+		span
+		text string
+	}
+	edits := make([]edit, 0, len(keys))
+	for _, key := range keys {
+		sp, ok := spans[key]
+		if !ok {
+			return nil, fmt.Errorf("key not found: %s", key)
+		} else if done[key] {
+			continue
+		}
+		done[key] = true
+		val, _, _ := p.scanValue(src[sp.start:])
+		text, err := replace(key, val, string(src[sp.start:sp.end]))
+		if err != nil {
+			return nil, err
+		}
+		edits = append(edits, edit{sp, text})
+	}
+
+	//replace from the end, so the spans before stay valid
+	sort.Slice(edits, func(i, j int) bool {
+		return edits[i].start > edits[j].start
+	})
+	out := append([]byte(nil), src...)
+	for _, e := range edits {
+		out = append(out[:e.start], append([]byte(e.text), out[e.end:]...)...)
+	}
+	return out, nil
+}
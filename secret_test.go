@@ -0,0 +1,138 @@
+package fml
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSecretValue(t *testing.T) {
+	provider, err := NewAESProvider([]byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatal("Should create provider, err:", err)
+	}
+	RegisterSecretProvider("test", provider)
+	defer RegisterSecretProvider("test", nil)
+
+	secret, err := EncryptValue("test", "s3cret")
+	if err != nil {
+		t.Fatal("Should encrypt, err:", err)
+	}
+	port, _ := EncryptValue("test", 5432)
+
+	input := "[database]\npassword: " + secret.String() + "\nport: " + port.String() + "\n"
+	doc, err := ParseString(input)
+	if err != nil {
+		t.Fatal("Should parse, err:", err)
+	}
+	if doc.GetString("database.password") != "s3cret" || doc.GetInt("database.port") != 5432 {
+		t.Error("Should decrypt transparently")
+	}
+
+	type DB struct {
+		Password string
+		Port     int
+	}
+	db := new(DB)
+	doc.GetStruct("database", db)
+	if db.Password != "s3cret" || db.Port != 5432 {
+		t.Error("Should decrypt in struct, db:", db)
+	}
+
+	if strings.Contains(wrapVal(secret), "s3cret") {
+		t.Error("Should never write the plaintext")
+	}
+}
+
+func TestSecretErrors(t *testing.T) {
+	doc, err := ParseString("password: enc:missing:abc")
+	if err != nil {
+		t.Fatal("Should parse, err:", err)
+	}
+	if _, err = doc.GetStringOrError("password"); err == nil {
+		t.Error("Should fail without provider")
+	}
+
+	provider, _ := NewAESProvider([]byte("0123456789abcdef"))
+	RegisterSecretProvider("test", provider)
+	defer RegisterSecretProvider("test", nil)
+	doc, _ = ParseString("password: enc:test:bm90IHNlYWxlZA==")
+	if _, err = doc.GetStringOrError("password"); err == nil {
+		t.Error("Should fail on invalid ciphertext")
+	}
+}
+
+func TestSealValues(t *testing.T) {
+	provider, _ := NewAESProvider([]byte("0123456789abcdef"))
+	RegisterSecretProvider("test", provider)
+	defer RegisterSecretProvider("test", nil)
+
+	input := `token: abc # comment
+
+[servers]
+- name: a
+  password: 123
+- name: b
+  password: 'x y'
+`
+	sealed, err := SealValues([]byte(input), "test", "token", "servers[1].password")
+	if err != nil {
+		t.Fatal("Should seal, err:", err)
+	}
+	if strings.Contains(string(sealed), "abc") || strings.Contains(string(sealed), "x y") ||
+		!strings.Contains(string(sealed), "password: 123\n") || !strings.Contains(string(sealed), " # comment\n") {
+		t.Error("Should seal the values only, got:", string(sealed))
+	}
+
+	doc, _ := Parse(sealed)
+	servers, _ := doc.GetNodeList("servers")
+	if doc.GetString("token") != "abc" || servers[1].GetString("password") != "x y" {
+		t.Error("Should read sealed values")
+	}
+
+	if _, err = SealValues(sealed, "test", "token"); err == nil {
+		t.Error("Should NOT seal twice")
+	}
+
+	opened, err := OpenValues(sealed, "token", "servers[1].password")
+	if err != nil || string(opened) != input {
+		t.Error("Should open the values, err:", err, "got:", string(opened))
+	}
+}
+
+func TestSecretRoundTrip(t *testing.T) {
+	provider, _ := NewAESProvider([]byte("0123456789abcdef"))
+	RegisterSecretProvider("test", provider)
+	defer RegisterSecretProvider("test", nil)
+
+	values := []interface{}{"line1\nline2", []string{"a", "b, c"}, []int{1, 2}, "[a, b]", " padded ", "# not a comment", "", 1.5, true}
+	for _, v := range values {
+		secret, err := EncryptValue("test", v)
+		if err != nil {
+			t.Fatal("Should encrypt, err:", err)
+		}
+		if got, err := secret.Decrypt(); err != nil || !reflect.DeepEqual(got, v) {
+			t.Errorf("Should decrypt %#v, got: %#v %v", v, got, err)
+		}
+	}
+
+	sealed, err := SealValues([]byte("a: `x \\q`\nb: [1, 2]\n"), "test", "a", "b")
+	if err != nil {
+		t.Fatal("Should seal, err:", err)
+	}
+	doc, err := Parse(sealed)
+	if err != nil {
+		t.Fatal("Should parse, err:", err)
+	}
+	if doc.GetString("a") != `x \q` || len(doc.GetIntArray("b")) != 2 {
+		t.Error("Should read sealed literals and arrays, got:", doc.GetString("a"), doc.GetIntArray("b"))
+	}
+
+	for _, plaintext := range []string{`"\q"`, "[a", "a\nb: 1", `"a" b`} {
+		ciphertext, _ := provider.Encrypt(plaintext)
+		doc, _ = ParseString("v: " + Secret{Provider: "test", Ciphertext: ciphertext}.String())
+		if _, err = doc.GetStringOrError("v"); err == nil {
+			t.Errorf("Should fail to decrypt %q", plaintext)
+		}
+	}
+}
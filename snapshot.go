@@ -0,0 +1,236 @@
+package fml
+
+import (
+	"bufio"
+	"time"
+)
+
+// A Snapshot is an immutable copy of a document, made by Freeze.
+// It has the getters of FML but no way to change it, so it is safe for concurrent use without any lock.
+// Arrays are copied when they are got, and nodes are got as snapshots too.
+type Snapshot struct {
+	doc *FML
+}
+
+// Freeze makes an immutable snapshot of the node, later changes to the node don't affect it.
+func (f *FML) Freeze() *Snapshot {
+	return &Snapshot{doc: f.Clone()}
+}
+
+// Thaw makes a mutable copy of the snapshot.
+func (s *Snapshot) Thaw() *FML {
+	return s.doc.Clone()
+}
+
+// GetStringOrError gets a string value from the snapshot.
+func (s *Snapshot) GetStringOrError(key string) (string, error) {
+	return s.doc.GetStringOrError(key)
+}
+
+// GetString gets a string value from the snapshot, or "" if the key does not exist or other error happens.
+func (s *Snapshot) GetString(key string) string {
+	return s.doc.GetString(key)
+}
+
+// GetStringOrDefault gets a string value from the snapshot,
+// or return defaultVal if the key does not exist or other error happens.
+func (s *Snapshot) GetStringOrDefault(key string, defaultVal string) string {
+	return s.doc.GetStringOrDefault(key, defaultVal)
+}
+
+// GetBoolOrError gets a bool value from the snapshot.
+func (s *Snapshot) GetBoolOrError(key string) (bool, error) {
+	return s.doc.GetBoolOrError(key)
+}
+
+// GetBool gets a bool value from the snapshot, or false if the key does not exist or other error happens.
+func (s *Snapshot) GetBool(key string) bool {
+	return s.doc.GetBool(key)
+}
+
+// GetBoolOrDefault gets a bool value from the snapshot,
+// or return defaultVal if the key does not exist or other error happens.
+func (s *Snapshot) GetBoolOrDefault(key string, defaultVal bool) bool {
+	return s.doc.GetBoolOrDefault(key, defaultVal)
+}
+
+// GetIntOrError gets a int value from the snapshot.
+func (s *Snapshot) GetIntOrError(key string) (int, error) {
+	return s.doc.GetIntOrError(key)
+}
+
+// GetInt gets a int value from the snapshot, or 0 if the key does not exist or other error happens.
+func (s *Snapshot) GetInt(key string) int {
+	return s.doc.GetInt(key)
+}
+
+// GetIntOrDefault gets a int value from the snapshot,
+// or return defaultVal if the key does not exist or other error happens.
+func (s *Snapshot) GetIntOrDefault(key string, defaultVal int) int {
+	return s.doc.GetIntOrDefault(key, defaultVal)
+}
+
+// GetFloatOrError gets a float value from the snapshot.
+func (s *Snapshot) GetFloatOrError(key string) (float64, error) {
+	return s.doc.GetFloatOrError(key)
+}
+
+// GetFloat gets a float value from the snapshot, or 0 if the key does not exist or other error happens.
+func (s *Snapshot) GetFloat(key string) float64 {
+	return s.doc.GetFloat(key)
+}
+
+// GetFloatOrDefault gets a float value from the snapshot,
+// or return defaultVal if the key does not exist or other error happens.
+func (s *Snapshot) GetFloatOrDefault(key string, defaultVal float64) float64 {
+	return s.doc.GetFloatOrDefault(key, defaultVal)
+}
+
+// GetTimeOrError gets a time.Time value from the snapshot.
+func (s *Snapshot) GetTimeOrError(key string) (time.Time, error) {
+	return s.doc.GetTimeOrError(key)
+}
+
+// GetDatetime gets a time.Time value from the snapshot,
+// or the zero time if the key does not exist or other error happens.
+func (s *Snapshot) GetDatetime(key string) time.Time {
+	return s.doc.GetDatetime(key)
+}
+
+// GetDatetimeOrDefault gets a time.Time value from the snapshot,
+// or return defaultVal if the key does not exist or other error happens.
+func (s *Snapshot) GetDatetimeOrDefault(key string, defaultVal time.Time) time.Time {
+	return s.doc.GetDatetimeOrDefault(key, defaultVal)
+}
+
+// Has reports whether the key exists in the snapshot, even if its value is null.
+func (s *Snapshot) Has(key string) bool {
+	return s.doc.Has(key)
+}
+
+// IsNull reports whether the key exists in the snapshot and its value is null.
+func (s *Snapshot) IsNull(key string) bool {
+	return s.doc.IsNull(key)
+}
+
+// Lookup gets a value from the snapshot like FML.Lookup, but a node is a *Snapshot,
+// a node list is a []*Snapshot, and an array is a copy.
+func (s *Snapshot) Lookup(key string) (val interface{}, found bool) {
+	val, found = s.doc.Lookup(key)
+	return freezeValue(val), found
+}
+
+// GetStringArrayOrError gets a copy of an array of string from the snapshot.
+func (s *Snapshot) GetStringArrayOrError(key string) ([]string, error) {
+	arr, err := s.doc.GetStringArrayOrError(key)
+	return append([]string(nil), arr...), err
+}
+
+// GetStringArray gets a copy of an array of string from the snapshot, nil if the key does not exist or other error happens.
+func (s *Snapshot) GetStringArray(key string) []string {
+	return append([]string(nil), s.doc.GetStringArray(key)...)
+}
+
+// GetBoolArrayOrError gets a copy of an array of bool from the snapshot.
+func (s *Snapshot) GetBoolArrayOrError(key string) ([]bool, error) {
+	arr, err := s.doc.GetBoolArrayOrError(key)
+	return append([]bool(nil), arr...), err
+}
+
+// GetBoolArray gets a copy of an array of bool from the snapshot, nil if the key does not exist or other error happens.
+func (s *Snapshot) GetBoolArray(key string) []bool {
+	return append([]bool(nil), s.doc.GetBoolArray(key)...)
+}
+
+// GetIntArrayOrError gets a copy of an array of int from the snapshot.
+func (s *Snapshot) GetIntArrayOrError(key string) ([]int, error) {
+	arr, err := s.doc.GetIntArrayOrError(key)
+	return append([]int(nil), arr...), err
+}
+
+// GetIntArray gets a copy of an array of int from the snapshot, nil if the key does not exist or other error happens.
+func (s *Snapshot) GetIntArray(key string) []int {
+	return append([]int(nil), s.doc.GetIntArray(key)...)
+}
+
+// GetFloatArrayOrError gets a copy of an array of float from the snapshot.
+func (s *Snapshot) GetFloatArrayOrError(key string) ([]float64, error) {
+	arr, err := s.doc.GetFloatArrayOrError(key)
+	return append([]float64(nil), arr...), err
+}
+
+// GetFloatArray gets a copy of an array of float from the snapshot, nil if the key does not exist or other error happens.
+func (s *Snapshot) GetFloatArray(key string) []float64 {
+	return append([]float64(nil), s.doc.GetFloatArray(key)...)
+}
+
+// GetTimeArrayOrError gets a copy of an array of time.Time from the snapshot.
+func (s *Snapshot) GetTimeArrayOrError(key string) ([]time.Time, error) {
+	arr, err := s.doc.GetTimeArrayOrError(key)
+	return append([]time.Time(nil), arr...), err
+}
+
+// GetTimeArray gets a copy of an array of time.Time from the snapshot, nil if the key does not exist or other error happens.
+func (s *Snapshot) GetTimeArray(key string) []time.Time {
+	return append([]time.Time(nil), s.doc.GetTimeArray(key)...)
+}
+
+// GetStruct gets a struct from the snapshot, see FML.GetStruct.
+// Fields of *FML, arrays and the like get copies, which can't change the snapshot.
+func (s *Snapshot) GetStruct(key string, v interface{}) error {
+	node, err := s.doc.GetNode(key)
+	if err != nil || node == nil {
+		return err
+	}
+	return new(decoder).decodeStruct(node.Clone(), v, key)
+}
+
+// GetNode gets a sub-node from the snapshot.
+// It returns a nil snapshot without error if the value is null.
+func (s *Snapshot) GetNode(key string) (*Snapshot, error) {
+	node, err := s.doc.GetNode(key)
+	if err != nil || node == nil {
+		return nil, err
+	}
+	return &Snapshot{doc: node}, nil
+}
+
+// GetNodeList gets a node list from the snapshot.
+// It returns a nil list without error if the value is null.
+func (s *Snapshot) GetNodeList(key string) ([]*Snapshot, error) {
+	list, err := s.doc.GetNodeList(key)
+	if err != nil || list == nil {
+		return nil, err
+	}
+	return freezeValue(list).([]*Snapshot), nil
+}
+
+// KeySet gets the keys of the snapshot.
+func (s *Snapshot) KeySet() []string {
+	return s.doc.KeySet()
+}
+
+// Hash gets the content hash of the snapshot, the same as the one of the frozen node.
+func (s *Snapshot) Hash() string {
+	return s.doc.Hash()
+}
+
+// WriteTo writes the snapshot.
+func (s *Snapshot) WriteTo(writer *bufio.Writer) {
+	s.doc.WriteTo(writer)
+}
+
+//freezeValue wraps the nodes in a value into snapshots, and copies arrays
+func freezeValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case *FML:
+		return &Snapshot{doc: v}
+	case []*FML:
+		list := make([]*Snapshot, len(v))
+		for i, node := range v {
+			list[i] = &Snapshot{doc: node}
+		}
+		return list
+	}
+	return cloneValue(val)
+}
@@ -0,0 +1,80 @@
+package fml
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	doc, _ := ParseString("port: 80\ntags: [a, b]\n\n[db]\nhost: local\n\n[staff]\n- name: Abby\n")
+	snap := doc.Freeze()
+	doc.SetValue("port", 8080)
+	db, _ := doc.GetNode("db")
+	db.SetValue("host", "remote")
+	doc.GetStringArray("tags")[0] = "x"
+
+	if snap.GetInt("port") != 80 || snap.GetString("db.host") != "local" || snap.GetStringArray("tags")[0] != "a" {
+		t.Error("Should not change with the node, got:", snap.doc)
+	}
+	snap.GetStringArray("tags")[0] = "x"
+	if snap.GetStringArray("tags")[0] != "a" {
+		t.Error("Should get a copy of arrays")
+	}
+
+	node, err := snap.GetNode("db")
+	if err != nil || node.GetString("host") != "local" {
+		t.Error("Should get a node as a snapshot, got:", node, err)
+	}
+	staff, err := snap.GetNodeList("staff")
+	if err != nil || len(staff) != 1 || staff[0].GetString("name") != "Abby" {
+		t.Error("Should get a node list as snapshots, got:", staff, err)
+	}
+	if v, ok := snap.Lookup("staff"); !ok {
+		t.Error("Should look up a node list")
+	} else if _, ok = v.([]*Snapshot); !ok {
+		t.Error("Should look up a node list as snapshots, got:", v)
+	}
+
+	thawed := snap.Thaw()
+	thawed.SetValue("port", 1)
+	if snap.GetInt("port") != 80 || snap.Hash() == thawed.Hash() {
+		t.Error("Should thaw to a copy")
+	}
+
+	//run with -race, the getters take no lock
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				snap.GetString("db.host")
+				snap.GetStringArray("tags")
+				snap.Hash()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestSnapshotGetStruct(t *testing.T) {
+	doc, _ := ParseString("[app]\ntags: [a, b]\n\n[app.db]\nhost: local\n\n[app.staff]\n- name: Abby\n")
+	snap := doc.Freeze()
+	var app struct {
+		Tags  []string        `fml:"tags"`
+		DB    *FML            `fml:"db"`
+		Staff map[string]*FML `fml:"staff,key=name"`
+	}
+	if err := snap.GetStruct("app", &app); err != nil || app.DB == nil || app.Staff["Abby"] == nil {
+		t.Fatal("Should get a struct, got:", app, err)
+	}
+	app.Tags[0] = "x"
+	app.DB.SetValue("host", "remote")
+	app.Staff["Abby"].SetValue("name", "Tony")
+	if snap.GetStringArray("app.tags")[0] != "a" || snap.GetString("app.db.host") != "local" {
+		t.Error("Should not change with the fields, got:", snap.doc)
+	}
+	if staff, _ := snap.GetNodeList("app.staff"); staff[0].GetString("name") != "Abby" {
+		t.Error("Should not change with the index, got:", snap.doc)
+	}
+}
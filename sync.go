@@ -0,0 +1,95 @@
+package fml
+
+import "sync"
+
+// EnableSync makes the document safe for concurrent use, like a goroutine reloading it with SetValue
+// while others get values from it. All the nodes of the document share a read-write lock,
+// which guards the getters, SetValue, RemoveItem, ApplyPatch, KeySet, ValueSet, WriteTo, WriteRedactedTo,
+// Dump, String, Clone, Hash and Freeze.
+// Nodes set into the document are copied, and the copies share it too, later changes to the nodes set don't
+// affect the document. It must be called before the document is shared.
+//
+// Functions taking documents as arguments, like Diff, Equal or Redact, are not guarded,
+// pass them a Clone, or use a Snapshot instead, whose getters take no lock at all.
+// A Clone of a synchronized document is not synchronized. Get and GetStruct decode such a clone,
+// so decode hooks and UnmarshalFML get a node which is not synchronized either.
+func (f *FML) EnableSync() {
+	if f.mu == nil {
+		shareMutex(f, &sync.RWMutex{})
+	}
+}
+
+//shareMutex makes the nodes in the value share the lock, nothing to do if it is nil
+func shareMutex(val interface{}, mu *sync.RWMutex) {
+	if mu == nil {
+		return
+	}
+	switch v := val.(type) {
+	case *FML:
+		if v == nil {
+			return
+		}
+		v.mu = mu
+		for _, sub := range v.dict {
+			shareMutex(sub, mu)
+		}
+	case []*FML:
+		for _, item := range v {
+			shareMutex(item, mu)
+		}
+	}
+}
+
+//ownValue copies the nodes of a value set into a synchronized document. They may be of another synchronized document,
+//whose readers would take another lock than its writers if they shared the lock of this one.
+//It is called before the lock is held, the nodes may be of this document.
+func ownValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case *FML:
+		return v.Clone()
+	case []*FML:
+		list := make([]*FML, len(v))
+		for i, item := range v {
+			list[i] = item.Clone()
+		}
+		return list
+	}
+	return val
+}
+
+//decodedVal gets the value of the path to decode. Decoding may call back into the document,
+//like hooks or UnmarshalFML getting values, which must not wait for a writer waiting for the lock held,
+//so the value of a synchronized document is copied under the lock, and decoded after it is released.
+func (f *FML) decodedVal(path string) (interface{}, error) {
+	f.rlock()
+	defer f.runlock()
+	raw, err := f.rawVal(path)
+	if err != nil || f.mu == nil {
+		return raw, err
+	}
+	return cloneValue(raw), nil
+}
+
+func (f *FML) rlock() {
+	if f != nil && f.mu != nil {
+		f.mu.RLock()
+	}
+}
+
+func (f *FML) runlock() {
+	if f != nil && f.mu != nil {
+		f.mu.RUnlock()
+	}
+}
+
+func (f *FML) lock() {
+	if f.mu != nil {
+		f.mu.Lock()
+	}
+}
+
+func (f *FML) unlock() {
+	if f.mu != nil {
+		f.mu.Unlock()
+	}
+}
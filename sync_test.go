@@ -0,0 +1,140 @@
+package fml
+
+import (
+	"bufio"
+	"io/ioutil"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+//run with -race to find data races
+func TestEnableSync(t *testing.T) {
+	doc, _ := ParseString("port: 80\ntags: [a, b]\n\n[db]\nhost: local\n\n[staff]\n- name: Abby\n")
+	doc.EnableSync()
+	db, _ := doc.GetNode("db")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				doc.SetValue("port", j)
+				db.SetValue("host", "host"+strconv.Itoa(i))
+				node := NewFml()
+				node.SetValue("name", "Tony")
+				doc.SetValue("staff", []*FML{node})
+				doc.RemoveItem("tags")
+				doc.SetValue("tags", []string{"c"})
+				if err := doc.ApplyPatch(Patch{{Op: PatchReplace, Path: "db.user", Value: "sa"}}); err == nil {
+					t.Error("Should fail to replace a missing key")
+				}
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				doc.GetInt("port")
+				doc.GetString("db.host")
+				doc.GetStringArray("tags")
+				if staff, err := doc.GetNodeList("staff"); err == nil && len(staff) != 0 {
+					staff[0].GetString("name")
+				}
+				var v struct{ Host string }
+				doc.GetStruct("db", &v)
+				doc.KeySet()
+				doc.Hash()
+				doc.Freeze().GetString("db.host")
+				doc.WriteTo(bufio.NewWriter(ioutil.Discard))
+				_ = doc.String()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if doc.GetInt("port") != 99 || doc.GetStringArray("tags")[0] != "c" {
+		t.Error("Should keep the last values, got:", doc)
+	}
+	staff, _ := doc.GetNodeList("staff")
+	if staff[0].mu != doc.mu || db.mu != doc.mu {
+		t.Error("Should share the lock with the nodes")
+	}
+	if doc.Clone().mu != nil {
+		t.Error("Should not synchronize a clone")
+	}
+}
+
+func TestSyncSetNode(t *testing.T) {
+	a, _ := ParseString("[db]\nhost: a\n")
+	b, _ := ParseString("[db]\nhost: b\n")
+	a.EnableSync()
+	b.EnableSync()
+	db, _ := b.GetNode("db")
+	a.SetValue("db", db)
+	a.SetValue("list", []*FML{db})
+	db.SetValue("host", "c")
+
+	node, _ := a.GetNode("db")
+	list, _ := a.GetNodeList("list")
+	if node == db || node.mu != a.mu || list[0].mu != a.mu || db.mu != b.mu {
+		t.Error("Should link copies of the nodes of another document")
+	}
+	if a.GetString("db.host") != "b" || b.GetString("db.host") != "c" {
+		t.Error("Should not change with the nodes set, got:", a.GetString("db.host"))
+	}
+	a.SetValue("self", node)
+	if self, _ := a.GetNode("self"); self == node || self.mu != a.mu {
+		t.Error("Should link a copy of a node of the document itself")
+	}
+}
+
+type syncedHost struct {
+	host string
+}
+
+//UnmarshalFML gets the host from the node, which takes its lock if it is synchronized,
+//after a while to let a writer wait for the lock
+func (h *syncedHost) UnmarshalFML(val interface{}) error {
+	time.Sleep(time.Millisecond)
+	if node, ok := val.(*FML); ok {
+		h.host = node.GetString("host")
+	}
+	return nil
+}
+
+func TestSyncDecode(t *testing.T) {
+	doc, _ := ParseString("port: 80\n\n[db]\nhost: local\n")
+	doc.EnableSync()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			var h syncedHost
+			doc.GetStruct("db", &h)
+			if g, err := Get[syncedHost](doc, "db"); err != nil || g.host != "local" || h.host != "local" {
+				t.Error("Should decode by UnmarshalFML, got:", g.host, h.host, err)
+				return
+			}
+		}
+	}()
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+				doc.SetValue("port", i)
+				time.Sleep(100 * time.Microsecond)
+			}
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Should not deadlock when UnmarshalFML gets values while SetValue is waiting")
+	}
+}
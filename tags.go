@@ -0,0 +1,285 @@
+package fml
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// A FieldError is returned when a struct field fails its tags while decoding:
+//
+//	type Server struct {
+//		Host  string `fml:"host" required:"true"`
+//		Port  int    `fml:"port" default:"8080" min:"1" max:"65535"`
+//		Mode  string `fml:"mode" oneof:"debug release"`
+//		Name  string `fml:"name" regexp:"^[a-z]+$"`
+//		Peers []string `fml:"peers" len:"3"`
+//	}
+//
+// A default is a fml value like "8080", "[a, b]" or "\"a # b\"", set if the key is missing and the field is zero.
+// A required key must exist. min and max are bounds of numbers, or of the lengths of strings, arrays and maps,
+// and of durations like "1s". oneof is a list of values separated by spaces, regexp is matched against strings,
+// and len is the exact length of strings, arrays and maps. Constraints are checked if the key exists or the
+// default is set, and they are skipped for nil pointers.
+// The keys of a missing node are missing, so its required keys fail it, use a pointer for an optional node.
+type FieldError struct {
+	// Path is the key path of the field, like "server.port".
+	Path string
+	// Line is where the key is, or its node if the key is missing, 0 if unknown.
+	Line int
+	Msg  string
+}
+
+func (e *FieldError) Error() string {
+	msg := e.Msg
+	if len(e.Path) != 0 {
+		msg = e.Path + " " + msg
+	}
+	if e.Line == 0 {
+		return "decode fml failed: " + msg
+	}
+	return fmt.Sprintf("decode fml failed at line %d: %s", e.Line, msg)
+}
+
+// ApplyDefaults sets the zero fields of the struct v points to by their default tags, see FieldError.
+// Nested structs get their defaults too.
+func ApplyDefaults(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errTypeMismatch
+	}
+	return new(decoder).applyTags(rv.Elem(), "", nil)
+}
+
+//a fieldID identifies a field of a struct, a struct and its first field have the same address
+type fieldID struct {
+	addr uintptr
+	t    reflect.Type
+}
+
+func idOf(field reflect.Value) fieldID {
+	return fieldID{field.UnsafeAddr(), field.Type()}
+}
+
+//applyTags applies the tags of the fields of the struct of the node path,
+//found has the paths of the fields set from the node, nil to only set defaults
+func (d *decoder) applyTags(el reflect.Value, path string, found map[fieldID]string) error {
+	t := el.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _ := parseTag(f.Tag.Get("fml"))
+		field := el.Field(i)
+		if name == "-" {
+			continue
+		}
+		//exported fields of unexported embedded structs can be set
+		if f.Anonymous && len(name) == 0 && isPlainStruct(field) {
+			if err := d.applyTags(field, path, found); err != nil {
+				return err
+			}
+			continue
+		}
+		if !field.CanSet() {
+			continue
+		}
+		if len(name) == 0 {
+			name = f.Name
+		}
+
+		fieldPath, ok := found[idOf(field)]
+		if !ok {
+			fieldPath = joinPath(path, name)
+		}
+		def, hasDefault := f.Tag.Lookup("default")
+		switch {
+		case ok:
+		case hasDefault && field.IsZero():
+			raw, err := parseDefault(def)
+			if err == nil {
+				err = convertValue(field, raw)
+			}
+			if err != nil {
+				return &FieldError{Path: fieldPath, Line: d.line(path), Msg: fmt.Sprintf("has an invalid default %q: %v", def, err)}
+			}
+		case found != nil && f.Tag.Get("required") == "true":
+			return &FieldError{Path: fieldPath, Line: d.line(path), Msg: "is required"}
+		case isPlainStruct(field):
+			//the keys of a missing node are missing too, and checked like them if decoding
+			missing := found
+			if found != nil {
+				missing = map[fieldID]string{}
+			}
+			if err := d.applyTags(field, fieldPath, missing); err != nil {
+				return err
+			}
+			continue
+		default:
+			continue
+		}
+
+		if found == nil {
+			continue
+		}
+		if msg := checkField(field, f.Tag); len(msg) != 0 {
+			line := d.line(fieldPath)
+			if !ok {
+				line = d.line(path)
+			}
+			return &FieldError{Path: fieldPath, Line: line, Msg: msg}
+		}
+	}
+	return nil
+}
+
+//isPlainStruct reports whether the field is a struct decoded key by key
+func isPlainStruct(field reflect.Value) bool {
+	if field.Kind() != reflect.Struct || field.Type() == timeType || getDecodeHook(field.Type()) != nil {
+		return false
+	}
+	pt := reflect.PtrTo(field.Type())
+	return !pt.Implements(unmarshalerType) && !pt.Implements(textUnmarshalerType)
+}
+
+//parseDefault parses a default tag as a fml value
+func parseDefault(def string) (interface{}, error) {
+	doc, err := ParseString("v: " + def)
+	if err != nil {
+		return nil, err
+	}
+	return doc.dict["v"], nil
+}
+
+//checkField checks the value of the field by its constraint tags, it returns what is wrong if any
+func checkField(field reflect.Value, tag reflect.StructTag) string {
+	for field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			return ""
+		}
+		field = field.Elem()
+	}
+
+	if bound, ok := tag.Lookup("min"); ok {
+		if msg := checkBound(field, bound, "min", "at least", func(c int) bool { return c >= 0 }); len(msg) != 0 {
+			return msg
+		}
+	}
+	if bound, ok := tag.Lookup("max"); ok {
+		if msg := checkBound(field, bound, "max", "at most", func(c int) bool { return c <= 0 }); len(msg) != 0 {
+			return msg
+		}
+	}
+	if n, ok := tag.Lookup("len"); ok {
+		want, err := strconv.Atoi(n)
+		size, hasSize := sizeOf(field)
+		if err != nil || !hasSize {
+			return "has an invalid len tag " + strconv.Quote(n)
+		}
+		if size != want {
+			return "must have a length of " + n
+		}
+	}
+	if list, ok := tag.Lookup("oneof"); ok {
+		s := fmt.Sprint(field.Interface())
+		matched := false
+		for _, item := range strings.Fields(list) {
+			if item == s {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return "must be one of " + list
+		}
+	}
+	if expr, ok := tag.Lookup("regexp"); ok {
+		re, err := regexp.Compile(expr)
+		if err != nil || field.Kind() != reflect.String {
+			return "has an invalid regexp tag " + strconv.Quote(expr)
+		}
+		if !re.MatchString(field.String()) {
+			return "must match " + expr
+		}
+	}
+	return ""
+}
+
+//checkBound compares the field with the bound of the tag, numbers by value and the others by length
+func checkBound(field reflect.Value, bound, tag, desc string, ok func(c int) bool) string {
+	c, err := compareBound(field, bound)
+	if err != nil {
+		return "has an invalid " + tag + " tag " + strconv.Quote(bound)
+	}
+	if ok(c) {
+		return ""
+	}
+	if field.CanInt() || field.CanUint() || field.CanFloat() {
+		return "must be " + desc + " " + bound
+	}
+	return "must have a length of " + desc + " " + bound
+}
+
+//compareBound returns -1, 0 or 1 if the field is less than, equal to or greater than the bound
+func compareBound(field reflect.Value, bound string) (int, error) {
+	var c int
+	switch {
+	case field.Type() == durationType:
+		d, err := time.ParseDuration(bound)
+		if err != nil {
+			return 0, err
+		}
+		c = compareNum(field.Int(), int64(d))
+	case field.CanInt():
+		n, err := strconv.ParseInt(bound, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		c = compareNum(field.Int(), n)
+	case field.CanUint():
+		n, err := strconv.ParseUint(bound, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		c = compareNum(field.Uint(), n)
+	case field.CanFloat():
+		n, err := strconv.ParseFloat(bound, 64)
+		if err != nil {
+			return 0, err
+		}
+		c = compareNum(field.Float(), n)
+	default:
+		size, ok := sizeOf(field)
+		n, err := strconv.Atoi(bound)
+		if !ok {
+			return 0, errTypeMismatch
+		} else if err != nil {
+			return 0, err
+		}
+		c = compareNum(size, n)
+	}
+	return c, nil
+}
+
+func compareNum[T int | int64 | uint64 | float64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+//sizeOf gets the length of strings in characters, and of arrays and maps
+func sizeOf(field reflect.Value) (int, bool) {
+	switch field.Kind() {
+	case reflect.String:
+		return utf8.RuneCountInString(field.String()), true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return field.Len(), true
+	}
+	return 0, false
+}
@@ -0,0 +1,126 @@
+package fml
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type tagServer struct {
+	Host    string        `fml:"host" required:"true"`
+	Port    int           `fml:"port" default:"8080" min:"1" max:"65535"`
+	Mode    string        `fml:"mode" default:"debug" oneof:"debug release"`
+	Name    string        `fml:"name" regexp:"^[a-z]+$"`
+	Tags    []string      `fml:"tags" default:"[a, b]"`
+	Peers   []string      `fml:"peers" len:"2"`
+	Timeout time.Duration `fml:"timeout" default:"30s" max:"1m"`
+	Ratio   *float64      `fml:"ratio" min:"0" max:"1"`
+}
+
+type tagConfig struct {
+	tagBase
+	Server tagServer `fml:"server"`
+	Cache  struct {
+		Size int    `fml:"size" default:"64"`
+		Dir  string `fml:"dir" required:"true"`
+	} `fml:"cache"`
+}
+
+type tagBase struct {
+	Env string `fml:"env" default:"dev" len:"3"`
+}
+
+func TestUnmarshalTags(t *testing.T) {
+	var c tagConfig
+	err := UnmarshalString("[server]\nhost: local\nname: app\npeers: [a, b]\n\n[cache]\ndir: tmp\n", &c)
+	if err != nil {
+		t.Fatal("Unmarshal failed:", err)
+	}
+	s := c.Server
+	if s.Port != 8080 || s.Mode != "debug" || len(s.Tags) != 2 || s.Timeout != 30*time.Second || s.Ratio != nil {
+		t.Error("Should set the defaults, got:", s)
+	}
+	if c.Env != "dev" || c.Cache.Size != 64 {
+		t.Error("Should set the defaults of embedded structs and missing keys, got:", c)
+	}
+
+	c = tagConfig{}
+	c.Server.Port = 9090
+	UnmarshalString("[server]\nhost: local\n\n[cache]\ndir: tmp\n", &c)
+	if c.Server.Port != 9090 {
+		t.Error("Should not set the defaults of fields set before, got:", c.Server.Port)
+	}
+
+	cases := []struct {
+		input, path, msg string
+		line             int
+	}{
+		{"[server]\nname: app\n", "server.host", "is required", 1},
+		{"env: prod\n\n[server]\nhost: local\nport: 0\n", "server.port", "must be at least 1", 5},
+		{"[server]\nhost: local\nport: 70000\n", "server.port", "must be at most 65535", 3},
+		{"[server]\nhost: local\nmode: test\n", "server.mode", "must be one of debug release", 3},
+		{"[server]\nhost: local\nname: App\n", "server.name", "must match ^[a-z]+$", 3},
+		{"[server]\nhost: local\npeers: [a]\n", "server.peers", "must have a length of 2", 3},
+		{"[server]\nhost: local\ntimeout: 2m\n", "server.timeout", "must be at most 1m", 3},
+		{"[server]\nhost: local\nratio: 1.5\n", "server.ratio", "must be at most 1", 3},
+		{"env: test1\n", "env", "must have a length of 3", 1},
+		{"[cache]\nsize: 1\n\n[server]\nhost: h\n", "cache.dir", "is required", 1},
+		{"[server]\nhost: h\n", "cache.dir", "is required", 0},
+		{"name: x\n\n[cache]\ndir: tmp\n", "server.host", "is required", 0},
+	}
+	for _, c := range cases {
+		var v tagConfig
+		err := UnmarshalString(c.input, &v)
+		var fe *FieldError
+		if !errors.As(err, &fe) || fe.Path != c.path || fe.Msg != c.msg || fe.Line != c.line {
+			t.Errorf("Should fail for %q with %s %s at line %d, got: %v", c.input, c.path, c.msg, c.line, err)
+		}
+	}
+}
+
+func TestUnmarshalMissingNode(t *testing.T) {
+	var c struct {
+		Limits struct {
+			Conns int `fml:"conns" default:"0" min:"1"`
+		} `fml:"limits"`
+		Proxy *tagServer `fml:"proxy"`
+	}
+	err := UnmarshalString("name: x\n", &c)
+	if err == nil || err.Error() != "decode fml failed: limits.conns must be at least 1" {
+		t.Error("Should check the defaults of a missing node, got:", err)
+	}
+	if err = UnmarshalString("[limits]\nconns: 2\n", &c); err != nil || c.Proxy != nil {
+		t.Error("Should skip a missing optional node, got:", c.Proxy, err)
+	}
+}
+
+func TestApplyDefaults(t *testing.T) {
+	var c tagConfig
+	if err := ApplyDefaults(&c); err != nil {
+		t.Fatal("ApplyDefaults failed:", err)
+	}
+	if c.Env != "dev" || c.Server.Port != 8080 || c.Server.Timeout != 30*time.Second || c.Cache.Size != 64 {
+		t.Error("Should set the defaults, got:", c)
+	}
+
+	var bad struct {
+		Port int `default:"http"`
+	}
+	err := ApplyDefaults(&bad)
+	if err == nil || !strings.Contains(err.Error(), "Port has an invalid default") {
+		t.Error("Should fail for an invalid default, got:", err)
+	}
+	if ApplyDefaults(c) != errTypeMismatch {
+		t.Error("Should fail for non-pointers")
+	}
+}
+
+func TestGetStructTags(t *testing.T) {
+	doc, _ := ParseString("[app]\n\n[app.server]\nport: 0\n")
+	var s tagServer
+	err := doc.GetStruct("app.server", &s)
+	if err == nil || err.Error() != "decode fml failed: app.server.host is required" {
+		t.Error("Should name the path of the node, got:", err)
+	}
+}
@@ -0,0 +1,771 @@
+package fml
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	errTOMLNull = errors.New("null can't be expressed in toml")
+
+	tomlInt   = regexp.MustCompile(`^[-+]?(0|[1-9](_?[0-9])*)$`)
+	tomlRadix = regexp.MustCompile(`^0(x[0-9A-Fa-f](_?[0-9A-Fa-f])*|o[0-7](_?[0-7])*|b[01](_?[01])*)$`)
+	tomlFloat = regexp.MustCompile(`^[-+]?(0|[1-9](_?[0-9])*)(\.[0-9](_?[0-9])*)?([eE][-+]?[0-9](_?[0-9])*)?$`)
+	tomlTime  = regexp.MustCompile(`^[0-9]{2}:[0-9]{2}:[0-9]{2}(\.[0-9]+)?$`)
+)
+
+// A TOMLError reports TOML which is invalid, or can't be expressed in fml, and the line of it.
+type TOMLError struct {
+	Line int
+	Msg  string
+}
+
+func (e *TOMLError) Error() string {
+	return fmt.Sprintf("convert toml failed at line %d: %s", e.Line, e.Msg)
+}
+
+// ToTOML converts the node to a TOML document. Nodes are tables, node lists are arrays of tables,
+// datetimes are offset datetimes, or local dates if they are dates in UTC, and sealed secrets are
+// strings like "enc:aes:...". Values are written before tables, keys in order.
+// TOML has no null, so a null value fails the conversion.
+func (f *FML) ToTOML() ([]byte, error) {
+	f.rlock()
+	defer f.runlock()
+	var b strings.Builder
+	if err := writeTOMLTable(&b, f, nil); err != nil {
+		return nil, err
+	}
+	return []byte(b.String()), nil
+}
+
+// FromTOML converts a TOML document to a fml document, the reverse of ToTOML. Tables and inline
+// tables are nodes, arrays of tables and arrays of inline tables are node lists, other arrays must
+// have items of the same type, except integers and floats, which make an array of floats.
+// Local datetimes and local dates are datetimes in UTC, and strings like "enc:aes:..." are sealed secrets.
+//
+// What fml can't express is reported as a TOMLError: local times, nested arrays, arrays mixing types,
+// and keys like "a=b" or "a@b".
+func FromTOML(data []byte) (*FML, error) {
+	src := bytes.ReplaceAll(bytes.TrimPrefix(data, []byte("\uFEFF")), []byte("\r\n"), []byte("\n"))
+	doc := NewFml()
+	p := &tomlParser{src: src, cur: doc, kinds: map[*FML]tomlKind{doc: tomlHeader}}
+	for i := 0; i < len(src); {
+		r, size := utf8.DecodeRune(src[i:])
+		if r == utf8.RuneError && size == 1 {
+			return nil, p.errorAt(i, "invalid UTF-8")
+		}
+		i += size
+	}
+
+	for p.pos < len(p.src) {
+		p.skipSpace()
+		var err error
+		switch {
+		case p.pos == len(p.src) || p.src[p.pos] == '\n' || p.src[p.pos] == '#':
+		case p.src[p.pos] == '[':
+			err = p.parseHeader(doc)
+		default:
+			err = p.parseKeyValue(p.cur)
+		}
+		if err == nil {
+			err = p.endLine()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+//tomlKind is how a table is defined, which decides how it can be extended
+type tomlKind int
+
+const (
+	tomlImplicit tomlKind = iota //created by the header of a sub table
+	tomlHeader                   //defined by a header
+	tomlDotted                   //defined by dotted keys
+	tomlInline                   //an inline table, or an item of a static array, which can't be extended
+)
+
+type tomlParser struct {
+	src   []byte
+	pos   int
+	cur   *FML //the table of the last header
+	kinds map[*FML]tomlKind
+}
+
+func (p *tomlParser) errorf(format string, args ...interface{}) error {
+	return p.errorAt(p.pos, format, args...)
+}
+
+func (p *tomlParser) errorAt(pos int, format string, args ...interface{}) error {
+	return &TOMLError{Line: lineOf(p.src, pos), Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *tomlParser) skipSpace() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+//skipBlank skips spaces, line ends and comments, which may be between the items of an array
+func (p *tomlParser) skipBlank() {
+	for p.skipSpace(); p.pos < len(p.src); p.skipSpace() {
+		switch p.src[p.pos] {
+		case '\n':
+			p.pos++
+		case '#':
+			p.skipComment()
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) skipComment() {
+	for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+		p.pos++
+	}
+}
+
+//endLine skips the rest of the line, which may only be a comment
+func (p *tomlParser) endLine() error {
+	p.skipSpace()
+	if p.pos < len(p.src) && p.src[p.pos] == '#' {
+		p.skipComment()
+	}
+	if p.pos < len(p.src) && p.src[p.pos] != '\n' {
+		return p.errorf("unexpected content: %s", p.rest())
+	}
+	p.pos++
+	return nil
+}
+
+//rest returns the rest of the line for error messages
+func (p *tomlParser) rest() string {
+	end := bytes.IndexByte(p.src[p.pos:], '\n')
+	if end < 0 {
+		end = len(p.src) - p.pos
+	}
+	return string(p.src[p.pos : p.pos+end])
+}
+
+//parseHeader parses a table header like [a.b], or a header of an array of tables like [[a.b]]
+func (p *tomlParser) parseHeader(doc *FML) error {
+	list := bytes.HasPrefix(p.src[p.pos:], []byte("[["))
+	closing := "]"
+	if list {
+		closing = "]]"
+	}
+	p.pos += len(closing)
+	keys, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(p.src[p.pos:], []byte(closing)) {
+		return p.errorf("expected %s after the table name", closing)
+	}
+	p.pos += len(closing)
+
+	node := doc
+	for i := 1; i < len(keys); i++ {
+		if node, err = p.headerTable(node, keys[:i]); err != nil {
+			return err
+		}
+	}
+	name, key := strings.Join(keys, "."), keys[len(keys)-1]
+	sub := NewFml()
+	switch v := node.dict[key].(type) {
+	case *FML:
+		switch {
+		case list:
+			return p.errorf("%s is a table, not an array of tables", name)
+		case p.kinds[v] == tomlHeader:
+			return p.errorf("the table %s is defined twice", name)
+		case p.kinds[v] == tomlDotted:
+			return p.errorf("the table %s is defined by dotted keys", name)
+		case p.kinds[v] == tomlInline:
+			return p.errorf("the inline table %s can't be extended", name)
+		}
+		sub = v
+	case []*FML:
+		if !list {
+			return p.errorf("%s is an array of tables, not a table", name)
+		} else if p.kinds[v[0]] == tomlInline {
+			return p.errorf("the static array %s can't be extended", name)
+		}
+		node.dict[key] = append(v, sub)
+	default:
+		if _, ok := node.dict[key]; ok {
+			return p.errorf("%s is already defined as a value", name)
+		}
+		var val interface{} = sub
+		if list {
+			val = []*FML{sub}
+		}
+		if !canWriteKey(key, val) {
+			return p.errorf("the key %q can't be expressed in fml", key)
+		}
+		node.dict[key] = val
+	}
+	p.kinds[sub] = tomlHeader
+	p.cur = sub
+	return nil
+}
+
+//headerTable returns the table of the last key of a header path, which is created if it's not defined.
+//The table of an array of tables is its last item.
+func (p *tomlParser) headerTable(node *FML, path []string) (*FML, error) {
+	key := path[len(path)-1]
+	switch v := node.dict[key].(type) {
+	case *FML:
+		if p.kinds[v] == tomlInline {
+			return nil, p.errorf("the inline table %s can't be extended", strings.Join(path, "."))
+		}
+		return v, nil
+	case []*FML:
+		if p.kinds[v[0]] == tomlInline {
+			return nil, p.errorf("the static array %s can't be extended", strings.Join(path, "."))
+		}
+		return v[len(v)-1], nil
+	}
+	if _, ok := node.dict[key]; ok {
+		return nil, p.errorf("%s is already defined as a value", strings.Join(path, "."))
+	}
+	sub := NewFml()
+	if !canWriteKey(key, sub) {
+		return nil, p.errorf("the key %q can't be expressed in fml", key)
+	}
+	node.dict[key] = sub
+	return sub, nil
+}
+
+//parseKeyValue parses a line like a.b = 1 into the node, tables of dotted keys are created
+func (p *tomlParser) parseKeyValue(node *FML) error {
+	start := p.pos
+	keys, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+	if p.pos >= len(p.src) || p.src[p.pos] != '=' {
+		return p.errorf("expected = after the key")
+	}
+	p.pos++
+
+	for i, key := range keys[:len(keys)-1] {
+		switch v := node.dict[key].(type) {
+		case *FML:
+			if p.kinds[v] != tomlDotted {
+				return p.errorAt(start, "the table %s can't be extended by dotted keys", strings.Join(keys[:i+1], "."))
+			}
+			node = v
+		default:
+			if _, ok := node.dict[key]; ok {
+				return p.errorAt(start, "%s is already defined as a value", strings.Join(keys[:i+1], "."))
+			}
+			sub := NewFml()
+			if !canWriteKey(key, sub) {
+				return p.errorAt(start, "the key %q can't be expressed in fml", key)
+			}
+			p.kinds[sub] = tomlDotted
+			node.dict[key] = sub
+			node = sub
+		}
+	}
+	key := keys[len(keys)-1]
+	if _, ok := node.dict[key]; ok {
+		return p.errorAt(start, "duplicate key: %s", strings.Join(keys, "."))
+	}
+
+	p.skipSpace()
+	val, err := p.parseValue()
+	if err != nil {
+		return err
+	}
+	if !canWriteKey(key, val) {
+		return p.errorAt(start, "the key %q can't be expressed in fml", key)
+	}
+	node.dict[key] = val
+	return nil
+}
+
+//parseKey parses a key of bare and quoted parts separated by dots
+func (p *tomlParser) parseKey() ([]string, error) {
+	var keys []string
+	for {
+		p.skipSpace()
+		start := p.pos
+		if p.pos < len(p.src) && (p.src[p.pos] == '"' || p.src[p.pos] == '\'') {
+			key, err := p.parseString(false)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+		} else {
+			for p.pos < len(p.src) && isBareKeyChar(p.src[p.pos]) {
+				p.pos++
+			}
+			if p.pos == start {
+				return nil, p.errorf("expected a key")
+			}
+			keys = append(keys, string(p.src[start:p.pos]))
+		}
+
+		p.skipSpace()
+		if p.pos >= len(p.src) || p.src[p.pos] != '.' {
+			return keys, nil
+		}
+		p.pos++
+	}
+}
+
+func (p *tomlParser) parseValue() (interface{}, error) {
+	if p.pos >= len(p.src) || p.src[p.pos] == '\n' || p.src[p.pos] == '#' {
+		return nil, p.errorf("expected a value")
+	}
+	switch p.src[p.pos] {
+	case '"', '\'':
+		s, err := p.parseString(true)
+		if secret, ok := evalSecret(s); ok && err == nil {
+			return secret, nil
+		}
+		return s, err
+	case '[':
+		return p.parseArray()
+	case '{':
+		return p.parseInlineTable()
+	}
+
+	start := p.pos
+	p.scanToken()
+	//a date and a time may be separated by a space
+	if p.pos-start == 10 && p.pos+3 < len(p.src) && p.src[p.pos] == ' ' &&
+		isDigit(p.src[p.pos+1]) && isDigit(p.src[p.pos+2]) && p.src[p.pos+3] == ':' {
+		p.pos++
+		p.scanToken()
+	}
+	token := string(p.src[start:p.pos])
+
+	switch token {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "inf", "+inf":
+		return math.Inf(1), nil
+	case "-inf":
+		return math.Inf(-1), nil
+	case "nan", "+nan", "-nan":
+		return math.NaN(), nil
+	}
+	digits := strings.ReplaceAll(token, "_", "")
+	switch {
+	case tomlInt.MatchString(token):
+		i, err := strconv.ParseInt(digits, 10, 0)
+		if err != nil {
+			return nil, p.errorAt(start, "the integer %s is out of range", token)
+		}
+		return int(i), nil
+	case tomlRadix.MatchString(token):
+		base := map[byte]int{'x': 16, 'o': 8, 'b': 2}[token[1]]
+		i, err := strconv.ParseInt(digits[2:], base, 0)
+		if err != nil {
+			return nil, p.errorAt(start, "the integer %s is out of range", token)
+		}
+		return int(i), nil
+	case tomlFloat.MatchString(token):
+		f, err := strconv.ParseFloat(digits, 64)
+		if err != nil {
+			return nil, p.errorAt(start, "the float %s is out of range", token)
+		}
+		return f, nil
+	case tomlTime.MatchString(token):
+		return nil, p.errorAt(start, "local times like %s can't be expressed in fml", token)
+	}
+	if t, ok := parseTOMLDatetime(token); ok {
+		return t, nil
+	}
+	return nil, p.errorAt(start, "invalid value: %s", token)
+}
+
+//scanToken scans a number, a bool or a datetime
+func (p *tomlParser) scanToken() {
+	for p.pos < len(p.src) && bytes.IndexByte([]byte(" \t\n,]}#"), p.src[p.pos]) < 0 {
+		p.pos++
+	}
+}
+
+//parseTOMLDatetime parses an offset datetime, or a local datetime or a local date as UTC
+func parseTOMLDatetime(s string) (time.Time, bool) {
+	if len(s) == 10 {
+		t, err := time.Parse(dateF, s)
+		return t, err == nil
+	}
+	if len(s) < 19 {
+		return time.Time{}, false
+	}
+	b := []byte(s)
+	if b[10] == 't' || b[10] == ' ' {
+		b[10] = 'T'
+	}
+	if b[len(b)-1] == 'z' {
+		b[len(b)-1] = 'Z'
+	}
+	if t, err := time.Parse(time.RFC3339Nano, string(b)); err == nil {
+		return t, true
+	}
+	t, err := time.Parse("2006-01-02T15:04:05.999999999", string(b))
+	return t, err == nil
+}
+
+//parseString parses a basic or a literal string, a multiple line one if multiline is true
+func (p *tomlParser) parseString(multiline bool) (string, error) {
+	start, q := p.pos, p.src[p.pos]
+	if bytes.HasPrefix(p.src[p.pos:], []byte{q, q, q}) {
+		if !multiline {
+			return "", p.errorf("keys can't be multiple line strings")
+		}
+		return p.parseMultiline(q)
+	}
+
+	for p.pos++; p.pos < len(p.src) && p.src[p.pos] != '\n'; p.pos++ {
+		switch c := p.src[p.pos]; {
+		case c == '\\' && q == '"' && p.pos+1 < len(p.src) && p.src[p.pos+1] != '\n':
+			p.pos++
+		case c == q:
+			raw := string(p.src[start+1 : p.pos])
+			p.pos++
+			if q == '\'' {
+				return raw, nil
+			}
+			return p.unescape(raw, start)
+		}
+	}
+	return "", p.errorAt(start, "the string is not closed in the line")
+}
+
+//parseMultiline parses a string in triple quotes, a line end right after the opening quotes is trimmed
+func (p *tomlParser) parseMultiline(q byte) (string, error) {
+	start := p.pos
+	p.pos += 3
+	if p.pos < len(p.src) && p.src[p.pos] == '\n' {
+		p.pos++
+	}
+	from := p.pos
+	for ; p.pos < len(p.src); p.pos++ {
+		if p.src[p.pos] == '\\' && q == '"' {
+			p.pos++
+			continue
+		}
+		if !bytes.HasPrefix(p.src[p.pos:], []byte{q, q, q}) {
+			continue
+		}
+		//up to two quotes may end the string before the closing ones
+		end := p.pos
+		for i := 0; i < 2 && end+3 < len(p.src) && p.src[end+3] == q; i++ {
+			end++
+		}
+		raw := string(p.src[from:end])
+		p.pos = end + 3
+		if q == '\'' {
+			return raw, nil
+		}
+		return p.unescape(joinLines(raw), start)
+	}
+	return "", p.errorAt(start, "the multiple line string is not closed")
+}
+
+func (p *tomlParser) unescape(raw string, pos int) (s string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = p.errorAt(pos, "%v", r)
+		}
+	}()
+	return unescape(raw), nil
+}
+
+//joinLines removes the backslashes at line ends of a multiple line basic string,
+//with the white spaces and line ends after them
+func joinLines(raw string) string {
+	var b strings.Builder
+	for i := 0; i < len(raw); i++ {
+		if raw[i] != '\\' || i+1 == len(raw) {
+			b.WriteByte(raw[i])
+			continue
+		}
+		j := i + 1
+		for j < len(raw) && (raw[j] == ' ' || raw[j] == '\t') {
+			j++
+		}
+		if j == len(raw) || raw[j] != '\n' {
+			b.WriteString(raw[i : i+2])
+			i++
+			continue
+		}
+		for j < len(raw) && (raw[j] == ' ' || raw[j] == '\t' || raw[j] == '\n') {
+			j++
+		}
+		i = j - 1
+	}
+	return b.String()
+}
+
+//parseArray parses an array, which may span lines, with comments between the items
+func (p *tomlParser) parseArray() (interface{}, error) {
+	start := p.pos
+	p.pos++
+	var items []interface{}
+	for {
+		p.skipBlank()
+		if p.pos >= len(p.src) {
+			return nil, p.errorAt(start, "the array is not closed")
+		}
+		if p.src[p.pos] == ']' {
+			p.pos++
+			break
+		}
+		item, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+
+		p.skipBlank()
+		if p.pos < len(p.src) && p.src[p.pos] == ',' {
+			p.pos++
+		} else if p.pos < len(p.src) && p.src[p.pos] != ']' {
+			return nil, p.errorf("expected , or ] in the array")
+		}
+	}
+
+	for i, item := range items {
+		switch v := item.(type) {
+		case Secret:
+			items[i] = v.String()
+		case *FML, string, int, float64, bool, time.Time:
+		default:
+			return nil, p.errorAt(start, "nested arrays can't be expressed in fml")
+		}
+	}
+	arr, err := typedArray(items)
+	if err != nil {
+		return nil, p.errorAt(start, "arrays mixing types can't be expressed in fml")
+	}
+	//typedArray copies the nodes, so the copies are frozen
+	if list, ok := arr.([]*FML); ok {
+		for _, item := range list {
+			p.freeze(item)
+		}
+	}
+	return arr, nil
+}
+
+//parseInlineTable parses an inline table, which must be in one line
+func (p *tomlParser) parseInlineTable() (interface{}, error) {
+	node := NewFml()
+	p.pos++
+	p.skipSpace()
+	if p.pos < len(p.src) && p.src[p.pos] == '}' {
+		p.pos++
+		p.freeze(node)
+		return node, nil
+	}
+
+	for {
+		p.skipSpace()
+		if p.pos < len(p.src) && p.src[p.pos] != '\n' {
+			if err := p.parseKeyValue(node); err != nil {
+				return nil, err
+			}
+			p.skipSpace()
+		}
+		if p.pos >= len(p.src) || p.src[p.pos] == '\n' {
+			return nil, p.errorf("the inline table is not closed in the line")
+		} else if p.src[p.pos] == '}' {
+			p.pos++
+			p.freeze(node)
+			return node, nil
+		} else if p.src[p.pos] != ',' {
+			return nil, p.errorf("expected , or } in the inline table")
+		}
+		p.pos++
+	}
+}
+
+//freeze marks an inline table and the tables in it, so they can't be extended
+func (p *tomlParser) freeze(node *FML) {
+	p.kinds[node] = tomlInline
+	for _, v := range node.dict {
+		switch sub := v.(type) {
+		case *FML:
+			p.freeze(sub)
+		case []*FML:
+			for _, item := range sub {
+				p.freeze(item)
+			}
+		}
+	}
+}
+
+//writeTOMLTable writes the values of the node, then its tables and arrays of tables under the path.
+//A table only holding tables has no header, as TOML defines it by the headers of them.
+func writeTOMLTable(b *strings.Builder, node *FML, path []string) error {
+	keys := node.keys()
+	sort.Strings(keys)
+	var tables []string
+	for _, k := range keys {
+		if !utf8.ValidString(k) {
+			return fmt.Errorf("convert toml failed: invalid UTF-8 in the key %q", k)
+		}
+		val := node.dict[k]
+		if isTOMLTable(val) {
+			tables = append(tables, k)
+			continue
+		}
+		s, err := tomlValue(val, true)
+		if err != nil {
+			return fmt.Errorf("convert toml failed: %s: %v", strings.Join(append(path, k), "."), err)
+		}
+		b.WriteString(tomlKey(k) + " = " + s + "\n")
+	}
+
+	for _, k := range tables {
+		sub := append(path[:len(path):len(path)], k)
+		name := make([]string, len(sub))
+		for i, key := range sub {
+			name[i] = tomlKey(key)
+		}
+		switch v := node.dict[k].(type) {
+		case *FML:
+			header := len(v.dict) == 0
+			for _, val := range v.dict {
+				header = header || !isTOMLTable(val)
+			}
+			if header {
+				writeTOMLHeader(b, "["+strings.Join(name, ".")+"]")
+			}
+			if err := writeTOMLTable(b, v, sub); err != nil {
+				return err
+			}
+		case []*FML:
+			for _, item := range v {
+				writeTOMLHeader(b, "[["+strings.Join(name, ".")+"]]")
+				if item == nil {
+					continue
+				}
+				if err := writeTOMLTable(b, item, sub); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func writeTOMLHeader(b *strings.Builder, header string) {
+	if b.Len() != 0 {
+		b.WriteByte('\n')
+	}
+	b.WriteString(header + "\n")
+}
+
+//isTOMLTable reports whether the value is written as a table or an array of tables
+func isTOMLTable(val interface{}) bool {
+	switch v := val.(type) {
+	case *FML:
+		return v != nil
+	case []*FML:
+		return len(v) != 0
+	}
+	return false
+}
+
+//tomlKey writes a key bare if it has only letters, digits, underscores and dashes, or quoted
+func tomlKey(key string) string {
+	if key == "" {
+		return `""`
+	}
+	for i := 0; i < len(key); i++ {
+		if !isBareKeyChar(key[i]) {
+			return quoteEscaped(key)
+		}
+	}
+	return key
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || isDigit(c) || c == '_' || c == '-'
+}
+
+//tomlValue formats a value, multiple line strings are literal strings in triple quotes if multiline is true
+func tomlValue(val interface{}, multiline bool) (string, error) {
+	switch v := val.(type) {
+	case nil, *FML:
+		return "", errTOMLNull
+	case string:
+		if !utf8.ValidString(v) {
+			return "", errors.New("invalid UTF-8, TOML must be UTF-8")
+		}
+		if multiline && canLiteral(v) {
+			return "'''\n" + v + "'''", nil
+		}
+		return quoteEscaped(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case float64:
+		switch {
+		case math.IsInf(v, 1):
+			return "inf", nil
+		case math.IsInf(v, -1):
+			return "-inf", nil
+		case math.IsNaN(v):
+			return "nan", nil
+		}
+		return formatFloat(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case time.Time:
+		if h, m, s := v.Clock(); v.Location() == time.UTC && h == 0 && m == 0 && s == 0 && v.Nanosecond() == 0 {
+			return v.Format(dateF), nil
+		}
+		return v.Format(time.RFC3339Nano), nil
+	case Secret:
+		return quoteEscaped(v.String()), nil
+	case []*FML:
+		return "[]", nil
+	case []string, []int, []float64, []bool, []time.Time:
+		rv := reflect.ValueOf(v)
+		items := make([]string, rv.Len())
+		for i := range items {
+			s, err := tomlValue(rv.Index(i).Interface(), false)
+			if err != nil {
+				return "", err
+			}
+			items[i] = s
+		}
+		return "[" + strings.Join(items, ", ") + "]", nil
+	}
+	return "", fmt.Errorf("unsupported value of type %T", val)
+}
+
+//canLiteral reports whether a multiple line string can be a literal string in triple quotes
+func canLiteral(s string) bool {
+	if !strings.Contains(s, "\n") || strings.Contains(s, "'''") || strings.HasSuffix(s, "'") {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if (s[i] < ' ' && s[i] != '\n' && s[i] != '\t') || s[i] == 0x7f {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,199 @@
+package fml
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestToTOML(t *testing.T) {
+	doc, _ := ParseString(`name: app
+port: 8080
+ratio: 2.0
+tags: [a, "b c"]
+when: 2014-07-06T12:00:00+08:00
+day: 2014-07-06
+password: enc:aes:c2VjcmV0
+note: |
+  first line
+  second line
+
+[db]
+host: local
+
+[db.pool]
+size: 10
+
+[server.http]
+port: 80
+
+[staff]
+- name: Abby
+  age: 30
+- name: Bill
+`)
+	out, err := doc.ToTOML()
+	if err != nil {
+		t.Fatal("ToTOML failed:", err)
+	}
+	expected := `day = 2014-07-06
+name = "app"
+note = '''
+first line
+second line
+'''
+password = "enc:aes:c2VjcmV0"
+port = 8080
+ratio = 2.0
+tags = ["a", "b c"]
+when = 2014-07-06T12:00:00+08:00
+
+[db]
+host = "local"
+
+[db.pool]
+size = 10
+
+[server.http]
+port = 80
+
+[[staff]]
+age = 30
+name = "Abby"
+
+[[staff]]
+name = "Bill"
+`
+	if string(out) != expected {
+		t.Error("Should convert to toml, got:", string(out))
+	}
+
+	back, err := FromTOML(out)
+	if err != nil || !Equal(doc, back) {
+		t.Error("Should convert back, got:", back, err)
+	}
+
+	doc.SetValue("nothing", nil)
+	if _, err = doc.ToTOML(); err == nil || err.Error() != "convert toml failed: nothing: null can't be expressed in toml" {
+		t.Error("Should fail for null, got:", err)
+	}
+}
+
+func TestFromTOML(t *testing.T) {
+	doc, err := FromTOML([]byte(`# a comment
+title = "TOML \"example\"" # trailing comment
+path = 'C:\Users'
+count = 1_000
+mask = 0xff
+ratio = 6.5e-1
+inf = -inf
+local = 1979-05-27 07:32:00
+offset = 1979-05-27T07:32:00.5-07:00
+day = 1979-05-27
+point = { x = 1, y.z = 2 }
+ports = [
+  8000, # the first
+  8001,
+]
+"quoted key" = true
+site."google.com" = true
+text = """
+one \
+  two
+three"""
+raw = '''
+a\b'''
+
+[fruit]
+apple.color = "red"
+
+[fruit.apple.texture]
+smooth = true
+
+[[products]]
+name = "Hammer"
+
+[[products]]
+
+[products.dims]
+depth = 2
+
+[[points]]
+x = 1
+[[points]]
+x = 2
+`))
+	if err != nil {
+		t.Fatal("FromTOML failed:", err)
+	}
+	if doc.GetString("title") != `TOML "example"` || doc.GetString("path") != `C:\Users` {
+		t.Error("Should read strings, got:", doc)
+	}
+	if doc.GetInt("count") != 1000 || doc.GetInt("mask") != 255 || doc.GetFloat("ratio") != 0.65 {
+		t.Error("Should read numbers, got:", doc)
+	}
+	if f := doc.GetFloat("inf"); !math.IsInf(f, -1) {
+		t.Error("Should read -inf, got:", f)
+	}
+	if local := doc.GetDatetime("local"); !local.Equal(time.Date(1979, 5, 27, 7, 32, 0, 0, time.UTC)) {
+		t.Error("Should read local datetimes in UTC, got:", local)
+	}
+	if offset := doc.GetDatetime("offset"); offset.Nanosecond() != 5e8 || offset.UTC().Hour() != 14 {
+		t.Error("Should read offset datetimes, got:", offset)
+	}
+	if doc.GetInt("point.x") != 1 || doc.GetInt("point.y.z") != 2 || len(doc.GetIntArray("ports")) != 2 {
+		t.Error("Should read inline tables and arrays, got:", doc)
+	}
+	if site, _ := doc.GetNode("site"); !doc.GetBool("quoted key") || site.dict["google.com"] != true {
+		t.Error("Should read quoted keys, got:", doc)
+	}
+	if doc.GetString("text") != "one two\nthree" || doc.GetString("raw") != `a\b` {
+		t.Error("Should read multiple line strings, got:", doc.GetString("text"), doc.GetString("raw"))
+	}
+	if doc.GetString("fruit.apple.color") != "red" || !doc.GetBool("fruit.apple.texture.smooth") {
+		t.Error("Should read tables of dotted keys, got:", doc)
+	}
+	products, err := doc.GetNodeList("products")
+	if err != nil || len(products) != 2 || products[0].GetString("name") != "Hammer" || products[1].GetInt("dims.depth") != 2 {
+		t.Error("Should read arrays of tables, got:", products, err)
+	}
+	if points, _ := doc.GetNodeList("points"); len(points) != 2 || points[1].GetInt("x") != 2 {
+		t.Error("Should read arrays of tables, got:", points)
+	}
+
+	if doc, err = FromTOML([]byte("a = []\n")); err != nil {
+		t.Fatal("FromTOML failed:", err)
+	}
+	if back, err := ParseString(doc.String()); err != nil || !back.Has("a") || len(back.GetStringArray("a")) != 0 {
+		t.Error("Should write an empty array that parses back, got:", doc.String(), err)
+	}
+}
+
+func TestFromTOMLUnsupported(t *testing.T) {
+	cases := map[string]string{
+		"a = 07:32:00":                    "convert toml failed at line 1: local times like 07:32:00 can't be expressed in fml",
+		"a = [[1], [2]]":                  "convert toml failed at line 1: nested arrays can't be expressed in fml",
+		"a = [1, \"b\"]":                  "convert toml failed at line 1: arrays mixing types can't be expressed in fml",
+		"\"a@dev\" = 1":                   `convert toml failed at line 1: the key "a@dev" can't be expressed in fml`,
+		"[\"a.b\"]\nc = 1":                `convert toml failed at line 1: the key "a.b" can't be expressed in fml`,
+		"a = 1\na = 2":                    "convert toml failed at line 2: duplicate key: a",
+		"[a]\n[a]":                        "convert toml failed at line 2: the table a is defined twice",
+		"[a]\nb.c = 1\n[a.b]":             "convert toml failed at line 3: the table a.b is defined by dotted keys",
+		"a = {b = 1}\n[a.c]":              "convert toml failed at line 2: the inline table a can't be extended",
+		"a = [{b = 1}]\n[[a]]":            "convert toml failed at line 2: the static array a can't be extended",
+		"[[a]]\n[a]":                      "convert toml failed at line 2: a is an array of tables, not a table",
+		"a = 1\n[a.b]":                    "convert toml failed at line 2: a is already defined as a value",
+		"a = {b = 1,\nc = 2}":             "convert toml failed at line 1: the inline table is not closed in the line",
+		"a = \"open":                      "convert toml failed at line 1: the string is not closed in the line",
+		"a = 1 b = 2":                     "convert toml failed at line 1: unexpected content: b = 2",
+		"a = 9223372036854775808":         "convert toml failed at line 1: the integer 9223372036854775808 is out of range",
+		"a = yes":                         "convert toml failed at line 1: invalid value: yes",
+		"a = \"\\x41\"":                   "convert toml failed at line 1: invalid escape sequence: \\x",
+		"\n\nlist = [\n  1,\n  2\n  3\n]": "convert toml failed at line 6: expected , or ] in the array",
+	}
+	for input, msg := range cases {
+		if _, err := FromTOML([]byte(input)); err == nil || err.Error() != msg {
+			t.Errorf("Should fail for %q with %q, got: %v", input, msg, err)
+		}
+	}
+}
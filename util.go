@@ -1,16 +1,16 @@
 package fml
 
 import (
+	"fmt"
 	. "github.com/fipress/fiputil"
 	"strings"
-	"unicode"
 )
 
 //Skip spaces and comments
-func skipLeft(input []byte) (skip int) {
+func (p *parser) skipLeft(input []byte) (skip int) {
 	i := 0
 	for i < len(input) {
-		if input[i] == '#' {
+		if p.isComment(input[i]) {
 			i += skipComments(input[i:])
 		} else if IsSpaceOrLineEnd(input[i]) {
 			i++
@@ -22,10 +22,10 @@ func skipLeft(input []byte) (skip int) {
 }
 
 //Skip comments or spaces until line end
-func skipRest(input []byte) (skip int) {
+func (p *parser) skipRest(input []byte) (skip int) {
 	i := 0
 	for i < len(input) {
-		if input[i] == '#' {
+		if p.isComment(input[i]) {
 			i += skipComments(input[i:])
 		} else if IsSpace(input[i]) {
 			i++
@@ -38,22 +38,42 @@ func skipRest(input []byte) (skip int) {
 	return i
 }
 
+//Skip spaces and comments, but stop before the line end
+func (p *parser) skipSpaceAndComment(input []byte) int {
+	i := SkipSpace(input)
+	if i < len(input) && p.isComment(input[i]) {
+		i += SkipUntilFunc(input[i:], IsLineEnd, false)
+	}
+	return i
+}
+
+//skipLineEnd skips a line end at the start of input, "\r\n" is a single one
+func skipLineEnd(input []byte) int {
+	if len(input) > 1 && input[0] == '\r' && input[1] == '\n' {
+		return 2
+	} else if len(input) > 0 && IsLineEnd(input[0]) {
+		return 1
+	}
+	return 0
+}
+
 func skipComments(input []byte) int {
 	return SkipUntilFunc(input, IsLineEnd, true)
 }
 
 //A node end by blank lines.
 //A blank line means it contains only spaces or comments
-func isBlankLine(input []byte) (bool, int) {
+func (p *parser) isBlankLine(input []byte) (bool, int) {
 	i := 0
 	for ; i < len(input); i++ {
 		switch input[i] {
 		case '\n', '\r', '\f':
 			return true, i + 1
 		case ' ', '\t':
-		case '#':
-			return true, i + skipComments(input[i:])
 		default:
+			if p.isComment(input[i]) {
+				return true, i + skipComments(input[i:])
+			}
 			return false, 0
 		}
 	}
@@ -61,25 +81,26 @@ func isBlankLine(input []byte) (bool, int) {
 }
 
 //A block end by blank lines, or next line starts a list block
-func isKeyValueBlockEnd(input []byte) (bool, int) {
+func (p *parser) isKeyValueBlockEnd(input []byte) (bool, int) {
 	isList, _ := isListPrefix(input)
 	if isList {
 		return true, 0
 	}
 
-	return isBlockEnd(input)
+	return p.isBlockEnd(input)
 }
 
-func isBlockEnd(input []byte) (bool, int) {
+func (p *parser) isBlockEnd(input []byte) (bool, int) {
 	i := 0
 	for ; i < len(input); i++ {
 		switch input[i] {
 		case '\n', '\r', '\f':
 			return true, i + 1
 		case ' ', '\t':
-		case '#':
-			return true, i + skipComments(input[i:])
 		default:
+			if p.isComment(input[i]) {
+				return true, i + skipComments(input[i:])
+			}
 			return false, 0
 		}
 	}
@@ -88,7 +109,7 @@ func isBlockEnd(input []byte) (bool, int) {
 
 func isListPrefix(input []byte) (bool, int) {
 	idx := SkipSpace(input)
-	if idx+2 < len(input) &&
+	if idx+1 < len(input) &&
 		input[idx] == '-' &&
 		IsSpace(input[idx+1]) {
 		return true, idx + 2
@@ -97,10 +118,10 @@ func isListPrefix(input []byte) (bool, int) {
 }
 
 //value end at line end or comment
-func skipUntilValueEnd(input []byte) int {
+func (p *parser) skipUntilValueEnd(input []byte) int {
 	i := 0
 	for ; i < len(input); i++ {
-		if input[i] == '#' && IsSpace(input[i-1]) {
+		if i > 0 && p.isComment(input[i]) && IsSpace(input[i-1]) {
 			return i - 1
 		}
 		if IsLineEnd(input[i]) {
@@ -111,12 +132,88 @@ func skipUntilValueEnd(input []byte) int {
 }
 
 //get value in string
-func getRawValue(input []byte) (string, int) {
+func (p *parser) getRawValue(input []byte) (string, int) {
+	val, end := p.scanRawValue(input)
+	idx := end + p.skipRest(input[end:])
+	return val, idx
+}
+
+//scanRawValue gets value in string and where it ends, trailing spaces excluded
+func (p *parser) scanRawValue(input []byte) (string, int) {
 	start := SkipSpace(input)
-	end := start + skipUntilValueEnd(input[start:])
-	val := string(input[start:end])
-	val = strings.TrimRightFunc(val, unicode.IsSpace)
+	end := start + p.skipUntilValueEnd(input[start:])
+	for end > start && IsSpace(input[end-1]) {
+		end--
+	}
+	return p.str(input, start, end), end
+}
 
-	idx := end + skipRest(input[end:])
-	return val, idx
+//trimSpace gets where an array item starts and ends without leading and trailing spaces
+func trimSpace(input []byte) (from, to int) {
+	to = len(input)
+	for to > 0 && isArraySpace(input[to-1]) {
+		to--
+	}
+	for from < to && isArraySpace(input[from]) {
+		from++
+	}
+	return
+}
+
+//isArraySpace reports whether c is a space between array items, items are trimmed of the same spaces.
+//The scanner uses the same ones, so an item like \v is kept by both.
+func isArraySpace(c byte) bool {
+	switch c {
+	case ' ', '\t', '\n', '\r', '\f':
+		return true
+	}
+	return false
+}
+
+//canWriteKey reports whether the key of the value reads back as it is when written in fml.
+//No key holds delimiters or profiles after a @, keys of values can't start like comments or node headers,
+//and names of nodes can't hold dots, which nest nodes.
+func canWriteKey(key string, val interface{}) bool {
+	if key == "" || key != strings.TrimSpace(key) || strings.ContainsAny(key, ":=") || strings.LastIndexByte(key, '@') > 0 {
+		return false
+	}
+	switch val.(type) {
+	case *FML, []*FML:
+		return !strings.ContainsAny(key, ".]")
+	}
+	if key[0] == '#' || key[0] == '[' {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < ' ' || key[i] == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+//quoteEscaped quotes the string by double quotes with the escapes YAML and TOML share,
+//which are the ones of fml strings too
+func quoteEscaped(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r < ' ' || r == 0x7f:
+			fmt.Fprintf(&b, `\u%04x`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
 }
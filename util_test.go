@@ -33,19 +33,19 @@ func TestSkipComments(t *testing.T) {
 
 func TestIsBlockEnd(t *testing.T) {
 	input := "  # lines contains only space and comments considered a block end"
-	isEnd, idx := isBlockEnd([]byte(input))
+	isEnd, idx := testParser.isBlockEnd([]byte(input))
 	if !isEnd || idx != len(input) {
 		t.Error("Should be a block end, and idx should be the length, idx:", idx, "len:", len(input))
 	}
 
 	input = "  "
-	isEnd, idx = isBlockEnd([]byte(input))
+	isEnd, idx = testParser.isBlockEnd([]byte(input))
 	if !isEnd || idx != 2 {
 		t.Error("Should be a block end, and idx should be 2, idx:", idx)
 	}
 
 	input = "  not block end"
-	isEnd, idx = isBlockEnd([]byte(input))
+	isEnd, idx = testParser.isBlockEnd([]byte(input))
 	if isEnd || idx != 0 {
 		t.Error("Should NOT be a block end, and idx should be 0, idx:", idx)
 	}
@@ -53,19 +53,19 @@ func TestIsBlockEnd(t *testing.T) {
 
 func TestKeyValueBlockEnd(t *testing.T) {
 	input := "  # lines contains only space and comments considered a block end"
-	isEnd, idx := isKeyValueBlockEnd([]byte(input))
+	isEnd, idx := testParser.isKeyValueBlockEnd([]byte(input))
 	if !isEnd || idx != len(input) {
 		t.Error("Should be a block end, and idx should be the length, idx:", idx, "len:", len(input))
 	}
 
 	input = "  - a line starts a list considered a block end"
-	isEnd, idx = isKeyValueBlockEnd([]byte(input))
+	isEnd, idx = testParser.isKeyValueBlockEnd([]byte(input))
 	if !isEnd || idx != 0 {
 		t.Error("Should be a block end, and idx should be 0, idx:", idx)
 	}
 
 	input = "  not block end"
-	isEnd, idx = isKeyValueBlockEnd([]byte(input))
+	isEnd, idx = testParser.isKeyValueBlockEnd([]byte(input))
 	if isEnd || idx != 0 {
 		t.Error("Should NOT be a block end, and idx should be 0, idx:", idx)
 	}
@@ -73,13 +73,13 @@ func TestKeyValueBlockEnd(t *testing.T) {
 
 func TestIsNodeEnd(t *testing.T) {
 	input := "  # lines contains only space and comments considered a node end"
-	isEnd, idx := isBlankLine([]byte(input))
+	isEnd, idx := testParser.isBlankLine([]byte(input))
 	if !isEnd || idx != len(input) {
 		t.Error("Should be a node end, and idx should be the length, idx:", idx, "len:", len(input))
 	}
 
 	input = "  not node end"
-	isEnd, idx = isBlankLine([]byte(input))
+	isEnd, idx = testParser.isBlankLine([]byte(input))
 	if isEnd || idx != 0 {
 		t.Error("Should NOT be a node end, and idx should be 0, idx:", idx)
 	}
@@ -87,13 +87,13 @@ func TestIsNodeEnd(t *testing.T) {
 
 func TestSkipRest(t *testing.T) {
 	input := "  # Skip rest will skip spaces and comments, and one line end\n"
-	idx := skipRest([]byte(input))
+	idx := testParser.skipRest([]byte(input))
 	if idx != len(input) {
 		t.Error("Should only skip one line end, idx:", idx, "len:", len(input))
 	}
 
 	input = "  \n\n"
-	idx = skipRest([]byte(input))
+	idx = testParser.skipRest([]byte(input))
 	if idx != len(input)-1 {
 		t.Error("Should only skip one line end, idx:", idx, "len:", len(input))
 
@@ -102,7 +102,7 @@ func TestSkipRest(t *testing.T) {
 
 func TestSkipLeft(t *testing.T) {
 	input := "  # Skip rest will skip spaces and comments, and one line end\n\n  real"
-	idx := skipLeft([]byte(input))
+	idx := testParser.skipLeft([]byte(input))
 	if idx != len(input)-4 {
 		t.Error("Should skip all spaces and line ends and comments, idx:", idx, "len:", len(input))
 	}
@@ -110,19 +110,19 @@ func TestSkipLeft(t *testing.T) {
 
 func TestSkipUntilValueEnd(t *testing.T) {
 	input := "abc # comments"
-	idx := skipUntilValueEnd([]byte(input))
+	idx := testParser.skipUntilValueEnd([]byte(input))
 	if idx != 3 {
 		t.Error("Should skip 3,idx:", idx)
 	}
 
 	input = "abc \n"
-	idx = skipUntilValueEnd([]byte(input))
+	idx = testParser.skipUntilValueEnd([]byte(input))
 	if idx != 4 {
 		t.Error("Should skip 4,idx:", idx)
 	}
 
 	input = "abc"
-	idx = skipUntilValueEnd([]byte(input))
+	idx = testParser.skipUntilValueEnd([]byte(input))
 	if idx != 3 {
 		t.Error("Should skip 3,idx:", idx)
 	}
@@ -130,13 +130,13 @@ func TestSkipUntilValueEnd(t *testing.T) {
 
 func TestGetRawValue(t *testing.T) {
 	input := "abc # comment"
-	val, idx := getRawValue([]byte(input))
+	val, idx := testParser.getRawValue([]byte(input))
 	if val != "abc" || idx != len(input) {
 		t.Error("Should get abc,val:", val, "idx:", idx)
 	}
 
 	input = "abc  \n"
-	val, idx = getRawValue([]byte(input))
+	val, idx = testParser.getRawValue([]byte(input))
 	if val != "abc" || idx != len(input) {
 		t.Error("Should get abc,val:", val, "idx:", idx)
 	}
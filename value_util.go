@@ -2,11 +2,18 @@ package fml
 
 import (
 	"reflect"
+	"sort"
 	"strings"
 	"time"
 )
 
+var timeType = reflect.TypeOf(time.Time{})
+
 func getString(rawVal interface{}) (val string, err error) {
+	rawVal, err = reveal(rawVal)
+	if err != nil {
+		return
+	}
 	switch v := rawVal.(type) {
 	case string:
 		val = v
@@ -18,7 +25,24 @@ func getString(rawVal interface{}) (val string, err error) {
 	return
 }
 
+//scalarString gets a scalar value as a string, other types than strings are written as they are in fml
+func scalarString(rawVal interface{}) (string, error) {
+	rawVal, err := reveal(rawVal)
+	if err != nil {
+		return "", err
+	}
+	switch v := rawVal.(type) {
+	case bool, int, float64, time.Time:
+		return wrapVal(v), nil
+	}
+	return getString(rawVal)
+}
+
 func getBool(rawVal interface{}) (val bool, err error) {
+	rawVal, err = reveal(rawVal)
+	if err != nil {
+		return
+	}
 	switch v := rawVal.(type) {
 	case bool:
 		val = v
@@ -37,6 +61,10 @@ func getBool(rawVal interface{}) (val bool, err error) {
 }
 
 func getInt(rawVal interface{}) (val int, err error) {
+	rawVal, err = reveal(rawVal)
+	if err != nil {
+		return
+	}
 	switch v := rawVal.(type) {
 	case int:
 		val = v
@@ -55,6 +83,10 @@ func getInt(rawVal interface{}) (val int, err error) {
 }
 
 func getFloat(rawVal interface{}) (val float64, err error) {
+	rawVal, err = reveal(rawVal)
+	if err != nil {
+		return
+	}
 	switch v := rawVal.(type) {
 	case float64:
 		val = v
@@ -73,6 +105,10 @@ func getFloat(rawVal interface{}) (val float64, err error) {
 }
 
 func getTime(rawVal interface{}) (val time.Time, err error) {
+	rawVal, err = reveal(rawVal)
+	if err != nil {
+		return
+	}
 	switch v := rawVal.(type) {
 	case time.Time:
 		val = v
@@ -92,6 +128,29 @@ func getTime(rawVal interface{}) (val time.Time, err error) {
 }
 
 func getStruct(node *FML, val interface{}) (err error) {
+	return new(decoder).decodeStruct(node, val, "")
+}
+
+//a decoder decodes nodes into structs, knowing where they are in the source to report errors
+type decoder struct {
+	input  []byte
+	spans  map[string]span
+	starts map[string]int
+}
+
+//line gets the line of the value or the node of the path, 0 if unknown
+func (d *decoder) line(path string) int {
+	if sp, ok := d.spans[path]; ok {
+		return lineOf(d.input, sp.start)
+	} else if start, ok := d.starts[path]; ok {
+		return lineOf(d.input, start)
+	}
+	return 0
+}
+
+//decodeStruct decodes the node of the path into the struct val points to,
+//and then applies the default, required and constraint tags of its fields
+func (d *decoder) decodeStruct(node *FML, val interface{}, path string) (err error) {
 	rv := reflect.ValueOf(val)
 	//rv.Kind() == Struct?
 	if rv.Kind() != reflect.Ptr || rv.IsNil() {
@@ -99,61 +158,258 @@ func getStruct(node *FML, val interface{}) (err error) {
 	}
 
 	el := rv.Elem()
+	if ok, err := decodeCustom(el, node); ok {
+		return err
+	}
+	if el.Kind() == reflect.Map || el.Kind() == reflect.Interface && el.NumMethod() == 0 {
+		return convertValue(el, node)
+	}
 	if el.Kind() != reflect.Struct {
 		return errTypeMismatch
 	}
 
-	for k, v := range node.dict {
-		field := el.FieldByName(k)
-		if !field.IsValid() {
-			field = el.FieldByName(strings.Title(k))
-		}
-		if !field.IsValid() {
+	keys := node.keys()
+	sort.Strings(keys)
+	found := make(map[fieldID]string, len(keys))
+	for _, k := range keys {
+		field, opts := findField(el, k, node.ignoreCase)
+		if !field.IsValid() || !field.CanSet() {
 			continue
 		}
-		switch field.Kind() {
-		case reflect.String:
-			s, err := getString(v)
-			if err == nil {
-				field.SetString(s)
+		found[idOf(field)] = joinPath(path, k)
+		list, isList := node.dict[k].([]*FML)
+		if index := tagOpt(opts, "key"); len(index) != 0 && isList && field.Kind() == reflect.Map {
+			err = d.decodeIndex(field, list, index, joinPath(path, k))
+		} else {
+			err = d.setField(field, node.dict[k], joinPath(path, k))
+		}
+		if err != nil {
+			return
+		}
+	}
+	return d.applyTags(el, path, found)
+}
+
+//findField finds the field of a key, by the name in the fml tag, or the field name.
+//It returns the options of the tag of the field too.
+func findField(el reflect.Value, key string, ignoreCase bool) (reflect.Value, []string) {
+	t := el.Type()
+	match := -1
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, opts := parseTag(f.Tag.Get("fml"))
+		if name == "-" {
+			continue
+		} else if len(name) != 0 {
+			if name == key || (ignoreCase && strings.EqualFold(name, key)) {
+				return el.Field(i), opts
 			}
-		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
-			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-			i, err := getInt(v)
-			if err == nil {
-				field.SetInt(int64(i))
+		} else if match == -1 && (f.Name == key || f.Name == strings.Title(key) ||
+			(ignoreCase && strings.EqualFold(f.Name, key))) {
+			match = i
+		}
+	}
+	if match != -1 {
+		_, opts := parseTag(t.Field(match).Tag.Get("fml"))
+		return el.Field(match), opts
+	}
+
+	//fields of embedded structs, by their tags too
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); f.Anonymous && f.Type.Kind() == reflect.Struct && f.Type != timeType {
+			if field, opts := findField(el.Field(i), key, ignoreCase); field.IsValid() {
+				return field, opts
 			}
-		case reflect.Float32, reflect.Float64:
-			fl, err := getFloat(v)
-			if err == nil {
-				field.SetFloat(fl)
+		}
+	}
+
+	//promoted fields of embedded structs
+	for _, name := range []string{key, strings.Title(key)} {
+		if f, ok := t.FieldByName(name); ok && len(f.Index) > 1 {
+			_, opts := parseTag(f.Tag.Get("fml"))
+			return el.FieldByName(name), opts
+		}
+	}
+	return reflect.Value{}, nil
+}
+
+//parseTag parses a fml tag like `fml:"name,secret"` into the name and the options
+func parseTag(tag string) (name string, opts []string) {
+	parts := strings.Split(tag, ",")
+	return strings.TrimSpace(parts[0]), parts[1:]
+}
+
+//tagOpt gets the value of a tag option like "key=code", "" if there is none
+func tagOpt(opts []string, name string) string {
+	for _, o := range opts {
+		if o = strings.TrimSpace(o); strings.HasPrefix(o, name+"=") {
+			return strings.TrimSpace(o[len(name)+1:])
+		}
+	}
+	return ""
+}
+
+func hasOpt(opts []string, opt string) bool {
+	for _, o := range opts {
+		if strings.TrimSpace(o) == opt {
+			return true
+		}
+	}
+	return false
+}
+
+//setField sets a struct field from a raw value, values of mismatched type are ignored.
+//A null value sets pointer fields to nil.
+//Errors of decode hooks, UnmarshalFML and UnmarshalText methods are returned.
+func (d *decoder) setField(field reflect.Value, v interface{}, path string) error {
+	if ok, err := decodeCustom(field, v); ok {
+		if err == errTypeMismatch || err == errValueNotFound {
+			return nil
+		}
+		return err
+	}
+
+	if field.Type() == durationType {
+		if s, err := getString(v); err == nil {
+			convertDuration(field, s)
+		}
+		return nil
+	}
+	if t := field.Type(); t == nodeType || t == nodeListType {
+		//a node or a node list is set as it is
+		if v == nil {
+			field.Set(reflect.Zero(t))
+		} else if reflect.TypeOf(v) == t {
+			field.Set(reflect.ValueOf(v))
+		}
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.Ptr:
+		if v == nil {
+			field.Set(reflect.Zero(field.Type()))
+			return nil
+		}
+		ptr := reflect.New(field.Type().Elem())
+		if err := d.setField(ptr.Elem(), v, path); err != nil {
+			return err
+		}
+		field.Set(ptr)
+	case reflect.String:
+		s, err := getString(v)
+		if err == nil {
+			field.SetString(s)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := getInt(v)
+		if err == nil {
+			field.SetInt(int64(i))
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := getInt(v)
+		if err == nil && i >= 0 {
+			field.SetUint(uint64(i))
+		}
+	case reflect.Float32, reflect.Float64:
+		fl, err := getFloat(v)
+		if err == nil {
+			field.SetFloat(fl)
+		}
+	case reflect.Bool:
+		b, err := getBool(v)
+		if err == nil {
+			field.SetBool(b)
+		}
+	case reflect.Slice, reflect.Map, reflect.Interface:
+		node, isNode := v.(*FML)
+		list, isList := v.([]*FML)
+		if vs := getVariants(field.Type()); vs != nil && isNode {
+			return d.decodeVariant(field, vs, node, path)
+		} else if field.Kind() == reflect.Slice && isList {
+			if vs = getVariants(field.Type().Elem()); vs != nil {
+				return d.decodeVariants(field, vs, list, path)
 			}
-		case reflect.Bool:
-			b, err := getBool(v)
+		}
+		if err := convertValue(field, v); err != errTypeMismatch && err != errValueNotFound {
+			return err
+		}
+	case reflect.Struct:
+		if field.Type() == timeType {
+			dt, err := getTime(v)
 			if err == nil {
-				field.SetBool(b)
+				field.Set(reflect.ValueOf(dt))
 			}
-		case reflect.Struct:
-			if field.Type().Name() == "time.Time" {
-				dt, err := getTime(v)
-				if err == nil {
-					field.Set(reflect.ValueOf(dt))
-				}
-			} else {
-				switch fml := v.(type) {
-				case *FML:
-					sub := reflect.New(field.Type())
-					fml.GetStruct(k, sub.Interface())
-				}
-
+		} else {
+			switch fml := v.(type) {
+			case *FML:
+				return d.decodeStruct(fml, field.Addr().Interface(), path)
 			}
+		}
+	}
+	return nil
+}
 
+//cloneValue makes a deep copy of a value, so the copy shares nothing with the original.
+//An empty array stays empty rather than nil, which reads as null.
+func cloneValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case *FML:
+		node := &FML{dict: make(map[string]interface{}, len(v.dict)), ignoreCase: v.ignoreCase}
+		for k, sub := range v.dict {
+			node.dict[k] = cloneValue(sub)
+		}
+		return node
+	case []*FML:
+		list := make([]*FML, len(v))
+		for i, node := range v {
+			list[i] = cloneValue(node).(*FML)
 		}
+		return list
+	case []string:
+		return append(v[:0:0], v...)
+	case []int:
+		return append(v[:0:0], v...)
+	case []float64:
+		return append(v[:0:0], v...)
+	case []bool:
+		return append(v[:0:0], v...)
+	case []time.Time:
+		return append(v[:0:0], v...)
 	}
-	return
+	return val
+}
+
+//collectValue collects a duplicate value into an array with the old one,
+//a node is collected into a node list. Both must have the same type.
+func collectValue(old, val interface{}) (interface{}, bool) {
+	if old == nil || val == nil {
+		return nil, false
+	}
+
+	ot, vt := reflect.TypeOf(old), reflect.TypeOf(val)
+	ov, vv := reflect.ValueOf(old), reflect.ValueOf(val)
+	switch {
+	case ot == vt && ot.Kind() != reflect.Slice:
+		arr := reflect.MakeSlice(reflect.SliceOf(ot), 0, 2)
+		return reflect.Append(arr, ov, vv).Interface(), true
+	case ot == vt:
+		return reflect.AppendSlice(ov, vv).Interface(), true
+	case ot.Kind() == reflect.Slice && ot.Elem() == vt:
+		return reflect.Append(ov, vv).Interface(), true
+	case vt.Kind() == reflect.Slice && vt.Elem() == ot:
+		arr := reflect.MakeSlice(vt, 0, vv.Len()+1)
+		arr = reflect.Append(arr, ov)
+		return reflect.AppendSlice(arr, vv).Interface(), true
+	}
+	return nil, false
 }
 
 func getStringArray(rawVal interface{}) (arr []string, err error) {
+	rawVal, err = reveal(rawVal)
+	if err != nil {
+		return
+	}
 	switch a := rawVal.(type) {
 	case []string:
 		arr = a
@@ -167,6 +423,10 @@ func getStringArray(rawVal interface{}) (arr []string, err error) {
 }
 
 func getBoolArray(rawVal interface{}) (arr []bool, err error) {
+	rawVal, err = reveal(rawVal)
+	if err != nil {
+		return
+	}
 	switch a := rawVal.(type) {
 	case []bool:
 		arr = a
@@ -180,6 +440,10 @@ func getBoolArray(rawVal interface{}) (arr []bool, err error) {
 }
 
 func getIntArray(rawVal interface{}) (arr []int, err error) {
+	rawVal, err = reveal(rawVal)
+	if err != nil {
+		return
+	}
 	switch a := rawVal.(type) {
 	case []int:
 		arr = a
@@ -193,6 +457,10 @@ func getIntArray(rawVal interface{}) (arr []int, err error) {
 }
 
 func getFloatArray(rawVal interface{}) (arr []float64, err error) {
+	rawVal, err = reveal(rawVal)
+	if err != nil {
+		return
+	}
 	switch a := rawVal.(type) {
 	case []float64:
 		arr = a
@@ -206,6 +474,10 @@ func getFloatArray(rawVal interface{}) (arr []float64, err error) {
 }
 
 func getTimeArray(rawVal interface{}) (arr []time.Time, err error) {
+	rawVal, err = reveal(rawVal)
+	if err != nil {
+		return
+	}
 	switch a := rawVal.(type) {
 	case []time.Time:
 		arr = a
@@ -0,0 +1,106 @@
+package fml
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+//the variants of an interface type, by the value of their discriminator key
+type variants struct {
+	key   string
+	types map[string]reflect.Type
+}
+
+var variantsByType = make(map[reflect.Type]*variants)
+
+// RegisterVariants makes nodes decoded into values of the interface type by the value of their discriminator key,
+// like items of node lists into a slice of the interface:
+//
+//	[steps]
+//	- type: http
+//	  url: https://fipress.org
+//	- type: shell
+//	  command: ls
+//
+//	fml.RegisterVariants(reflect.TypeOf((*Step)(nil)).Elem(), "type", map[string]reflect.Type{
+//		"http":  reflect.TypeOf(HTTPStep{}),
+//		"shell": reflect.TypeOf(&ShellStep{}),
+//	})
+//
+// Each type must implement the interface, a pointer type decodes into a pointer. Nodes without the key,
+// or with a value not registered, are errors. Marshal writes the key of the variants back.
+// Registering nil variants removes the ones of the interface.
+func RegisterVariants(iface reflect.Type, key string, types map[string]reflect.Type) {
+	if iface.Kind() != reflect.Interface {
+		panic("fml: RegisterVariants of non-interface type " + iface.String())
+	}
+	for value, t := range types {
+		if !t.Implements(iface) {
+			panic(fmt.Sprintf("fml: variant %s of %s does not implement it", value, t))
+		}
+	}
+
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	if types == nil {
+		delete(variantsByType, iface)
+		return
+	}
+	vs := &variants{key: key, types: make(map[string]reflect.Type, len(types))}
+	for value, t := range types {
+		vs.types[value] = t
+	}
+	variantsByType[iface] = vs
+}
+
+func getVariants(t reflect.Type) *variants {
+	if t.Kind() != reflect.Interface {
+		return nil
+	}
+	hooksMu.RLock()
+	defer hooksMu.RUnlock()
+	return variantsByType[t]
+}
+
+//valueOf gets the discriminator value of a variant type
+func (vs *variants) valueOf(t reflect.Type) (string, bool) {
+	for value, vt := range vs.types {
+		if vt == t {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+//decodeVariant decodes the node of the path into a new value of its variant, and stores it in out
+func (d *decoder) decodeVariant(out reflect.Value, vs *variants, node *FML, path string) error {
+	id, err := indexValue(node, vs.key)
+	if err != nil {
+		return &FieldError{Path: path, Line: d.line(path), Msg: "has no value of " + vs.key}
+	}
+	t, ok := vs.types[id]
+	if !ok {
+		keyPath := joinPath(path, vs.key)
+		return &FieldError{Path: keyPath, Line: d.line(keyPath), Msg: "has an unknown variant " + strconv.Quote(id)}
+	}
+
+	val := reflect.New(t).Elem()
+	if err = d.setField(val, node, path); err != nil {
+		return err
+	}
+	out.Set(val)
+	return nil
+}
+
+//decodeVariants decodes a node list of the path into a slice of an interface type with variants
+func (d *decoder) decodeVariants(out reflect.Value, vs *variants, list []*FML, path string) error {
+	slice := reflect.MakeSlice(out.Type(), len(list), len(list))
+	for i, item := range list {
+		if err := d.decodeVariant(slice.Index(i), vs, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+			return err
+		}
+	}
+	out.Set(slice)
+	return nil
+}
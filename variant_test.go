@@ -0,0 +1,111 @@
+package fml
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type step interface {
+	run() string
+}
+
+type httpStep struct {
+	URL    string `fml:"url" required:"true"`
+	Method string `fml:"method" default:"GET"`
+}
+
+func (s httpStep) run() string { return s.Method + " " + s.URL }
+
+type shellStep struct {
+	Command string `fml:"command"`
+}
+
+func (s *shellStep) run() string { return "sh " + s.Command }
+
+func registerSteps() func() {
+	stepType := reflect.TypeOf((*step)(nil)).Elem()
+	RegisterVariants(stepType, "type", map[string]reflect.Type{
+		"http":  reflect.TypeOf(httpStep{}),
+		"shell": reflect.TypeOf(&shellStep{}),
+	})
+	return func() { RegisterVariants(stepType, "type", nil) }
+}
+
+func TestUnmarshalVariants(t *testing.T) {
+	defer registerSteps()()
+
+	type pipeline struct {
+		Steps []step          `fml:"steps"`
+		Final step            `fml:"final"`
+		ByID  map[string]step `fml:"named,key=id"`
+	}
+	input := `[steps]
+- type: http
+  url: https://fipress.org
+- type: shell
+  command: ls
+
+[final]
+type: shell
+command: echo
+
+[named]
+- id: a
+  type: http
+  url: /a
+`
+	var p pipeline
+	if err := UnmarshalString(input, &p); err != nil {
+		t.Fatal("Unmarshal failed:", err)
+	}
+	if len(p.Steps) != 2 || p.Steps[0].run() != "GET https://fipress.org" || p.Steps[1].run() != "sh ls" {
+		t.Error("Should decode the items by their types, got:", p.Steps)
+	}
+	if p.Final == nil || p.Final.run() != "sh echo" || p.ByID["a"].run() != "GET /a" {
+		t.Error("Should decode a node by its type, got:", p.Final, p.ByID)
+	}
+
+	cases := []struct {
+		input, path, msg string
+		line             int
+	}{
+		{"[steps]\n- type: http\n  url: /\n- type: ftp\n", "steps[1].type", `has an unknown variant "ftp"`, 4},
+		{"[steps]\n- url: /\n", "steps[0]", "has no value of type", 2},
+		{"[steps]\n- type: http\n", "steps[0].url", "is required", 2},
+	}
+	for _, c := range cases {
+		var fe *FieldError
+		err := UnmarshalString(c.input, &p)
+		if !errors.As(err, &fe) || fe.Path != c.path || fe.Msg != c.msg || fe.Line != c.line {
+			t.Errorf("Should fail for %q with %s %s at line %d, got: %v", c.input, c.path, c.msg, c.line, err)
+		}
+	}
+
+	doc, _ := ParseString(input)
+	steps, err := GetSlice[step](doc, "steps")
+	if err != nil || len(steps) != 2 || steps[1].run() != "sh ls" {
+		t.Error("Should get the items by their types, got:", steps, err)
+	}
+
+	out, err := Marshal(p)
+	if err != nil || !strings.Contains(string(out), "type:http") {
+		t.Fatal("Should marshal the types of the variants, got:", string(out), err)
+	}
+	var back pipeline
+	if err = Unmarshal(out, &back); err != nil || len(back.Steps) != 2 || back.Steps[1].run() != "sh ls" {
+		t.Error("Should decode what is marshaled, got:", back, err)
+	}
+}
+
+func TestRegisterVariants(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Should panic for types not implementing the interface")
+		}
+	}()
+	RegisterVariants(reflect.TypeOf((*step)(nil)).Elem(), "type", map[string]reflect.Type{
+		"shell": reflect.TypeOf(shellStep{}),
+	})
+}
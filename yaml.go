@@ -0,0 +1,782 @@
+package fml
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	errYAMLUTF8 = errors.New("invalid UTF-8, YAML must be UTF-8")
+
+	yamlDecimal = regexp.MustCompile(`^[-+]?[0-9]+$`)
+	yamlFloat   = regexp.MustCompile(`^[-+]?(\.[0-9]+|[0-9]+(\.[0-9]*)?)([eE][-+]?[0-9]+)?$`)
+)
+
+// A YAMLError reports YAML which is not supported, or can't be expressed in fml, and the line of it.
+type YAMLError struct {
+	Line int
+	Msg  string
+}
+
+func (e *YAMLError) Error() string {
+	return fmt.Sprintf("convert yaml failed at line %d: %s", e.Line, e.Msg)
+}
+
+func yamlErrorf(line int, format string, args ...interface{}) error {
+	return &YAMLError{Line: line, Msg: fmt.Sprintf(format, args...)}
+}
+
+// ToYAML converts the document to YAML. Nodes are mappings, node lists are sequences of mappings,
+// arrays are flow sequences like [a, b], multiple line strings are literal block scalars,
+// datetimes are RFC3339 timestamps and sealed secrets are plain values like enc:aes:...
+// Keys are written in order.
+func ToYAML(doc *FML) ([]byte, error) {
+	doc.rlock()
+	defer doc.runlock()
+	var b strings.Builder
+	if err := writeYAMLNode(&b, doc, "", ""); err != nil {
+		return nil, err
+	}
+	return []byte(b.String()), nil
+}
+
+// FromYAML converts a YAML document to a fml document, the reverse of ToYAML.
+// The document must be a mapping. Mappings are nodes, sequences of mappings are node lists,
+// sequences of scalars of the same type are arrays, and block scalars are multiple line strings.
+// Plain scalars are resolved by the YAML core schema, plain timestamps are datetimes and plain
+// values like enc:aes:... are sealed secrets.
+//
+// Only a subset of YAML is supported, anchors, aliases, tags, complex keys, multiple documents and
+// values spanning lines other than block scalars are reported as a YAMLError, so are what fml can't
+// express: nested sequences, sequences mixing types or holding null, and keys like "a: b", "a=b" or "a@b".
+func FromYAML(data []byte) (*FML, error) {
+	p := newYAMLParser(data)
+	for _, l := range p.lines {
+		if !utf8.ValidString(l.text) {
+			return nil, yamlErrorf(l.num, "invalid UTF-8")
+		}
+	}
+	return p.parseDocument()
+}
+
+type yamlLine struct {
+	num    int
+	indent int
+	text   string //the line after the indentation
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+func newYAMLParser(data []byte) *yamlParser {
+	src := strings.TrimPrefix(string(data), "\uFEFF")
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	raw := strings.Split(src, "\n")
+	lines := make([]yamlLine, len(raw))
+	for i, line := range raw {
+		text := strings.TrimLeft(line, " ")
+		lines[i] = yamlLine{num: i + 1, indent: len(line) - len(text), text: text}
+	}
+	return &yamlParser{lines: lines}
+}
+
+//peek skips blank lines and comments, and returns the next line, or nil at the end
+func (p *yamlParser) peek() *yamlLine {
+	for ; p.pos < len(p.lines); p.pos++ {
+		l := &p.lines[p.pos]
+		if text := strings.TrimSpace(l.text); text != "" && text[0] != '#' {
+			return l
+		}
+	}
+	return nil
+}
+
+func (p *yamlParser) parseDocument() (*FML, error) {
+	l := p.peek()
+	if l != nil && l.text[0] == '%' {
+		return nil, yamlErrorf(l.num, "directives are not supported")
+	}
+	if l != nil && isDocMarker(l, "---") {
+		if rest := strings.TrimSpace(l.text[3:]); rest != "" && rest[0] != '#' {
+			return nil, yamlErrorf(l.num, "values after --- are not supported")
+		}
+		p.pos++
+		l = p.peek()
+	}
+
+	doc := NewFml()
+	if l != nil && !isDocMarker(l, "...") {
+		val, err := p.parseBlock(l.indent)
+		if err != nil {
+			return nil, err
+		}
+		node, ok := val.(*FML)
+		if !ok {
+			return nil, yamlErrorf(l.num, "the document must be a mapping")
+		}
+		doc = node
+	}
+
+	if l = p.peek(); l != nil && isDocMarker(l, "...") {
+		p.pos++
+		l = p.peek()
+	}
+	switch {
+	case l == nil:
+		return doc, nil
+	case isDocMarker(l, "---"):
+		return nil, yamlErrorf(l.num, "multiple documents are not supported")
+	}
+	return nil, yamlErrorf(l.num, "bad indentation")
+}
+
+func isDocMarker(l *yamlLine, marker string) bool {
+	return l.indent == 0 && strings.HasPrefix(l.text, marker) &&
+		(len(l.text) == 3 || l.text[3] == ' ' || l.text[3] == '\t')
+}
+
+func isSeqItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+//parseBlock parses the mapping or the sequence starting at the next line
+func (p *yamlParser) parseBlock(indent int) (interface{}, error) {
+	if isSeqItem(p.peek().text) {
+		return p.parseSequence(indent)
+	}
+	return p.parseMapping(indent)
+}
+
+func (p *yamlParser) parseMapping(indent int) (*FML, error) {
+	node := NewFml()
+	for l := p.peek(); l != nil && l.indent >= indent && !isDocMarker(l, "---") && !isDocMarker(l, "..."); l = p.peek() {
+		switch {
+		case l.indent > indent:
+			return nil, yamlErrorf(l.num, "bad indentation")
+		case l.text[0] == '\t':
+			return nil, yamlErrorf(l.num, "tabs are not allowed in indentation")
+		case isSeqItem(l.text):
+			return nil, yamlErrorf(l.num, "expected a key, not a sequence item")
+		}
+		key, rest, err := splitKey(l.num, l.text)
+		if err != nil {
+			return nil, err
+		}
+		p.pos++
+		val, err := p.parseValue(l, rest, indent, true)
+		if err != nil {
+			return nil, err
+		}
+		if err = setYAMLValue(l.num, node, key, val); err != nil {
+			return nil, err
+		}
+	}
+	return node, nil
+}
+
+func (p *yamlParser) parseSequence(indent int) (interface{}, error) {
+	first := p.peek().num
+	var items []interface{}
+	for l := p.peek(); l != nil && l.indent >= indent; l = p.peek() {
+		if l.indent > indent {
+			return nil, yamlErrorf(l.num, "bad indentation")
+		} else if !isSeqItem(l.text) {
+			break
+		}
+
+		content := strings.TrimLeft(l.text[1:], " ")
+		col := l.indent + len(l.text) - len(content)
+		var val interface{}
+		var err error
+		switch {
+		case isSeqItem(content):
+			return nil, yamlErrorf(l.num, "nested sequences can't be expressed in fml")
+		case isKey(content):
+			//a mapping starts on the line of the dash, the rest of its keys are aligned to the first
+			l.indent, l.text = col, content
+			val, err = p.parseMapping(col)
+		default:
+			p.pos++
+			val, err = p.parseValue(l, content, indent, false)
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, val)
+	}
+	return yamlArray(first, items)
+}
+
+//parseValue parses the value after a key or a dash, a nested block must be indented more than the indent,
+//except a sequence may be indented as its key
+func (p *yamlParser) parseValue(l *yamlLine, rest string, indent int, inMapping bool) (interface{}, error) {
+	text := strings.TrimSpace(rest)
+	if text == "" || text[0] == '#' {
+		next := p.peek()
+		switch {
+		case next == nil:
+		case next.indent > indent:
+			return p.parseBlock(next.indent)
+		case next.indent == indent && inMapping && isSeqItem(next.text):
+			return p.parseSequence(indent)
+		}
+		return nil, nil
+	}
+
+	var val interface{}
+	var err error
+	switch text[0] {
+	case '&', '*', '!':
+		return nil, yamlErrorf(l.num, "anchors, aliases and tags are not supported")
+	case '|', '>':
+		return p.parseBlockScalar(l, text, indent)
+	case '[', '{':
+		val, err = parseFlow(l.num, text)
+	default:
+		val, err = parseScalar(l.num, text)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if next := p.peek(); next != nil && next.indent > indent {
+		return nil, yamlErrorf(next.num, "values spanning lines are only supported as block scalars")
+	}
+	return val, nil
+}
+
+func (p *yamlParser) parseBlockScalar(l *yamlLine, header string, indent int) (interface{}, error) {
+	if i := strings.Index(header, " #"); i > 0 {
+		header = strings.TrimSpace(header[:i])
+	}
+	folded, chomp := header[0] == '>', byte(0)
+	for i := 1; i < len(header); i++ {
+		switch c := header[i]; {
+		case (c == '-' || c == '+') && chomp == 0:
+			chomp = c
+		case c >= '1' && c <= '9':
+			return nil, yamlErrorf(l.num, "indentation indicators are not supported")
+		default:
+			return nil, yamlErrorf(l.num, "invalid block scalar header: %s", header)
+		}
+	}
+
+	var lines []string
+	contentIndent := -1
+	for ; p.pos < len(p.lines); p.pos++ {
+		line := p.lines[p.pos]
+		if strings.TrimSpace(line.text) == "" {
+			lines = append(lines, "")
+			continue
+		}
+		if line.indent <= indent || contentIndent >= 0 && line.indent < contentIndent {
+			break
+		}
+		if contentIndent < 0 {
+			contentIndent = line.indent
+		}
+		lines = append(lines, strings.Repeat(" ", line.indent-contentIndent)+line.text)
+	}
+
+	trailing := 0
+	for trailing < len(lines) && lines[len(lines)-1-trailing] == "" {
+		trailing++
+	}
+	body := lines[:len(lines)-trailing]
+	text := strings.Join(body, "\n")
+	if folded {
+		text = foldLines(body)
+	}
+	switch {
+	case chomp == '+':
+		if len(body) != 0 {
+			trailing++
+		}
+		return text + strings.Repeat("\n", trailing), nil
+	case chomp == '-' || len(body) == 0:
+		return text, nil
+	}
+	return text + "\n", nil
+}
+
+//isKey reports whether the text starts with a key, complex keys count so they are reported
+func isKey(text string) bool {
+	switch {
+	case text == "":
+		return false
+	case text == "?" || strings.HasPrefix(text, "? "):
+		return true
+	}
+	_, _, err := splitKey(0, text)
+	return err == nil
+}
+
+//splitKey splits a line of a mapping to the key and the rest after the colon
+func splitKey(num int, text string) (key, rest string, err error) {
+	switch text[0] {
+	case '?':
+		if text == "?" || text[1] == ' ' {
+			return "", "", yamlErrorf(num, "complex keys are not supported")
+		}
+	case '&', '*', '!':
+		return "", "", yamlErrorf(num, "anchors, aliases and tags are not supported")
+	case '[', '{':
+		return "", "", yamlErrorf(num, "complex keys are not supported")
+	case '"', '\'':
+		end := quoteEnd(text)
+		if end > 0 {
+			rest = strings.TrimLeft(text[end:], " ")
+			if rest == ":" || strings.HasPrefix(rest, ": ") {
+				key, err = unquoteYAML(num, text[:end])
+				return key, rest[1:], err
+			}
+		}
+		return "", "", yamlErrorf(num, "expected a key")
+	}
+
+	for i := 0; i < len(text); i++ {
+		switch {
+		case text[i] == ':' && (i+1 == len(text) || text[i+1] == ' '):
+			key = strings.TrimRight(text[:i], " \t")
+			if key == "<<" {
+				return "", "", yamlErrorf(num, "merge keys are not supported")
+			}
+			return key, text[i+1:], nil
+		case text[i] == '#' && i > 0 && text[i-1] == ' ':
+			i = len(text)
+		}
+	}
+	return "", "", yamlErrorf(num, "expected a key")
+}
+
+//setYAMLValue sets the value of a new key, the key must be able to be written in fml
+func setYAMLValue(num int, node *FML, key string, val interface{}) error {
+	if _, ok := node.dict[key]; ok {
+		return yamlErrorf(num, "duplicate key: %s", key)
+	}
+	if !canWriteKey(key, val) {
+		return yamlErrorf(num, "the key %q can't be expressed in fml", key)
+	}
+	node.dict[key] = val
+	return nil
+}
+
+//quoteEnd returns the index after the closing quote of the quoted text, or -1 if it's not closed
+func quoteEnd(text string) int {
+	q := text[0]
+	for i := 1; i < len(text); i++ {
+		switch {
+		case q == '"' && text[i] == '\\':
+			i++
+		case text[i] == q && q == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			i++
+		case text[i] == q:
+			return i + 1
+		}
+	}
+	return -1
+}
+
+func unquoteYAML(num int, quoted string) (s string, err error) {
+	inner := quoted[1 : len(quoted)-1]
+	if quoted[0] == '\'' {
+		return strings.ReplaceAll(inner, "''", "'"), nil
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = yamlErrorf(num, "%v", r)
+		}
+	}()
+	return unescape(inner), nil
+}
+
+//parseScalar parses a quoted or plain scalar on a line, a comment may follow it
+func parseScalar(num int, text string) (interface{}, error) {
+	if text[0] == '"' || text[0] == '\'' {
+		end := quoteEnd(text)
+		if end < 0 {
+			return nil, yamlErrorf(num, "values spanning lines are only supported as block scalars")
+		}
+		if rest := strings.TrimSpace(text[end:]); rest != "" && rest[0] != '#' {
+			return nil, yamlErrorf(num, "unexpected content after the quoted value")
+		}
+		return unquoteYAML(num, text[:end])
+	}
+	if i := strings.Index(text, " #"); i >= 0 {
+		text = strings.TrimSpace(text[:i])
+	}
+	return resolveYAML(text), nil
+}
+
+//resolveYAML resolves a plain scalar by the YAML core schema,
+//timestamps are datetimes and values like enc:aes:... are sealed secrets as they are in fml
+func resolveYAML(s string) interface{} {
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	case ".inf", ".Inf", ".INF", "+.inf", "+.Inf", "+.INF":
+		return math.Inf(1)
+	case "-.inf", "-.Inf", "-.INF":
+		return math.Inf(-1)
+	case ".nan", ".NaN", ".NAN":
+		return math.NaN()
+	}
+
+	switch {
+	case yamlDecimal.MatchString(s):
+		if i, err := strconv.ParseInt(s, 10, 0); err == nil {
+			return int(i)
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	case strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0o"):
+		base := 16
+		if s[1] == 'o' {
+			base = 8
+		}
+		if i, err := strconv.ParseInt(s[2:], base, 0); err == nil && s[2] != '-' && s[2] != '+' {
+			return int(i)
+		}
+	case yamlFloat.MatchString(s):
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	}
+	if t, ok := evalDatetime(s); ok {
+		return t
+	}
+	if secret, ok := evalSecret(s); ok {
+		return secret
+	}
+	return s
+}
+
+//yamlArray converts the items of a sequence to a typed array, or a node list if they are mappings.
+//Sealed secrets are kept as strings, as arrays of fml don't hold secrets.
+func yamlArray(num int, items []interface{}) (interface{}, error) {
+	for i, item := range items {
+		switch v := item.(type) {
+		case nil:
+			return nil, yamlErrorf(num, "null items in sequences can't be expressed in fml")
+		case Secret:
+			items[i] = v.String()
+		case *FML, string, int, float64, bool, time.Time:
+		default:
+			return nil, yamlErrorf(num, "nested sequences can't be expressed in fml")
+		}
+	}
+	arr, err := typedArray(items)
+	if err != nil {
+		return nil, yamlErrorf(num, "sequences mixing types can't be expressed in fml")
+	}
+	return arr, nil
+}
+
+//yamlFlow parses a flow collection, like [a, b] or {a: 1, b: 2}, in a line
+type yamlFlow struct {
+	num  int
+	text string
+	i    int
+}
+
+func parseFlow(num int, text string) (interface{}, error) {
+	f := &yamlFlow{num: num, text: text}
+	val, err := f.value()
+	if err != nil {
+		return nil, err
+	}
+	f.skipSpace()
+	if f.i < len(f.text) && (f.text[f.i] != '#' || f.text[f.i-1] != ' ') {
+		return nil, yamlErrorf(num, "unexpected content after the flow collection")
+	}
+	return val, nil
+}
+
+func (f *yamlFlow) skipSpace() {
+	for f.i < len(f.text) && (f.text[f.i] == ' ' || f.text[f.i] == '\t') {
+		f.i++
+	}
+}
+
+//next skips spaces and returns the next char, or an error at the end of the line
+func (f *yamlFlow) next() (byte, error) {
+	f.skipSpace()
+	if f.i >= len(f.text) {
+		return 0, yamlErrorf(f.num, "flow collections spanning lines are not supported")
+	}
+	return f.text[f.i], nil
+}
+
+func (f *yamlFlow) value() (interface{}, error) {
+	c, err := f.next()
+	if err != nil {
+		return nil, err
+	}
+	switch c {
+	case '[':
+		return f.sequence()
+	case '{':
+		return f.mapping()
+	case '&', '*', '!':
+		return nil, yamlErrorf(f.num, "anchors, aliases and tags are not supported")
+	case '"', '\'':
+		return f.quoted()
+	}
+	return resolveYAML(f.plain()), nil
+}
+
+func (f *yamlFlow) quoted() (string, error) {
+	end := quoteEnd(f.text[f.i:])
+	if end < 0 {
+		return "", yamlErrorf(f.num, "values spanning lines are only supported as block scalars")
+	}
+	f.i += end
+	return unquoteYAML(f.num, f.text[f.i-end:f.i])
+}
+
+//plain scans a plain scalar, which ends at a flow indicator, a colon followed by a space, or a comment
+func (f *yamlFlow) plain() string {
+	start := f.i
+	for ; f.i < len(f.text); f.i++ {
+		c := f.text[f.i]
+		if c == ',' || c == ']' || c == '}' || c == '#' && f.text[f.i-1] == ' ' ||
+			c == ':' && (f.i+1 == len(f.text) || strings.IndexByte(" ,]}", f.text[f.i+1]) >= 0) {
+			break
+		}
+	}
+	return strings.TrimSpace(f.text[start:f.i])
+}
+
+func (f *yamlFlow) sequence() (interface{}, error) {
+	f.i++
+	var items []interface{}
+	for {
+		c, err := f.next()
+		if err != nil {
+			return nil, err
+		}
+		if c == ']' {
+			f.i++
+			return yamlArray(f.num, items)
+		}
+		item, err := f.value()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		if err = f.separator(']'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (f *yamlFlow) mapping() (interface{}, error) {
+	f.i++
+	node := NewFml()
+	for {
+		c, err := f.next()
+		if err != nil {
+			return nil, err
+		}
+		var key string
+		switch c {
+		case '}':
+			f.i++
+			return node, nil
+		case '[', '{', '?':
+			return nil, yamlErrorf(f.num, "complex keys are not supported")
+		case '"', '\'':
+			key, err = f.quoted()
+		default:
+			key = f.plain()
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var val interface{}
+		if c, err = f.next(); err != nil {
+			return nil, err
+		}
+		if c == ':' {
+			f.i++
+			if c, err = f.next(); err != nil {
+				return nil, err
+			}
+			if c != ',' && c != '}' {
+				if val, err = f.value(); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if err = setYAMLValue(f.num, node, key, val); err != nil {
+			return nil, err
+		}
+		if err = f.separator('}'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+//separator skips the comma after an item, or stops before the closing char
+func (f *yamlFlow) separator(closing byte) error {
+	c, err := f.next()
+	switch {
+	case err != nil:
+		return err
+	case c == ',':
+		f.i++
+	case c != closing:
+		return yamlErrorf(f.num, "expected , or %c in the flow collection", closing)
+	}
+	return nil
+}
+
+//writeYAMLNode writes the keys of the node indented by the pad, the first line starts with first if it's not empty
+func writeYAMLNode(b *strings.Builder, node *FML, pad, first string) error {
+	keys := node.keys()
+	sort.Strings(keys)
+	for i, k := range keys {
+		if !utf8.ValidString(k) {
+			return fmt.Errorf("convert yaml failed: invalid UTF-8 in the key %q", k)
+		}
+		if i == 0 && first != "" {
+			b.WriteString(first)
+		} else {
+			b.WriteString(pad)
+		}
+		b.WriteString(yamlString(k, "", true))
+		b.WriteByte(':')
+
+		switch v := node.dict[k].(type) {
+		case *FML:
+			if v == nil {
+				b.WriteString(" null\n")
+			} else if len(v.dict) == 0 {
+				b.WriteString(" {}\n")
+			} else {
+				b.WriteByte('\n')
+				if err := writeYAMLNode(b, v, pad+"  ", ""); err != nil {
+					return err
+				}
+			}
+		case []*FML:
+			if len(v) == 0 {
+				b.WriteString(" []\n")
+				continue
+			}
+			b.WriteByte('\n')
+			for _, item := range v {
+				if item == nil || len(item.dict) == 0 {
+					b.WriteString(pad + "  - {}\n")
+				} else if err := writeYAMLNode(b, item, pad+"    ", pad+"  - "); err != nil {
+					return err
+				}
+			}
+		default:
+			s, err := yamlValue(v, pad)
+			if err != nil {
+				return fmt.Errorf("convert yaml failed: %s: %v", k, err)
+			}
+			b.WriteString(" " + s + "\n")
+		}
+	}
+	return nil
+}
+
+//yamlValue formats a value, multiple line strings are block scalars indented more than the pad
+func yamlValue(val interface{}, pad string) (string, error) {
+	switch v := val.(type) {
+	case nil:
+		return "null", nil
+	case string:
+		if !utf8.ValidString(v) {
+			return "", errYAMLUTF8
+		}
+		return yamlString(v, pad, false), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case float64:
+		switch {
+		case math.IsInf(v, 1):
+			return ".inf", nil
+		case math.IsInf(v, -1):
+			return "-.inf", nil
+		case math.IsNaN(v):
+			return ".nan", nil
+		}
+		return formatFloat(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	case Secret:
+		return v.String(), nil
+	case []string, []int, []float64, []bool, []time.Time:
+		rv := reflect.ValueOf(v)
+		items := make([]string, rv.Len())
+		for i := range items {
+			item := rv.Index(i).Interface()
+			if s, ok := item.(string); !ok {
+				items[i], _ = yamlValue(item, "")
+			} else if !utf8.ValidString(s) {
+				return "", errYAMLUTF8
+			} else {
+				items[i] = yamlString(s, "", true)
+			}
+		}
+		return "[" + strings.Join(items, ", ") + "]", nil
+	}
+	return "", fmt.Errorf("unsupported value of type %T", val)
+}
+
+//yamlString writes a string plain if YAML reads it back as the same string, or as a block scalar
+//if it has multiple lines, or quoted. Strings in flow collections are never block scalars.
+func yamlString(s, pad string, flow bool) string {
+	if !flow && canBlock(s) {
+		header := "|"
+		if !strings.HasSuffix(s, "\n") {
+			header = "|-"
+		}
+		lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+		for i, line := range lines {
+			if line != "" {
+				lines[i] = pad + "  " + line
+			}
+		}
+		return header + "\n" + strings.Join(lines, "\n")
+	}
+	if yamlPlain(s, flow) {
+		return s
+	}
+	return quoteEscaped(s)
+}
+
+func yamlPlain(s string, flow bool) bool {
+	if s == "" || s != strings.TrimSpace(s) || strings.ContainsAny(s[:1], "-?:,[]{}#&*!|>'\"%@`") ||
+		strings.Contains(s, ": ") || strings.Contains(s, " #") || strings.HasSuffix(s, ":") ||
+		flow && strings.ContainsAny(s, ",[]{}") {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < ' ' || s[i] == 0x7f {
+			return false
+		}
+	}
+	_, ok := resolveYAML(s).(string)
+	return ok
+}
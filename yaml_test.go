@@ -0,0 +1,167 @@
+package fml
+
+import (
+	"math"
+	"testing"
+)
+
+func TestToYAML(t *testing.T) {
+	doc, _ := ParseString(`name: app
+port: 8080
+ratio: 2.0
+tags: [a, "b, c", true]
+when: 2014-07-06T12:00:00+08:00
+password: enc:aes:c2VjcmV0
+note: |
+  first line
+  second line
+
+[db]
+host: local
+empty:
+
+[staff]
+- name: Abby
+  age: 30
+- name: Bill
+`)
+	doc.SetValue("nothing", nil)
+	out, err := ToYAML(doc)
+	if err != nil {
+		t.Fatal("ToYAML failed:", err)
+	}
+	expected := `db:
+  empty: ""
+  host: local
+name: app
+note: |
+  first line
+  second line
+nothing: null
+password: enc:aes:c2VjcmV0
+port: 8080
+ratio: 2.0
+staff:
+  - age: 30
+    name: Abby
+  - name: Bill
+tags: [a, "b, c", "true"]
+when: 2014-07-06T12:00:00+08:00
+`
+	if string(out) != expected {
+		t.Error("Should convert to yaml, got:", string(out))
+	}
+
+	back, err := FromYAML(out)
+	if err != nil || !Equal(doc, back) {
+		t.Error("Should convert back, got:", back, err)
+	}
+}
+
+func TestFromYAML(t *testing.T) {
+	doc, err := FromYAML([]byte(`---
+# a comment
+name: app   # trailing comment
+quoted: "a: b # c"
+single: 'it''s'
+on: yes
+off: False
+count: 0x1F
+inf: -.inf
+none: ~
+path: http://localhost:8080
+day: 2014-07-06
+secret: enc:aes:c2VjcmV0
+ids:
+- 1
+- 2.5
+flow: {a: 1, b: [x, y]}
+script: |-
+  echo a
+
+  echo b
+folded: >
+  one
+  two
+servers:
+  - host: a
+    ports: [80, 443]
+  -   host: b
+      tls:
+        enabled: true
+...
+`))
+	if err != nil {
+		t.Fatal("FromYAML failed:", err)
+	}
+	if doc.GetString("name") != "app" || doc.GetString("quoted") != "a: b # c" || doc.GetString("single") != "it's" {
+		t.Error("Should read strings, got:", doc)
+	}
+	if doc.GetString("on") != "yes" || doc.GetBool("off") || doc.GetInt("count") != 31 || !doc.IsNull("none") {
+		t.Error("Should resolve scalars by the core schema, got:", doc)
+	}
+	if f := doc.GetFloat("inf"); !math.IsInf(f, -1) {
+		t.Error("Should read .inf, got:", f)
+	}
+	if doc.GetString("path") != "http://localhost:8080" || doc.GetDatetime("day").Day() != 6 {
+		t.Error("Should read plain values with colons and datetimes, got:", doc)
+	}
+	if s, _ := doc.Lookup("secret"); s != (Secret{Provider: "aes", Ciphertext: "c2VjcmV0"}) {
+		t.Error("Should read sealed secrets, got:", s)
+	}
+	if ids := doc.GetFloatArray("ids"); len(ids) != 2 || ids[0] != 1 {
+		t.Error("Should read sequences as arrays, got:", ids)
+	}
+	if doc.GetInt("flow.a") != 1 || len(doc.GetStringArray("flow.b")) != 2 {
+		t.Error("Should read flow collections, got:", doc)
+	}
+	if doc.GetString("script") != "echo a\n\necho b" || doc.GetString("folded") != "one two\n" {
+		t.Error("Should read block scalars, got:", doc.GetString("script"), doc.GetString("folded"))
+	}
+	servers, err := doc.GetNodeList("servers")
+	if err != nil || len(servers) != 2 || servers[0].GetIntArray("ports")[1] != 443 ||
+		servers[1].GetString("host") != "b" || !servers[1].GetBool("tls.enabled") {
+		t.Error("Should read sequences of mappings as node lists, got:", servers, err)
+	}
+
+	if doc, err = FromYAML([]byte("a: []\n")); err != nil {
+		t.Fatal("FromYAML failed:", err)
+	}
+	if back, err := ParseString(doc.String()); err != nil || !back.Has("a") || len(back.GetStringArray("a")) != 0 {
+		t.Error("Should write an empty sequence that parses back, got:", doc.String(), err)
+	}
+}
+
+func TestFromYAMLUnsupported(t *testing.T) {
+	cases := map[string]int{
+		"a: &x 1\nb: *x":           1,
+		"a: !!str 1":               1,
+		"? a\n: b":                 1,
+		"a: 1\n---\nb: 2":          2,
+		"- a\n- b":                 1,
+		"a:\n  - [1, 2]":           2,
+		"a:\n- 1\n- x":             2,
+		"a: [1, null]":             1,
+		"a: 1\na: 2":               2,
+		"a: 1\n\tb: 2":             2,
+		"a: 1\n  b: 2":             2,
+		"a: plain\n  continued":    2,
+		"a: [1, 2":                 1,
+		"a=b: 1":                   1,
+		"a@dev: 1":                 1,
+		"a.b:\n  c: 1":             1,
+		"a:\n  b: 1\n c: 2":        3,
+		"<<: {a: 1}":               1,
+		"a: \"unclosed\nb: 1":      1,
+		"a:\n  - x: 1\n  - - 2":    3,
+		"a: |2\n    indented":      1,
+		"list:\n  - b: 1\n  - c\n": 2,
+	}
+	for input, line := range cases {
+		_, err := FromYAML([]byte(input))
+		yerr, ok := err.(*YAMLError)
+		if !ok || yerr.Line != line {
+			t.Errorf("Should fail at line %d for %q, got: %v", line, input, err)
+		}
+	}
+}